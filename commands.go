@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kaplan-michael/slack-kudos/pkg/config"
+	"github.com/kaplan-michael/slack-kudos/pkg/database"
+	"github.com/kaplan-michael/slack-kudos/pkg/deadletter"
+)
+
+const usage = `Usage:
+  kudosbot                                 run the bot
+  kudosbot deadletters list [-team ID]     list the failed requests
+  kudosbot deadletters replay ID...        retry failed requests within a minute
+  kudosbot deadletters discard ID...       delete failed requests
+`
+
+// runCommand runs an admin command against the bot's database and returns
+// the exit code. Replayed requests are retried by the running bot.
+func runCommand(args []string) int {
+	if args[0] != "deadletters" || len(args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	config.InitDatabase()
+	if err := database.InitDB(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error initializing database: %v\n", err)
+		return 1
+	}
+
+	ctx := context.Background()
+	var err error
+	switch args[1] {
+	case "list":
+		err = listDeadLetters(ctx, args[2:])
+	case "replay":
+		err = eachDeadLetter(ctx, args[2:], deadletter.Replay, "Replaying")
+	case "discard":
+		err = eachDeadLetter(ctx, args[2:], deadletter.Discard, "Discarded")
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// listDeadLetters prints the failed requests as a table.
+func listDeadLetters(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	teamID := flags.String("team", "", "only list the requests of this workspace")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	letters, err := deadletter.List(ctx, *teamID)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tWORKSPACE\tKIND\tATTEMPTS\tNEXT ATTEMPT\tLAST ATTEMPT\tERROR")
+	for _, letter := range letters {
+		next := "given up"
+		if !letter.NextAttempt.IsZero() {
+			next = letter.NextAttempt.Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			letter.ID, letter.TeamID, letter.Kind, letter.Attempts, next,
+			letter.UpdatedAt.Format(time.DateTime), letter.Error)
+	}
+	return w.Flush()
+}
+
+// eachDeadLetter applies fn to the failed requests with the given IDs.
+func eachDeadLetter(ctx context.Context, args []string, fn func(ctx context.Context, id int64) error, done string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no dead letter IDs given")
+	}
+
+	for _, arg := range args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid dead letter ID %q", arg)
+		}
+		if err := fn(ctx, id); err != nil {
+			return err
+		}
+		fmt.Printf("%s dead letter %d\n", done, id)
+	}
+	return nil
+}
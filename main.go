@@ -3,6 +3,8 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"expvar"
 	"fmt"
 	l "log"
 	"net/http"
@@ -15,94 +17,214 @@ import (
 	"github.com/charmbracelet/log"
 	"github.com/kaplan-michael/slack-kudos/pkg/config"
 	"github.com/kaplan-michael/slack-kudos/pkg/database"
+	"github.com/kaplan-michael/slack-kudos/pkg/deadletter"
+	"github.com/kaplan-michael/slack-kudos/pkg/digest"
 	"github.com/kaplan-michael/slack-kudos/pkg/dispatcher"
+	"github.com/kaplan-michael/slack-kudos/pkg/dispatcher/middleware"
+	"github.com/kaplan-michael/slack-kudos/pkg/handler"
+	"github.com/kaplan-michael/slack-kudos/pkg/notify"
 	"github.com/kaplan-michael/slack-kudos/pkg/oauth2"
+	"github.com/kaplan-michael/slack-kudos/pkg/outbound"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+	"github.com/kaplan-michael/slack-kudos/pkg/schedule"
+	"github.com/kaplan-michael/slack-kudos/pkg/slackhttp"
 	"github.com/kaplan-michael/slack-kudos/pkg/utils"
+	"github.com/kaplan-michael/slack-kudos/pkg/workerpool"
 	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
 	"github.com/slack-go/slack/socketmode"
 )
 
-// WorkspaceClient holds the socket mode client for a workspace
+// WorkspaceClient holds the API client of a workspace
 type WorkspaceClient struct {
 	TeamID string
-	Client *socketmode.Client
 	API    *slack.Client
+	// Outbound queues the calls the handlers and jobs make with API
+	Outbound *outbound.Queue
+
+	// ctx is the parent of the workspace's handler contexts, it's cancelled
+	// when the workspace is removed
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
-// WorkspaceManager manages all workspace clients
+// WorkspaceManager manages all workspace clients and the Socket Mode
+// connection shared by all of them
 type WorkspaceManager struct {
+	ctx        context.Context
 	dispatcher *dispatcher.Dispatcher
-	clients    map[string]*WorkspaceClient
-	mu         sync.RWMutex
+	// pool handles the requests of all workspaces
+	pool    *workerpool.Pool
+	clients map[string]*WorkspaceClient
+	mu      sync.RWMutex
 }
 
-// NewWorkspaceManager creates a new workspace manager
-func NewWorkspaceManager(disp *dispatcher.Dispatcher) *WorkspaceManager {
+// NewWorkspaceManager creates a new workspace manager handling requests
+// with the pool. Cancelling ctx cancels the handlers of all workspaces.
+func NewWorkspaceManager(ctx context.Context, disp *dispatcher.Dispatcher, pool *workerpool.Pool) *WorkspaceManager {
 	return &WorkspaceManager{
+		ctx:        ctx,
 		dispatcher: disp,
+		pool:       pool,
 		clients:    make(map[string]*WorkspaceClient),
 		mu:         sync.RWMutex{},
 	}
 }
 
-// AddWorkspace adds a new workspace client
-func (wm *WorkspaceManager) AddWorkspace(creds oauth2.WorkspaceCredentials) error {
-	wm.mu.Lock()
-	defer wm.mu.Unlock()
-
-	// Check if we already have this workspace
-	if _, exists := wm.clients[creds.TeamID]; exists {
-		// Create a new API client with the refreshed token
-		wm.clients[creds.TeamID].API = slack.New(creds.AccessToken)
-		return nil
-	}
-
-	// Create a new Slack API client for this workspace
+// Run receives the events of all workspaces over a single Socket Mode
+// connection until the context is cancelled. Slack sends the events of
+// every installation over any connection of the app, so each event is
+// routed to its workspace by the team ID in the payload.
+func (wm *WorkspaceManager) Run(ctx context.Context) error {
+	// Socket Mode requires app-level token (same for all workspaces)
 	api := slack.New(
-		creds.AccessToken,
+		"",
 		slack.OptionDebug(config.AppConfig.Debug),
-		// Socket Mode requires app-level token (same for all workspaces)
 		slack.OptionAppLevelToken(config.AppConfig.SlackAppToken),
 	)
 
-	// Create a new Socket Mode client
 	client := socketmode.New(
 		api,
 		socketmode.OptionDebug(config.AppConfig.Debug),
-		socketmode.OptionLog(l.New(os.Stdout, fmt.Sprintf("workspace-%s: ", creds.TeamID), l.Lshortfile|l.LstdFlags)),
+		socketmode.OptionLog(l.New(os.Stdout, "socketmode: ", l.Lshortfile|l.LstdFlags)),
 	)
 
-	// Create workspace client
-	wsClient := &WorkspaceClient{
-		TeamID: creds.TeamID,
-		Client: client,
-		API:    api,
-	}
-
-	// Store the client
-	wm.clients[creds.TeamID] = wsClient
-
 	// Start listening for events
 	go func() {
-		for evt := range client.Events {
-			// We can't modify the Request.Context directly as it doesn't exist
-			// Instead, we'll store team ID in a workspace map in memory
-			// and look it up when needed from the API endpoints
-
-			// Dispatch events
-			if err := wm.dispatcher.Dispatch(&evt, client); err != nil {
-				log.Warnf("Error processing event for workspace %s: %s\n", creds.TeamID, err)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case evt := <-client.Events:
+				// Acknowledge right away, Slack resends events that aren't
+				// acknowledged within a few seconds
+				if evt.Request != nil {
+					client.Ack(*evt.Request)
+				}
+				// Waits while the queue is full, events are buffered by the
+				// connection in the meantime
+				if req, ok := socketRequest(evt); ok {
+					if err := wm.Enqueue(ctx, req); err != nil && ctx.Err() == nil {
+						log.Warnf("Dropping %s request for workspace %s: %v", req.Kind, req.TeamID, err)
+					}
+				}
 			}
 		}
 	}()
 
-	// Start the client
-	go func() {
-		log.Infof("Starting Socket Mode client for workspace: %s (%s)", creds.TeamName, creds.TeamID)
-		if err := client.Run(); err != nil {
-			log.Warnf("Socket Mode client for workspace %s stopped: %v", creds.TeamID, err)
-		}
-	}()
+	log.Info("Starting Socket Mode client")
+	if err := client.RunContext(ctx); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+// socketRequest converts a Socket Mode event to a request. Events about
+// the connection itself, like hello or disconnect, aren't requests.
+func socketRequest(evt socketmode.Event) (handler.Request, bool) {
+	switch data := evt.Data.(type) {
+	case slackevents.EventsAPIEvent:
+		return handler.EventRequest(data), true
+	case slack.SlashCommand:
+		return handler.CommandRequest(data), true
+	case slack.InteractionCallback:
+		return handler.InteractionRequest(data), true
+	}
+	return handler.Request{}, false
+}
+
+// Enqueue queues an acknowledged request, received over Socket Mode or
+// HTTP, for the worker pool. The requests of a channel are handled in the
+// order they arrived, see conversationKey. It waits while the queue is
+// full, until the request is queued or ctx is done.
+func (wm *WorkspaceManager) Enqueue(ctx context.Context, req handler.Request) error {
+	return wm.pool.Submit(ctx, conversationKey(req), func() {
+		wm.Dispatch(req)
+	})
+}
+
+// conversationKey is the key of the requests that have to be handled in
+// order, e.g. the kudos given in a channel.
+func conversationKey(req handler.Request) string {
+	return req.TeamID + "/" + req.ChannelID()
+}
+
+// Dispatch dispatches a request with the API client of its workspace.
+// Requests that fail with a retryable error, see deadletter.Retryable, or
+// are still queued on shutdown, are saved to the dead-letter store to be
+// retried.
+func (wm *WorkspaceManager) Dispatch(req handler.Request) {
+	if wm.ctx.Err() != nil {
+		log.Warnf("Saving %s request for workspace %s for later, shutting down", req.Kind, req.TeamID)
+		wm.saveFailed(req, errShuttingDown)
+		return
+	}
+
+	wsClient, ok := wm.GetWorkspaceClient(req.TeamID)
+	if !ok {
+		log.Warnf("Dropping %s request for unknown workspace %s", req.Kind, req.TeamID)
+		return
+	}
+
+	// Failed requests are logged by the logging middleware, the ones that
+	// may succeed later are retried
+	if err := wm.dispatcher.Dispatch(wsClient.ctx, req, wsClient.Outbound); err != nil && deadletter.Retryable(err) {
+		wm.saveFailed(req, err)
+	}
+}
+
+// errShuttingDown is the error of the requests left in the queue on shutdown.
+var errShuttingDown = errors.New("not handled before shutdown")
+
+// saveFailed saves a failed request to the dead-letter store. It's saved
+// also when the handler was cancelled by a shutdown.
+func (wm *WorkspaceManager) saveFailed(req handler.Request, reqErr error) {
+	if err := deadletter.Save(context.Background(), req, reqErr, config.AppConfig.RetryAttempts); err != nil {
+		log.Errorf("Failed to save failed %s request for workspace %s, it's lost: %v", req.Kind, req.TeamID, err)
+	}
+}
+
+// Retry dispatches a request from the dead-letter store and returns its
+// error, which keeps it in the store.
+func (wm *WorkspaceManager) Retry(req handler.Request) error {
+	wsClient, ok := wm.GetWorkspaceClient(req.TeamID)
+	if !ok {
+		return fmt.Errorf("unknown workspace %s", req.TeamID)
+	}
+	return wm.dispatcher.Dispatch(wsClient.ctx, req, wsClient.Outbound)
+}
+
+// AddWorkspace adds a new workspace client, or updates the token of an
+// existing one
+func (wm *WorkspaceManager) AddWorkspace(creds oauth2.WorkspaceCredentials) error {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+
+	// The workspace's clients send their requests with the current token
+	oauth2.SetToken(creds.TeamID, creds.AccessToken)
+
+	// Check if we already have this workspace
+	if _, exists := wm.clients[creds.TeamID]; exists {
+		return nil
+	}
+
+	// Create a new Slack API client for this workspace
+	api := slack.New(
+		creds.AccessToken,
+		slack.OptionDebug(config.AppConfig.Debug),
+		// Keeps the client working when the token is refreshed
+		slack.OptionHTTPClient(oauth2.NewHTTPClient(creds.TeamID)),
+	)
+
+	// Store the client, its events are routed to it from now on
+	ctx, cancel := context.WithCancel(wm.ctx)
+	wm.clients[creds.TeamID] = &WorkspaceClient{
+		TeamID:   creds.TeamID,
+		API:      api,
+		Outbound: outbound.New(respond.Client{Client: api}),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
 
 	log.Infof("Added workspace: %s (%s)", creds.TeamName, creds.TeamID)
 	return nil
@@ -113,13 +235,20 @@ func (wm *WorkspaceManager) RemoveWorkspace(teamID string) {
 	wm.mu.Lock()
 	defer wm.mu.Unlock()
 
-	if _, exists := wm.clients[teamID]; exists {
-		// Just remove it from the map - socket mode client will be garbage collected
+	if client, exists := wm.clients[teamID]; exists {
+		// Its events are dropped from now on and running handlers are cancelled
+		client.cancel()
 		delete(wm.clients, teamID)
 		log.Infof("Removed workspace: %s", teamID)
 	}
 }
 
+// Wait stops accepting requests and waits for the queued and running ones.
+// Once the manager's context is cancelled the queued requests are dropped.
+func (wm *WorkspaceManager) Wait() {
+	wm.pool.Close()
+}
+
 // GetWorkspaceClient gets a workspace client by team ID
 func (wm *WorkspaceManager) GetWorkspaceClient(teamID string) (*WorkspaceClient, bool) {
 	wm.mu.RLock()
@@ -130,6 +259,11 @@ func (wm *WorkspaceManager) GetWorkspaceClient(teamID string) (*WorkspaceClient,
 }
 
 func main() {
+	// Admin commands run instead of the bot
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
 	// Initialize configuration
 	config.Init()
 
@@ -139,20 +273,63 @@ func main() {
 		log.Fatalf("Error initializing database: %s\n", err)
 	}
 
+	// Everything started from here is cancelled on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	// Initialize the central dispatcher
-	disp := dispatcher.NewDispatcher()
+	timeouts := dispatcher.Timeouts{
+		Default: config.AppConfig.HandlerTimeout,
+		Kinds:   map[handler.Kind]time.Duration{},
+	}
+	for kind, timeout := range config.AppConfig.HandlerTimeouts {
+		timeouts.Kinds[handler.Kind(kind)] = timeout
+	}
+	disp := dispatcher.NewDispatcher(timeouts)
+	disp.Use(
+		middleware.Logging(),
+		middleware.Metrics(),
+		middleware.Recover(),
+		// Slack retries deliveries for a few minutes
+		middleware.Dedup(15*time.Minute),
+	)
+	if config.AppConfig.RateLimit > 0 {
+		disp.Use(middleware.RateLimit(config.AppConfig.RateLimit))
+	}
+	disp.Use(middleware.ChannelFilter())
+
+	// Handle requests with a bounded number of workers, the queue depth is
+	// served with the other metrics
+	pool := workerpool.New(config.AppConfig.Workers, config.AppConfig.QueueSize)
+	expvar.Publish("dispatcher_queue_depth", expvar.Func(func() any {
+		return pool.Depth()
+	}))
 
 	// Create workspace manager for multi-tenant support
-	workspaceManager := NewWorkspaceManager(disp)
+	workspaceManager := NewWorkspaceManager(ctx, disp, pool)
 
 	// Create HTTP server for OAuth flow
 	oauthHandler := oauth2.NewOAuthHandler()
+	// New workspaces start right away, re-installs replace the token of the running client
+	oauthHandler.OnInstall(func(creds oauth2.WorkspaceCredentials) {
+		if err := workspaceManager.AddWorkspace(creds); err != nil {
+			log.Warnf("Failed to start installed workspace %s: %v", creds.TeamID, err)
+		}
+	})
 
 	// Set up HTTP routes
 	mux := http.NewServeMux()
 	mux.HandleFunc("/oauth/start", oauthHandler.StartOAuth)
 	mux.HandleFunc("/oauth/callback", oauthHandler.OAuthCallback)
 
+	// Receive events, slash commands and interactions over HTTP where Socket Mode isn't an option
+	if config.AppConfig.SigningSecret != "" {
+		slackHandler := slackhttp.NewHandler(config.AppConfig.SigningSecret, workspaceManager.Enqueue)
+		mux.HandleFunc("/slack/events", slackHandler.Events)
+		mux.HandleFunc("/slack/commands", slackHandler.Commands)
+		mux.HandleFunc("/slack/interactivity", slackHandler.Interactivity)
+	}
+
 	// Create public landing page and installation instructions
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/html")
@@ -264,8 +441,36 @@ func main() {
 		}
 	}()
 
+	// Serve the metrics, e.g. of the dispatcher, see the middleware package,
+	// on the admin address only, they mustn't be public
+	var adminSrv *http.Server
+	if config.AppConfig.AdminAddr != "" {
+		adminMux := http.NewServeMux()
+		adminMux.Handle("/debug/vars", expvar.Handler())
+		adminSrv = &http.Server{
+			Addr:    config.AppConfig.AdminAddr,
+			Handler: adminMux,
+		}
+		go func() {
+			log.Infof("Admin server listening on %s", config.AppConfig.AdminAddr)
+			if err := adminSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Errorf("Error starting admin server: %v", err)
+			}
+		}()
+	}
+
+	// Push refreshed tokens into the running clients
+	oauth2.OnRefresh(func(creds oauth2.WorkspaceCredentials) {
+		if err := workspaceManager.AddWorkspace(creds); err != nil {
+			log.Warnf("Failed to update the token of workspace %s: %v", creds.TeamID, err)
+		}
+	})
+
+	// Stop serving workspaces that uninstalled the app
+	oauth2.OnUninstall(workspaceManager.RemoveWorkspace)
+
 	// Load all workspaces from database
-	workspaces, err := oauth2.GetAllWorkspaceCredentials()
+	workspaces, err := oauth2.GetAllWorkspaceCredentials(ctx)
 	if err != nil && err != sql.ErrNoRows {
 		log.Errorf("Error loading workspaces: %v", err)
 	}
@@ -287,13 +492,13 @@ func main() {
 		}
 
 		// Check if token needs refreshing
-		if err := oauth2.RefreshTokenIfNeeded(workspace.TeamID); err != nil {
+		if err := oauth2.RefreshTokenIfNeeded(ctx, workspace.TeamID); err != nil {
 			log.Warnf("Failed to refresh token for workspace %s: %v", workspace.TeamID, err)
 			continue
 		}
 
 		// Get refreshed credentials
-		refreshedCreds, err := oauth2.GetWorkspaceCredentials(workspace.TeamID)
+		refreshedCreds, err := oauth2.GetWorkspaceCredentials(ctx, workspace.TeamID)
 		if err != nil {
 			log.Warnf("Failed to get refreshed credentials for workspace %s: %v", workspace.TeamID, err)
 			continue
@@ -305,7 +510,7 @@ func main() {
 		} else {
 			// Get bot info to display name for inviting to channels
 			api := slack.New(refreshedCreds.AccessToken)
-			botInfo, err := api.AuthTest()
+			botInfo, err := api.AuthTestContext(ctx)
 			if err != nil {
 				log.Warnf("Failed to get bot info for workspace %s: %v", workspace.TeamID, err)
 			} else {
@@ -315,28 +520,68 @@ func main() {
 		}
 	}
 
+	// Receive the events of all workspaces over one Socket Mode connection
+	if config.AppConfig.SlackAppToken != "" {
+		go func() {
+			if err := workspaceManager.Run(ctx); err != nil {
+				log.Errorf("Socket Mode connection stopped: %v", err)
+			}
+		}()
+	}
+
 	log.Infof("Bot is running with %d workspaces...", len(workspaces))
 
-	// Register webhook handler for Slack events if needed
-	mux.HandleFunc("/slack/events", func(w http.ResponseWriter, r *http.Request) {
-		// Handle Slack events API requests
-		// This is needed if you want to use Events API instead of Socket Mode
-		w.WriteHeader(http.StatusOK)
-	})
+	// Run the scheduled work in the background
+	clients := func(teamID string) (respond.Responder, bool) {
+		wsClient, ok := workspaceManager.GetWorkspaceClient(teamID)
+		if !ok {
+			return nil, false
+		}
+		return wsClient.Outbound, true
+	}
+	if err := oauth2.RegisterRefresh(ctx); err != nil {
+		log.Errorf("Failed to schedule token refreshes: %v", err)
+	}
+	if err := oauth2.RegisterPurge(ctx, config.AppConfig.PurgeAfterDays); err != nil {
+		log.Errorf("Failed to schedule purging uninstalled workspaces: %v", err)
+	}
+	if err := notify.RegisterDigests(ctx, config.AppConfig.DigestHour, clients); err != nil {
+		log.Errorf("Failed to schedule notification digests: %v", err)
+	}
+	if err := digest.Register(ctx, clients); err != nil {
+		log.Errorf("Failed to schedule kudos digests: %v", err)
+	}
+	if err := deadletter.Register(ctx, config.AppConfig.RetryAttempts, workspaceManager.Retry); err != nil {
+		log.Errorf("Failed to schedule retrying failed requests: %v", err)
+	}
+	schedulerDone := make(chan struct{})
+	go func() {
+		schedule.Run(ctx)
+		close(schedulerDone)
+	}()
 
-	// Graceful shutdown
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	// Graceful shutdown, the signal has cancelled the Socket Mode connection,
+	// the scheduler and the running handlers and jobs
+	<-ctx.Done()
+	stop()
 
 	log.Info("Shutting down...")
 
 	// Shutdown HTTP server
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil {
+	if err := srv.Shutdown(shutdownCtx); err != nil {
 		log.Errorf("Server forced to shutdown: %v", err)
 	}
+	if adminSrv != nil {
+		if err := adminSrv.Shutdown(shutdownCtx); err != nil {
+			log.Errorf("Admin server forced to shutdown: %v", err)
+		}
+	}
+
+	// Let the cancelled handlers and jobs return
+	workspaceManager.Wait()
+	<-schedulerDone
 
 	log.Info("Server stopped")
 }
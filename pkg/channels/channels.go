@@ -0,0 +1,36 @@
+package channels
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kaplan-michael/slack-kudos/pkg/database"
+)
+
+// MarkActive remembers that the bot is a member of the channel.
+func MarkActive(ctx context.Context, teamID, channelID string) error {
+	_, err := database.DB.ExecContext(ctx, `
+		INSERT INTO active_channels (team_id, channel_id, joined_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(team_id, channel_id)
+		DO UPDATE SET joined_at = excluded.joined_at`,
+		teamID, channelID, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark channel %s as active: %w", channelID, err)
+	}
+	return nil
+}
+
+// MarkInactive forgets the channel after the bot left it.
+func MarkInactive(ctx context.Context, teamID, channelID string) error {
+	_, err := database.DB.ExecContext(ctx,
+		`DELETE FROM active_channels WHERE team_id = ? AND channel_id = ?`,
+		teamID, channelID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark channel %s as inactive: %w", channelID, err)
+	}
+	return nil
+}
@@ -4,6 +4,8 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -11,10 +13,23 @@ type Config struct {
 	SlackClientID     string
 	SlackClientSecret string
 	SlackAppToken     string // App-level token for Socket Mode
+	SigningSecret     string // Signing secret verifying requests to the HTTP endpoints
 	SlackRedirectURI  string
 	ServerPort        int
 	Debug             bool
 	BaseURL           string // Base URL where the application is running
+	AnonSecret        string // Secret used to encrypt the givers of anonymous kudos
+	DigestHour        int    // Hour of the day when daily notification digests are sent
+	PurgeAfterDays    int    // Days after uninstalling when a workspace's data is deleted, 0 keeps it
+	// Deadline of a handler handling one event, command or interaction, 0 disables it
+	HandlerTimeout time.Duration
+	// Deadlines overriding HandlerTimeout by request kind: event, command or interaction
+	HandlerTimeouts map[string]time.Duration
+	RateLimit       int    // Requests of a workspace handled per minute, 0 disables the limit
+	Workers         int    // Requests handled at the same time
+	QueueSize       int    // Requests waiting for each worker before new ones are held back
+	RetryAttempts   int    // Attempts at handling a failed request before it's left to the admins
+	AdminAddr       string // Address serving the metrics, apart from the public endpoints, empty disables it
 }
 
 var AppConfig = &Config{}
@@ -22,11 +37,7 @@ var AppConfig = &Config{}
 func Init() {
 	var missingVars []string
 
-	// Database config
-	AppConfig.SQLiteFilename = os.Getenv("KUDOS_SQLITE_FILENAME")
-	if AppConfig.SQLiteFilename == "" {
-		AppConfig.SQLiteFilename = "kudos.db"
-	}
+	InitDatabase()
 
 	// OAuth2 configuration (required)
 	AppConfig.SlackClientID = os.Getenv("KUDOS_SLACK_CLIENT_ID")
@@ -39,10 +50,12 @@ func Init() {
 		missingVars = append(missingVars, "KUDOS_SLACK_CLIENT_SECRET")
 	}
 
-	// App-level token for Socket Mode
+	// App-level token for Socket Mode and signing secret for the HTTP
+	// Events API, at least one of them is needed to receive events
 	AppConfig.SlackAppToken = os.Getenv("KUDOS_SLACK_APP_TOKEN")
-	if AppConfig.SlackAppToken == "" {
-		missingVars = append(missingVars, "KUDOS_SLACK_APP_TOKEN")
+	AppConfig.SigningSecret = os.Getenv("KUDOS_SLACK_SIGNING_SECRET")
+	if AppConfig.SlackAppToken == "" && AppConfig.SigningSecret == "" {
+		missingVars = append(missingVars, "KUDOS_SLACK_APP_TOKEN or KUDOS_SLACK_SIGNING_SECRET")
 	}
 
 	// Base URL where the application is running
@@ -72,6 +85,117 @@ func Init() {
 		}
 	}
 
+	// Secret for anonymous kudos, it's kept apart from the client secret so
+	// that rotating that one doesn't make the stored givers unreadable
+	AppConfig.AnonSecret = os.Getenv("KUDOS_ANON_SECRET")
+	if AppConfig.AnonSecret == "" {
+		missingVars = append(missingVars, "KUDOS_ANON_SECRET")
+	}
+
+	// Hour of the day (server time) for daily notification digests
+	digestHourStr := os.Getenv("KUDOS_DIGEST_HOUR")
+	if digestHourStr == "" {
+		AppConfig.DigestHour = 9
+	} else {
+		hour, err := strconv.Atoi(digestHourStr)
+		if err != nil || hour < 0 || hour > 23 {
+			log.Printf("Invalid digest hour %s, using default 9", digestHourStr)
+			AppConfig.DigestHour = 9
+		} else {
+			AppConfig.DigestHour = hour
+		}
+	}
+
+	// Data of uninstalled workspaces is kept unless a grace period is set
+	purgeStr := os.Getenv("KUDOS_PURGE_AFTER_DAYS")
+	if purgeStr != "" {
+		days, err := strconv.Atoi(purgeStr)
+		if err != nil || days < 0 {
+			log.Printf("Invalid purge grace period %s, keeping the data of uninstalled workspaces", purgeStr)
+		} else {
+			AppConfig.PurgeAfterDays = days
+		}
+	}
+
+	// Handlers are cancelled when they don't finish in time
+	AppConfig.HandlerTimeout = 30 * time.Second
+	timeoutStr := os.Getenv("KUDOS_HANDLER_TIMEOUT")
+	if timeoutStr != "" {
+		timeout, err := time.ParseDuration(timeoutStr)
+		if err != nil || timeout < 0 {
+			log.Printf("Invalid handler timeout %s, using default 30s", timeoutStr)
+		} else {
+			AppConfig.HandlerTimeout = timeout
+		}
+	}
+
+	// Per kind deadlines, e.g. "command=10s,interaction=5s"
+	AppConfig.HandlerTimeouts = map[string]time.Duration{}
+	for _, entry := range strings.Split(os.Getenv("KUDOS_HANDLER_TIMEOUTS"), ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		kind, value, _ := strings.Cut(entry, "=")
+		timeout, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || timeout < 0 {
+			log.Printf("Invalid handler timeout %s, using the default", entry)
+			continue
+		}
+		AppConfig.HandlerTimeouts[strings.TrimSpace(kind)] = timeout
+	}
+
+	// Busy workspaces are only limited when a rate limit is set
+	rateLimitStr := os.Getenv("KUDOS_RATE_LIMIT")
+	if rateLimitStr != "" {
+		limit, err := strconv.Atoi(rateLimitStr)
+		if err != nil || limit < 0 {
+			log.Printf("Invalid rate limit %s, not limiting workspaces", rateLimitStr)
+		} else {
+			AppConfig.RateLimit = limit
+		}
+	}
+
+	// Requests are handled by a pool of workers with bounded queues
+	AppConfig.Workers = 8
+	workersStr := os.Getenv("KUDOS_WORKERS")
+	if workersStr != "" {
+		workers, err := strconv.Atoi(workersStr)
+		if err != nil || workers < 1 {
+			log.Printf("Invalid number of workers %s, using default 8", workersStr)
+		} else {
+			AppConfig.Workers = workers
+		}
+	}
+
+	AppConfig.QueueSize = 100
+	queueSizeStr := os.Getenv("KUDOS_QUEUE_SIZE")
+	if queueSizeStr != "" {
+		size, err := strconv.Atoi(queueSizeStr)
+		if err != nil || size < 0 {
+			log.Printf("Invalid queue size %s, using default 100", queueSizeStr)
+		} else {
+			AppConfig.QueueSize = size
+		}
+	}
+
+	// Failed requests are retried from the dead-letter store
+	AppConfig.RetryAttempts = 8
+	retryAttemptsStr := os.Getenv("KUDOS_RETRY_ATTEMPTS")
+	if retryAttemptsStr != "" {
+		attempts, err := strconv.Atoi(retryAttemptsStr)
+		if err != nil || attempts < 1 {
+			log.Printf("Invalid number of retry attempts %s, using default 8", retryAttemptsStr)
+		} else {
+			AppConfig.RetryAttempts = attempts
+		}
+	}
+
+	// Metrics are only served on a private address, set it empty to disable them
+	AppConfig.AdminAddr = "localhost:9090"
+	if adminAddr, ok := os.LookupEnv("KUDOS_ADMIN_ADDR"); ok {
+		AppConfig.AdminAddr = adminAddr
+	}
+
 	// Debug mode
 	debugEnv := os.Getenv("KUDOS_DEBUG")
 	AppConfig.Debug = debugEnv == "true" || debugEnv == "1" || debugEnv == "yes"
@@ -80,3 +204,12 @@ func Init() {
 		log.Fatalf("Missing required environment variables: %v", missingVars)
 	}
 }
+
+// InitDatabase reads only the database configuration, for tools that
+// don't talk to Slack.
+func InitDatabase() {
+	AppConfig.SQLiteFilename = os.Getenv("KUDOS_SQLITE_FILENAME")
+	if AppConfig.SQLiteFilename == "" {
+		AppConfig.SQLiteFilename = "kudos.db"
+	}
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
@@ -87,6 +88,227 @@ var Migrations = []Migration{
 		PRAGMA foreign_keys = ON;
 		`,
 	},
+	{
+		Version:     5,
+		Description: "Add workspace_settings and kudos_log tables",
+		SQL: `
+		CREATE TABLE IF NOT EXISTS workspace_settings (
+			team_id TEXT NOT NULL,
+			key TEXT NOT NULL,
+			value TEXT NOT NULL,
+			updated_at TIMESTAMP NOT NULL,
+			PRIMARY KEY(team_id, key),
+			FOREIGN KEY(team_id) REFERENCES workspaces(team_id)
+		);
+
+		CREATE TABLE IF NOT EXISTS kudos_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			team_id TEXT NOT NULL,
+			giver_id TEXT NOT NULL,
+			recipient_id TEXT NOT NULL,
+			channel_id TEXT NOT NULL,
+			message_ts TEXT NOT NULL,
+			amount INTEGER NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP NOT NULL,
+			revoked_at TIMESTAMP,
+			FOREIGN KEY(team_id) REFERENCES workspaces(team_id)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_kudos_log_team_created ON kudos_log(team_id, created_at);
+		`,
+	},
+	{
+		Version:     6,
+		Description: "Add anonymous kudos columns to kudos_log",
+		SQL: `
+		ALTER TABLE kudos_log ADD COLUMN anonymous INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE kudos_log ADD COLUMN giver_secret TEXT NOT NULL DEFAULT '';
+		`,
+	},
+	{
+		Version:     7,
+		Description: "Add badges and user_badges tables",
+		SQL: `
+		CREATE TABLE IF NOT EXISTS badges (
+			team_id TEXT NOT NULL,
+			threshold INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			emoji TEXT NOT NULL,
+			PRIMARY KEY(team_id, threshold),
+			FOREIGN KEY(team_id) REFERENCES workspaces(team_id)
+		);
+
+		CREATE TABLE IF NOT EXISTS user_badges (
+			team_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			threshold INTEGER NOT NULL,
+			awarded_at TIMESTAMP NOT NULL,
+			PRIMARY KEY(team_id, user_id, threshold),
+			FOREIGN KEY(team_id) REFERENCES workspaces(team_id)
+		);
+		`,
+	},
+	{
+		Version:     8,
+		Description: "Add message_templates table",
+		SQL: `
+		CREATE TABLE IF NOT EXISTS message_templates (
+			team_id TEXT NOT NULL,
+			locale TEXT NOT NULL,
+			name TEXT NOT NULL,
+			body TEXT NOT NULL,
+			updated_at TIMESTAMP NOT NULL,
+			PRIMARY KEY(team_id, locale, name),
+			FOREIGN KEY(team_id) REFERENCES workspaces(team_id)
+		);
+		`,
+	},
+	{
+		Version:     9,
+		Description: "Add channel_settings table",
+		SQL: `
+		CREATE TABLE IF NOT EXISTS channel_settings (
+			team_id TEXT NOT NULL,
+			channel_id TEXT NOT NULL,
+			key TEXT NOT NULL,
+			value TEXT NOT NULL,
+			updated_at TIMESTAMP NOT NULL,
+			PRIMARY KEY(team_id, channel_id, key),
+			FOREIGN KEY(team_id) REFERENCES workspaces(team_id)
+		);
+		`,
+	},
+	{
+		Version:     10,
+		Description: "Add user_settings and pending_notifications tables",
+		SQL: `
+		CREATE TABLE IF NOT EXISTS user_settings (
+			team_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			key TEXT NOT NULL,
+			value TEXT NOT NULL,
+			updated_at TIMESTAMP NOT NULL,
+			PRIMARY KEY(team_id, user_id, key),
+			FOREIGN KEY(team_id) REFERENCES workspaces(team_id)
+		);
+		CREATE TABLE IF NOT EXISTS pending_notifications (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			team_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			kudos_id INTEGER NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			FOREIGN KEY(team_id) REFERENCES workspaces(team_id),
+			FOREIGN KEY(kudos_id) REFERENCES kudos_log(id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_pending_notifications_team ON pending_notifications(team_id, user_id);
+		`,
+	},
+	{
+		Version:     11,
+		Description: "Add active_channels table",
+		SQL: `
+		CREATE TABLE IF NOT EXISTS active_channels (
+			team_id TEXT NOT NULL,
+			channel_id TEXT NOT NULL,
+			joined_at TIMESTAMP NOT NULL,
+			PRIMARY KEY(team_id, channel_id),
+			FOREIGN KEY(team_id) REFERENCES workspaces(team_id)
+		);
+		`,
+	},
+	{
+		Version:     12,
+		Description: "Count reactions to kudos messages",
+		SQL: `
+		ALTER TABLE kudos_log ADD COLUMN reactions INTEGER NOT NULL DEFAULT 0;
+		CREATE INDEX IF NOT EXISTS idx_kudos_log_message ON kudos_log(team_id, channel_id, message_ts);
+		`,
+	},
+	{
+		Version:     13,
+		Description: "Add jobs table",
+		SQL: `
+		CREATE TABLE IF NOT EXISTS jobs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			team_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			schedule TEXT NOT NULL,
+			timezone TEXT NOT NULL,
+			catch_up TEXT NOT NULL,
+			next_run INTEGER NOT NULL,
+			last_run INTEGER,
+			last_error TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP NOT NULL,
+			UNIQUE(team_id, name)
+		);
+		CREATE INDEX IF NOT EXISTS idx_jobs_next_run ON jobs(next_run);
+		`,
+	},
+	{
+		Version:     14,
+		Description: "Mark uninstalled workspaces",
+		SQL: `
+		ALTER TABLE workspaces ADD COLUMN uninstalled_at TIMESTAMP;
+		`,
+	},
+	{
+		Version:     15,
+		Description: "Add dead_letters table",
+		SQL: `
+		CREATE TABLE IF NOT EXISTS dead_letters (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			team_id TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			sealed BOOLEAN NOT NULL DEFAULT 0,
+			error TEXT NOT NULL,
+			attempts INTEGER NOT NULL,
+			next_attempt INTEGER NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_dead_letters_next_attempt ON dead_letters(next_attempt);
+		`,
+	},
+	{
+		Version:     16,
+		Description: "Give the kudos of a message, workflow step or anonymous DM once",
+		SQL: `
+		ALTER TABLE kudos_log ADD COLUMN source_id TEXT NOT NULL DEFAULT '';
+
+		-- Duplicates, e.g. of events Slack delivered twice, keep their kudos
+		-- but aren't tied to the message anymore
+		UPDATE kudos_log SET message_ts = ''
+		WHERE message_ts != '' AND id NOT IN (
+			SELECT MIN(id) FROM kudos_log
+			WHERE message_ts != ''
+			GROUP BY team_id, channel_id, message_ts, recipient_id
+		);
+
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_kudos_log_message_recipient
+			ON kudos_log(team_id, channel_id, message_ts, recipient_id) WHERE message_ts != '';
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_kudos_log_source_recipient
+			ON kudos_log(team_id, source_id, recipient_id) WHERE source_id != '';
+		`,
+	},
+	{
+		Version:     17,
+		Description: "Record the delivery of kudos, so that a retry only redoes what failed",
+		SQL: `
+		CREATE TABLE IF NOT EXISTS kudos_deliveries (
+			team_id TEXT NOT NULL,
+			kudos_id INTEGER NOT NULL,
+			step TEXT NOT NULL,
+			delivered_at TIMESTAMP NOT NULL,
+			PRIMARY KEY(kudos_id, step),
+			FOREIGN KEY(team_id) REFERENCES workspaces(team_id)
+		);
+
+		-- The badges a kudos earned, to celebrate them on a retry
+		ALTER TABLE user_badges ADD COLUMN kudos_id INTEGER NOT NULL DEFAULT 0;
+		`,
+	},
 }
 
 // InitDB initializes the SQLite database.
@@ -196,3 +418,39 @@ func runMigrations() error {
 
 	return nil
 }
+
+// workspaceTables are the tables holding a workspace's data, in the order
+// they can be deleted without violating foreign keys.
+var workspaceTables = []string{
+	"pending_notifications",
+	"kudos_deliveries",
+	"user_badges",
+	"badges",
+	"kudos_log",
+	"workspace_kudos",
+	"workspace_settings",
+	"channel_settings",
+	"user_settings",
+	"message_templates",
+	"active_channels",
+	"jobs",
+	"dead_letters",
+	"workspaces",
+}
+
+// PurgeWorkspace deletes all data of a workspace.
+func PurgeWorkspace(ctx context.Context, teamID string) error {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, table := range workspaceTables {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE team_id = ?", teamID); err != nil {
+			return fmt.Errorf("failed to purge %s: %w", table, err)
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,325 @@
+// Package deadletter keeps the requests whose handler failed, e.g. because
+// the database was locked or Slack had an outage, so that they aren't lost.
+// They are retried with exponential backoff until they succeed or run out
+// of attempts, then they wait for an admin to replay or discard them.
+package deadletter
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/kaplan-michael/slack-kudos/pkg/database"
+	"github.com/kaplan-michael/slack-kudos/pkg/handler"
+	"github.com/kaplan-michael/slack-kudos/pkg/kudos"
+	"github.com/kaplan-michael/slack-kudos/pkg/schedule"
+	"github.com/mattn/go-sqlite3"
+	"github.com/slack-go/slack"
+)
+
+// RetryJobName is the name of the scheduled job that retries failed requests.
+const RetryJobName = "retry_dead_letters"
+
+// Delays between the attempts, the delay doubles after every attempt.
+const (
+	firstDelay = time.Minute
+	maxDelay   = 6 * time.Hour
+)
+
+// responseURLLifetime is how long the response URL of a slash command or
+// an interaction works. Handling them later can't answer the user anymore.
+const responseURLLifetime = 30 * time.Minute
+
+// ErrNotFound is returned when a dead letter doesn't exist.
+var ErrNotFound = errors.New("dead letter not found")
+
+// Letter is a request whose handler failed.
+type Letter struct {
+	ID      int64
+	TeamID  string
+	Kind    handler.Kind
+	Payload []byte
+	// Sealed is whether the payload is encrypted, see handler.Request.Private
+	Sealed bool
+	// Error is the error of the last attempt
+	Error    string
+	Attempts int
+	// NextAttempt is when the request is retried, zero when it ran out of attempts
+	NextAttempt time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Request decodes the letter's request.
+func (l Letter) Request() (handler.Request, error) {
+	payload := l.Payload
+	if l.Sealed {
+		var err error
+		if payload, err = kudos.Open(string(l.Payload)); err != nil {
+			return handler.Request{}, fmt.Errorf("failed to open sealed payload: %w", err)
+		}
+	}
+
+	req, err := handler.Unmarshal(l.Kind, payload)
+	if err != nil {
+		return req, err
+	}
+	req.Retry = l.Attempts
+	return req, nil
+}
+
+// Retryable reports whether a request that failed with err may succeed when
+// it's handled again later, e.g. because the database was locked, Slack had
+// an outage or the handler was cancelled by a shutdown. Errors caused by the
+// request itself, e.g. a panic, aren't.
+func Retryable(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return true
+	}
+
+	var retryable interface{ Retryable() bool }
+	if errors.As(err, &retryable) && retryable.Retryable() {
+		return true
+	}
+
+	var slackErr slack.SlackErrorResponse
+	if errors.As(err, &slackErr) {
+		switch slackErr.Err {
+		case "ratelimited", "internal_error", "fatal_error", "service_unavailable", "request_timeout":
+			return true
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	return false
+}
+
+// Save stores a request that failed for the first time with a retryable
+// error, see Retryable. It's retried unless maxAttempts is 1. The payload
+// of a private request is sealed, it could give away the giver of an
+// anonymous kudos.
+func Save(ctx context.Context, req handler.Request, reqErr error, maxAttempts int) error {
+	raw, err := req.Marshal()
+	if err != nil {
+		return err
+	}
+
+	payload, sealed := string(raw), req.Private()
+	if sealed {
+		if payload, err = kudos.Seal(raw); err != nil {
+			return fmt.Errorf("failed to seal failed %s request: %w", req.Kind, err)
+		}
+	}
+
+	now := time.Now()
+	_, err = database.DB.ExecContext(ctx, `
+		INSERT INTO dead_letters (team_id, kind, payload, sealed, error, attempts, next_attempt, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, 1, ?, ?, ?)`,
+		req.TeamID, string(req.Kind), payload, sealed, reqErr.Error(),
+		unix(nextAttempt(1, maxAttempts, now)), now, now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save failed %s request: %w", req.Kind, err)
+	}
+	return nil
+}
+
+// Register schedules retrying the failed requests with dispatch, which
+// handles a request and returns its error. A request is given up after
+// maxAttempts attempts, including the first one.
+func Register(ctx context.Context, maxAttempts int, dispatch func(req handler.Request) error) error {
+	schedule.Register(RetryJobName, func(ctx context.Context, job schedule.Job) error {
+		return retryDue(ctx, time.Now(), maxAttempts, dispatch)
+	})
+
+	return schedule.Ensure(ctx, "", RetryJobName, "* * * * *", "Local", schedule.CatchUpSkip)
+}
+
+// retryDue retries every request whose next attempt is due, one at a time.
+func retryDue(ctx context.Context, now time.Time, maxAttempts int, dispatch func(req handler.Request) error) error {
+	letters, err := list(ctx, `WHERE next_attempt > 0 AND next_attempt <= ? ORDER BY next_attempt`, unix(now))
+	if err != nil {
+		return err
+	}
+
+	for _, letter := range letters {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if letter.Kind != handler.KindEvent && now.Sub(letter.CreatedAt) > responseURLLifetime {
+			log.Warnf("Dropping %s request %d of workspace %s, its response URL expired", letter.Kind, letter.ID, letter.TeamID)
+			if err := Discard(ctx, letter.ID); err != nil {
+				log.Warnf("Failed to remove expired dead letter %d: %v", letter.ID, err)
+			}
+			continue
+		}
+
+		claimed, err := claim(ctx, letter, maxAttempts, now)
+		if err != nil {
+			log.Warnf("Failed to claim dead letter %d: %v", letter.ID, err)
+			continue
+		}
+		// Another process is already retrying it
+		if !claimed {
+			continue
+		}
+
+		req, err := letter.Request()
+		if err == nil {
+			err = dispatch(req)
+		}
+		if err == nil {
+			log.Infof("Retried %s request %d of workspace %s", letter.Kind, letter.ID, letter.TeamID)
+			if err := Discard(context.Background(), letter.ID); err != nil {
+				log.Warnf("Failed to remove retried dead letter %d: %v", letter.ID, err)
+			}
+			continue
+		}
+
+		giveUp := !Retryable(err)
+		if giveUp || letter.Attempts+1 >= maxAttempts {
+			log.Errorf("Giving up %s request %d of workspace %s after %d attempts: %v", letter.Kind, letter.ID, letter.TeamID, letter.Attempts+1, err)
+		}
+		recordError(letter, err, giveUp)
+	}
+	return nil
+}
+
+// claim counts the attempt and schedules the next one, only if nobody else
+// did since the letter was loaded. Scheduling before retrying makes sure an
+// attempt interrupted by a crash is retried too.
+func claim(ctx context.Context, letter Letter, maxAttempts int, now time.Time) (bool, error) {
+	attempts := letter.Attempts + 1
+	result, err := database.DB.ExecContext(ctx, `
+		UPDATE dead_letters SET attempts = ?, next_attempt = ?, updated_at = ?
+		WHERE id = ? AND next_attempt = ?`,
+		attempts, unix(nextAttempt(attempts, maxAttempts, now)), now,
+		letter.ID, unix(letter.NextAttempt),
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// recordError stores the error of the last attempt, giving up retrying
+// the request if asked to. It's stored also when the attempt was cancelled
+// by a shutdown.
+func recordError(letter Letter, reqErr error, giveUp bool) {
+	query := `UPDATE dead_letters SET error = ? WHERE id = ?`
+	if giveUp {
+		query = `UPDATE dead_letters SET error = ?, next_attempt = 0 WHERE id = ?`
+	}
+	_, err := database.DB.ExecContext(context.Background(), query, reqErr.Error(), letter.ID)
+	if err != nil {
+		log.Warnf("Failed to record the error of dead letter %d: %v", letter.ID, err)
+	}
+}
+
+// nextAttempt returns when to retry a request after the given number of
+// attempts, the zero time when it ran out of attempts.
+func nextAttempt(attempts, maxAttempts int, now time.Time) time.Time {
+	if attempts >= maxAttempts {
+		return time.Time{}
+	}
+	delay := firstDelay
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return now.Add(delay)
+}
+
+// List returns the dead letters, of one workspace unless teamID is empty,
+// oldest first.
+func List(ctx context.Context, teamID string) ([]Letter, error) {
+	if teamID == "" {
+		return list(ctx, `ORDER BY id`)
+	}
+	return list(ctx, `WHERE team_id = ? ORDER BY id`, teamID)
+}
+
+// Replay retries a dead letter on the next run of the retry job, also when
+// it ran out of attempts. It gets one more attempt.
+func Replay(ctx context.Context, id int64) error {
+	result, err := database.DB.ExecContext(ctx, `
+		UPDATE dead_letters SET next_attempt = ?, updated_at = ?
+		WHERE id = ?`, unix(time.Now()), time.Now(), id)
+	return affected(result, err, id)
+}
+
+// Discard deletes a dead letter, its request is lost.
+func Discard(ctx context.Context, id int64) error {
+	result, err := database.DB.ExecContext(ctx, `DELETE FROM dead_letters WHERE id = ?`, id)
+	return affected(result, err, id)
+}
+
+func affected(result sql.Result, err error, id int64) error {
+	if err != nil {
+		return fmt.Errorf("failed to update dead letter %d: %w", id, err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update dead letter %d: %w", id, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %d", ErrNotFound, id)
+	}
+	return nil
+}
+
+func list(ctx context.Context, where string, args ...any) ([]Letter, error) {
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT id, team_id, kind, payload, sealed, error, attempts, next_attempt, created_at, updated_at
+		FROM dead_letters `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query dead letters: %w", err)
+	}
+	defer rows.Close()
+
+	var letters []Letter
+	for rows.Next() {
+		var letter Letter
+		var kind, payload string
+		var next int64
+		if err := rows.Scan(&letter.ID, &letter.TeamID, &kind, &payload, &letter.Sealed, &letter.Error,
+			&letter.Attempts, &next, &letter.CreatedAt, &letter.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan dead letter: %w", err)
+		}
+		letter.Kind = handler.Kind(kind)
+		letter.Payload = []byte(payload)
+		if next > 0 {
+			letter.NextAttempt = time.Unix(next, 0)
+		}
+		letters = append(letters, letter)
+	}
+	return letters, rows.Err()
+}
+
+// unix converts a time to the Unix seconds stored in the dead_letters
+// table, the zero time meaning never.
+func unix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
@@ -0,0 +1,170 @@
+package digest
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/kaplan-michael/slack-kudos/pkg/messages"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+	"github.com/kaplan-michael/slack-kudos/pkg/schedule"
+	"github.com/kaplan-michael/slack-kudos/pkg/settings"
+)
+
+// JobName is the name of the scheduled job that posts a workspace's digest.
+const JobName = "digest"
+
+// Register registers the digest job with the scheduler and keeps the jobs
+// in sync with the digest settings of every workspace.
+func Register(ctx context.Context, clients respond.ClientLookup) error {
+	schedule.Register(JobName, func(ctx context.Context, job schedule.Job) error {
+		return run(ctx, clients, job)
+	})
+
+	settings.OnChange(func(ctx context.Context, teamID, key string) {
+		switch key {
+		case settings.DigestChannel, settings.DigestSchedule, settings.Timezone:
+			if err := Sync(ctx, teamID); err != nil {
+				log.Warnf("Failed to reschedule digest of workspace %s: %v", teamID, err)
+			}
+		}
+	})
+
+	return SyncAll(ctx)
+}
+
+// SyncAll schedules the digest of every workspace with a digest channel
+// and removes the digests of the others.
+func SyncAll(ctx context.Context) error {
+	channels, err := settings.Configured(ctx, settings.DigestChannel)
+	if err != nil {
+		return fmt.Errorf("failed to get digest channels: %w", err)
+	}
+	scheduled, err := schedule.Teams(ctx, JobName)
+	if err != nil {
+		return err
+	}
+
+	for _, teamID := range scheduled {
+		if _, ok := channels[teamID]; !ok {
+			if err := schedule.Remove(ctx, teamID, JobName); err != nil {
+				log.Warnf("Failed to remove digest of workspace %s: %v", teamID, err)
+			}
+		}
+	}
+	for teamID := range channels {
+		if err := Sync(ctx, teamID); err != nil {
+			log.Warnf("Failed to schedule digest of workspace %s: %v", teamID, err)
+		}
+	}
+	return nil
+}
+
+// Sync schedules the digest of a workspace following its digest settings,
+// or removes it when the workspace has no digest channel.
+func Sync(ctx context.Context, teamID string) error {
+	channelID, err := settings.Get(ctx, teamID, settings.DigestChannel)
+	if err != nil {
+		return err
+	}
+	if channelID == "" {
+		return schedule.Remove(ctx, teamID, JobName)
+	}
+
+	expr, err := settings.Get(ctx, teamID, settings.DigestSchedule)
+	if err != nil {
+		return err
+	}
+	timezone, err := settings.Get(ctx, teamID, settings.Timezone)
+	if err != nil {
+		return err
+	}
+
+	// A digest missed while the bot was down is still worth posting, it
+	// covers everything since the previous one
+	return schedule.Ensure(ctx, teamID, JobName, expr, timezone, schedule.CatchUpOnce)
+}
+
+// run posts a workspace's digest for a scheduled run.
+func run(ctx context.Context, clients respond.ClientLookup, job schedule.Job) error {
+	channelID, err := settings.Get(ctx, job.TeamID, settings.DigestChannel)
+	if err != nil {
+		return err
+	}
+	if channelID == "" {
+		return nil
+	}
+
+	api, ok := clients(job.TeamID)
+	if !ok {
+		return fmt.Errorf("no client available for workspace %s", job.TeamID)
+	}
+
+	// The digest covers everything since the previous digest, or since the
+	// previous scheduled time for the first one
+	to := job.ScheduledAt
+	var from time.Time
+	if job.LastRun != nil {
+		from = *job.LastRun
+	} else {
+		cron, err := schedule.Parse(job.Schedule)
+		if err != nil {
+			return fmt.Errorf("invalid digest schedule %q: %w", job.Schedule, err)
+		}
+		loc, err := time.LoadLocation(job.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid timezone: %w", err)
+		}
+		from = cron.Prev(to.In(loc))
+	}
+
+	return Post(ctx, api, job.TeamID, channelID, from, to)
+}
+
+// Post posts the digest of the kudos given between from and to in a workspace.
+// Nothing is posted for a period without kudos.
+func Post(ctx context.Context, api respond.Responder, teamID, channelID string, from, to time.Time) error {
+	stats, err := collect(ctx, api, teamID, from, to)
+	if err != nil {
+		return err
+	}
+	if stats.Total == 0 {
+		log.Infof("No kudos in workspace %s since %s, skipping digest", teamID, from)
+		return nil
+	}
+
+	if s := stats.ShoutOut; s != nil && !s.Anonymous && s.MessageTS != "" {
+		s.Permalink, err = respond.Permalink(ctx, api, s.ChannelID, s.MessageTS)
+		if err != nil {
+			log.Warnf("Failed to link the digest's shout-out: %v", err)
+		}
+	}
+
+	locale, err := settings.Get(ctx, teamID, settings.Locale)
+	if err != nil || locale == "" {
+		locale = messages.DefaultLocale
+	}
+
+	msg, err := messages.Render(ctx, teamID, locale, "digest", messages.Data{
+		"From":          from,
+		"To":            to,
+		"Total":         stats.Total,
+		"Recipients":    stats.Recipients,
+		"Givers":        stats.Givers,
+		"Milestones":    stats.Milestones,
+		"Categories":    stats.Categories,
+		"Uncategorized": stats.Uncategorized,
+		"ShoutOut":      stats.ShoutOut,
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := respond.Channel(ctx, api, channelID, msg); err != nil {
+		return fmt.Errorf("failed to post digest: %w", err)
+	}
+
+	log.Infof("Posted kudos digest of workspace %s to channel %s", teamID, channelID)
+	return nil
+}
@@ -0,0 +1,248 @@
+package digest
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/kaplan-michael/slack-kudos/pkg/database"
+	"github.com/kaplan-michael/slack-kudos/pkg/kudos"
+	"github.com/kaplan-michael/slack-kudos/pkg/messages"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+	"github.com/kaplan-michael/slack-kudos/pkg/settings"
+)
+
+// topCount is the number of entries in each ranking of the digest.
+const topCount = 5
+
+// hashtagPattern matches the #categories in kudos reasons. Channel links
+// look like <#C123|name> and don't match.
+var hashtagPattern = regexp.MustCompile(`(?:^|\s)#([\p{L}\p{N}_][\p{L}\p{N}_-]*)`)
+
+// UserCount is a user with their number of kudos, given or received.
+type UserCount struct {
+	Rank   int
+	UserID string
+	Count  int
+}
+
+// Milestone is a badge earned during the period.
+type Milestone struct {
+	UserID    string
+	Threshold int
+	Name      string
+	Emoji     string
+}
+
+// Category is a hashtag used in kudos reasons with its number of kudos.
+type Category struct {
+	Name  string
+	Count int
+}
+
+// ShoutOut is the kudos with the most reactions in the period.
+type ShoutOut struct {
+	GiverID   string
+	Anonymous bool
+	UserID    string
+	Reason    messages.UserText
+	Reactions int
+	ChannelID string
+	MessageTS string
+	Permalink string
+}
+
+// Stats summarize the kudos given in a workspace during a period.
+type Stats struct {
+	Total         int
+	Recipients    []UserCount
+	Givers        []UserCount
+	Milestones    []Milestone
+	Categories    []Category
+	Uncategorized int
+	ShoutOut      *ShoutOut
+}
+
+// collect gathers the stats of the kudos given between from and to.
+// Revoked kudos and kudos taken away don't count. Kudos given in private
+// channels and DMs only count towards the total and the rankings, unless
+// the workspace opted in, their reasons stay out of the shout-out and the
+// categories.
+func collect(ctx context.Context, api respond.Responder, teamID string, from, to time.Time) (Stats, error) {
+	var stats Stats
+
+	showPrivate, err := settings.GetBool(ctx, teamID, settings.DigestPrivate)
+	if err != nil {
+		return stats, fmt.Errorf("failed to get digest privacy setting: %w", err)
+	}
+
+	// Timestamps are stored in the server's timezone
+	from, to = from.In(time.Local), to.In(time.Local)
+
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT giver_id, recipient_id, anonymous, reason, reactions, channel_id, message_ts
+		FROM kudos_log
+		WHERE team_id = ? AND amount > 0 AND revoked_at IS NULL
+		  AND created_at >= ? AND created_at < ?
+		ORDER BY created_at`, teamID, from, to)
+	if err != nil {
+		return stats, fmt.Errorf("failed to query kudos: %w", err)
+	}
+
+	var given []ShoutOut
+	for rows.Next() {
+		var k ShoutOut
+		if err := rows.Scan(&k.GiverID, &k.UserID, &k.Anonymous, &k.Reason, &k.Reactions, &k.ChannelID, &k.MessageTS); err != nil {
+			rows.Close()
+			return stats, fmt.Errorf("failed to scan kudos: %w", err)
+		}
+		given = append(given, k)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return stats, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	// Look up the channels once the rows are closed, each only once
+	private := map[string]bool{}
+	isPrivate := func(channelID string) bool {
+		if showPrivate || channelID == "" {
+			return false
+		}
+		if p, ok := private[channelID]; ok {
+			return p
+		}
+		p, err := respond.IsPrivate(ctx, api, channelID)
+		if err != nil {
+			// Better left out than leaked
+			log.FromContext(ctx).Warnf("Leaving the kudos of channel %s out of the digest: %v", channelID, err)
+			p = true
+		}
+		private[channelID] = p
+		return p
+	}
+
+	received := map[string]int{}
+	givers := map[string]int{}
+	categories := map[string]int{}
+	for _, k := range given {
+		stats.Total++
+		received[k.UserID]++
+		// Anonymous kudos and kudos from workflows have no giver to rank
+		if !k.Anonymous && k.GiverID != "" {
+			givers[k.GiverID]++
+		}
+
+		if isPrivate(k.ChannelID) {
+			continue
+		}
+
+		tags := hashtags(string(k.Reason))
+		if len(tags) == 0 {
+			stats.Uncategorized++
+		}
+		for _, tag := range tags {
+			categories[tag]++
+		}
+
+		if k.Reactions > 0 && (stats.ShoutOut == nil || k.Reactions > stats.ShoutOut.Reactions) {
+			shoutOut := k
+			stats.ShoutOut = &shoutOut
+		}
+	}
+
+	stats.Recipients = ranking(received)
+	stats.Givers = ranking(givers)
+
+	for name, count := range categories {
+		stats.Categories = append(stats.Categories, Category{Name: name, Count: count})
+	}
+	sort.Slice(stats.Categories, func(i, j int) bool {
+		a, b := stats.Categories[i], stats.Categories[j]
+		return a.Count > b.Count || (a.Count == b.Count && a.Name < b.Name)
+	})
+	if len(stats.Categories) > topCount {
+		stats.Categories = stats.Categories[:topCount]
+	}
+
+	stats.Milestones, err = milestones(ctx, teamID, from, to)
+	if err != nil {
+		return stats, err
+	}
+
+	return stats, nil
+}
+
+// milestones returns the badges earned between from and to.
+func milestones(ctx context.Context, teamID string, from, to time.Time) ([]Milestone, error) {
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT user_id, threshold
+		FROM user_badges
+		WHERE team_id = ? AND awarded_at >= ? AND awarded_at < ?
+		ORDER BY awarded_at`, teamID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query badges: %w", err)
+	}
+
+	var earned []Milestone
+	for rows.Next() {
+		var m Milestone
+		if err := rows.Scan(&m.UserID, &m.Threshold); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan badge: %w", err)
+		}
+		earned = append(earned, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	// Resolve the badge names once the rows are closed
+	for i, m := range earned {
+		badge, err := kudos.GetBadge(ctx, teamID, m.Threshold)
+		if err != nil {
+			return nil, err
+		}
+		earned[i].Name = badge.Name
+		earned[i].Emoji = badge.Emoji
+	}
+	return earned, nil
+}
+
+// ranking sorts users by their count and returns the top ones.
+func ranking(counts map[string]int) []UserCount {
+	users := make([]UserCount, 0, len(counts))
+	for userID, count := range counts {
+		users = append(users, UserCount{UserID: userID, Count: count})
+	}
+	sort.Slice(users, func(i, j int) bool {
+		a, b := users[i], users[j]
+		return a.Count > b.Count || (a.Count == b.Count && a.UserID < b.UserID)
+	})
+	if len(users) > topCount {
+		users = users[:topCount]
+	}
+	for i := range users {
+		users[i].Rank = i + 1
+	}
+	return users
+}
+
+// hashtags returns the distinct lowercased #categories in a reason.
+func hashtags(reason string) []string {
+	var tags []string
+	seen := map[string]bool{}
+	for _, match := range hashtagPattern.FindAllStringSubmatch(reason, -1) {
+		tag := strings.ToLower(match[1])
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
@@ -0,0 +1,88 @@
+package digest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kaplan-michael/slack-kudos/pkg/handler/handlertest"
+	"github.com/kaplan-michael/slack-kudos/pkg/kudos"
+	"github.com/kaplan-michael/slack-kudos/pkg/settings"
+	"github.com/slack-go/slack"
+)
+
+func TestCollectPrivate(t *testing.T) {
+	tests := []struct {
+		name        string
+		showPrivate bool
+		// shoutOut is the channel of the shout-out
+		shoutOut   string
+		categories []string
+	}{
+		{name: "hidden", shoutOut: "C1", categories: []string{"teamwork"}},
+		{name: "opted in", showPrivate: true, shoutOut: "DU2", categories: []string{"secret", "teamwork"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			client := handlertest.Setup(t, "T1")
+			private := &slack.Channel{}
+			private.ID, private.IsPrivate = "G1", true
+			client.Channels["G1"] = private
+			if tt.showPrivate {
+				if err := settings.Set(ctx, "T1", settings.DigestPrivate, "true"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// The kudos in the private channel and the DM got the most reactions
+			given := []struct {
+				channelID, reason string
+				reactions         int
+			}{
+				{"C1", "for the #teamwork", 1},
+				{"G1", "for the #secret project", 3},
+				{"DU2", "for the #secret talk", 5},
+			}
+			from := time.Now().Add(-time.Hour)
+			for i, g := range given {
+				ts := fmt.Sprintf("1700000000.%06d", i)
+				_, err := kudos.Give(ctx, kudos.Kudos{
+					TeamID: "T1", GiverID: "U1", RecipientID: "U2",
+					ChannelID: g.channelID, MessageTS: ts, Amount: 1, Reason: g.reason,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := kudos.AddReactions(ctx, "T1", g.channelID, ts, g.reactions); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			stats, err := collect(ctx, client, "T1", from, time.Now().Add(time.Hour))
+			if err != nil {
+				t.Fatalf("collect() error = %v", err)
+			}
+			if stats.Total != 3 {
+				t.Errorf("Total = %d, want 3", stats.Total)
+			}
+			if stats.ShoutOut == nil || stats.ShoutOut.ChannelID != tt.shoutOut {
+				t.Errorf("ShoutOut = %+v, want the kudos in %s", stats.ShoutOut, tt.shoutOut)
+			}
+			var categories []string
+			for _, c := range stats.Categories {
+				categories = append(categories, c.Name)
+			}
+			if len(categories) != len(tt.categories) {
+				t.Fatalf("Categories = %v, want %v", categories, tt.categories)
+			}
+			for i := range categories {
+				if categories[i] != tt.categories[i] {
+					t.Errorf("Categories = %v, want %v", categories, tt.categories)
+				}
+			}
+		})
+	}
+}
@@ -1,32 +1,102 @@
 package dispatcher
 
 import (
+	"context"
+	"time"
+
 	"github.com/kaplan-michael/slack-kudos/pkg/dispatcher/eventsapievent"
+	"github.com/kaplan-michael/slack-kudos/pkg/dispatcher/functionevent"
+	"github.com/kaplan-michael/slack-kudos/pkg/dispatcher/interactionevent"
 	"github.com/kaplan-michael/slack-kudos/pkg/dispatcher/slashcommandevent"
-	"github.com/slack-go/slack/socketmode"
+	"github.com/kaplan-michael/slack-kudos/pkg/handler"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
 )
 
+// Timeouts are the deadlines of the handlers, a handler's context is
+// cancelled when it runs longer.
+type Timeouts struct {
+	// Default applies to the kinds without their own deadline, 0 disables it
+	Default time.Duration
+	// Kinds are the deadlines by request kind
+	Kinds map[handler.Kind]time.Duration
+}
+
+// For returns the deadline of the handlers of a request kind.
+func (t Timeouts) For(kind handler.Kind) time.Duration {
+	if timeout, ok := t.Kinds[kind]; ok {
+		return timeout
+	}
+	return t.Default
+}
+
+// HandlerFunc handles a request with the API client of its workspace.
+type HandlerFunc func(ctx context.Context, req handler.Request, api respond.Responder) error
+
+// Middleware wraps the handling of every request, e.g. to log it or to
+// drop it before it reaches the handlers. It calls next to continue.
+type Middleware func(next HandlerFunc) HandlerFunc
+
 type Dispatcher struct {
+	timeouts                    Timeouts
+	middlewares                 []Middleware
+	handle                      HandlerFunc
 	eventAPIEventDispatcher     *eventsapievent.Dispatcher
 	slashCommandEventDispatcher *slashcommandevent.Dispatcher
+	interactionEventDispatcher  *interactionevent.Dispatcher
+	functionEventDispatcher     *functionevent.Dispatcher
 }
 
-func NewDispatcher() *Dispatcher {
-	return &Dispatcher{
+func NewDispatcher(timeouts Timeouts) *Dispatcher {
+	d := &Dispatcher{
+		timeouts:                    timeouts,
 		eventAPIEventDispatcher:     eventsapievent.NewDispatcher(),
 		slashCommandEventDispatcher: slashcommandevent.NewDispatcher(),
+		interactionEventDispatcher:  interactionevent.NewDispatcher(),
+		functionEventDispatcher:     functionevent.NewDispatcher(),
 	}
+	d.handle = d.route
+	return d
+}
+
+// Use appends middlewares to the chain wrapped around every request. The
+// first middleware is the outermost one, it sees the request first and the
+// result last. Middlewares are added before requests are dispatched.
+func (d *Dispatcher) Use(middlewares ...Middleware) {
+	d.middlewares = append(d.middlewares, middlewares...)
+
+	d.handle = d.route
+	for i := len(d.middlewares) - 1; i >= 0; i-- {
+		d.handle = d.middlewares[i](d.handle)
+	}
+}
+
+// Dispatch handles a request with the API client of the workspace it came
+// from. Requests are acknowledged by the transport they arrived over,
+// Socket Mode or HTTP, before they are dispatched. The handler's context is
+// cancelled when ctx is, or when the handler runs past its deadline.
+func (d *Dispatcher) Dispatch(ctx context.Context, req handler.Request, api respond.Responder) error {
+	if timeout := d.timeouts.For(req.Kind); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	return d.handle(ctx, req, api)
 }
 
-func (d *Dispatcher) Dispatch(evt *socketmode.Event, client *socketmode.Client) error {
-	//dispatch the event
-	switch evt.Type {
-	case socketmode.EventTypeEventsAPI:
-		client.Ack(*evt.Request)
-		return d.eventAPIEventDispatcher.Dispatch(evt, client)
-	case socketmode.EventTypeSlashCommand:
-		client.Ack(*evt.Request)
-		return d.slashCommandEventDispatcher.Dispatch(evt, client)
+// route passes a request to the dispatcher of its kind.
+func (d *Dispatcher) route(ctx context.Context, req handler.Request, api respond.Responder) error {
+	switch req.Kind {
+	case handler.KindEvent:
+		// Custom workflow steps arrive as Events API events too
+		if d.functionEventDispatcher.Matches(req.Event) {
+			return d.functionEventDispatcher.Dispatch(ctx, req.Event, api)
+		}
+		return d.eventAPIEventDispatcher.Dispatch(ctx, req.Event, api)
+	case handler.KindCommand:
+		return d.slashCommandEventDispatcher.Dispatch(ctx, req.Command, api)
+	case handler.KindInteraction:
+		return d.interactionEventDispatcher.Dispatch(ctx, req.Interaction, api)
 	}
 	return nil
 }
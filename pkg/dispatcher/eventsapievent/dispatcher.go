@@ -1,37 +1,83 @@
 package eventsapievent
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"sort"
 
+	"github.com/kaplan-michael/slack-kudos/pkg/handler/commands"
 	"github.com/kaplan-michael/slack-kudos/pkg/handler/events"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
 	"github.com/slack-go/slack/slackevents"
-	"github.com/slack-go/slack/socketmode"
 )
 
 type Dispatcher struct {
-	handlers []events.MessageHandler
+	handlers []messageHandler
+}
+
+// messageHandler is a registered message handler.
+type messageHandler struct {
+	priority int
+	handler  events.MessageHandler
 }
 
 // NewDispatcher constructs a new Events API event dispatcher.
 func NewDispatcher() *Dispatcher {
-	return &Dispatcher{
-		handlers: []events.MessageHandler{
-			events.NewKudosHandler(),
-		},
-	}
+	d := &Dispatcher{}
+	d.Register(events.PriorityAnon, events.NewAnonHandler())
+	d.Register(events.PriorityKudos, events.NewKudosHandler())
+	return d
 }
 
-func (d *Dispatcher) Dispatch(evt *socketmode.Event, client *socketmode.Client) error {
-	eventsAPIEvent, ok := evt.Data.(slackevents.EventsAPIEvent)
-	if !ok {
-		return fmt.Errorf("unexpected event type: %s", evt.Type)
-	}
-	if messageEvent, ok := eventsAPIEvent.InnerEvent.Data.(*slackevents.MessageEvent); ok {
-		for _, handler := range d.handlers {
-			if handler.Matches(messageEvent.Text) {
-				return handler.Handle(client, messageEvent)
-			}
+// Register adds a message handler. Handlers with higher priorities handle a
+// message first, handlers with the same priority in the order they were
+// registered.
+func (d *Dispatcher) Register(priority int, handler events.MessageHandler) {
+	d.handlers = append(d.handlers, messageHandler{priority: priority, handler: handler})
+	sort.SliceStable(d.handlers, func(i, j int) bool {
+		return d.handlers[i].priority > d.handlers[j].priority
+	})
+}
+
+// handleMessage runs every handler matching the message until one of them
+// stops the chain, see events.Stop. The errors of all handlers are returned.
+func (d *Dispatcher) handleMessage(ctx context.Context, client respond.Responder, teamID string, msgEvent *slackevents.MessageEvent) error {
+	var errs []error
+	for _, h := range d.handlers {
+		if !h.handler.Matches(msgEvent.Text) {
+			continue
 		}
+
+		stop, err := events.Stopped(h.handler.Handle(ctx, client, teamID, msgEvent))
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if stop {
+			break
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Dispatch handles an Events API event with the matching handlers.
+func (d *Dispatcher) Dispatch(ctx context.Context, eventsAPIEvent slackevents.EventsAPIEvent, client respond.Responder) error {
+	switch innerEvent := eventsAPIEvent.InnerEvent.Data.(type) {
+	case *slackevents.MessageEvent:
+		return d.handleMessage(ctx, client, eventsAPIEvent.TeamID, innerEvent)
+	case *slackevents.AppMentionEvent:
+		return commands.MentionCommand(ctx, client, eventsAPIEvent.TeamID, innerEvent)
+	case *slackevents.MemberJoinedChannelEvent:
+		return events.HandleMemberJoined(ctx, client, eventsAPIEvent.TeamID, innerEvent)
+	case *slackevents.MemberLeftChannelEvent:
+		return events.HandleMemberLeft(ctx, client, eventsAPIEvent.TeamID, innerEvent)
+	case *slackevents.ReactionAddedEvent:
+		return events.HandleReactionAdded(ctx, client, eventsAPIEvent.TeamID, innerEvent)
+	case *slackevents.ReactionRemovedEvent:
+		return events.HandleReactionRemoved(ctx, client, eventsAPIEvent.TeamID, innerEvent)
+	case *slackevents.AppUninstalledEvent:
+		return events.HandleAppUninstalled(ctx, client, eventsAPIEvent.TeamID, innerEvent)
+	case *slackevents.TokensRevokedEvent:
+		return events.HandleTokensRevoked(ctx, client, eventsAPIEvent.TeamID, innerEvent)
 	}
 	return nil
 }
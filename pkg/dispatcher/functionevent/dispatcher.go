@@ -0,0 +1,64 @@
+package functionevent
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/charmbracelet/log"
+	"github.com/kaplan-michael/slack-kudos/pkg/handler/functions"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// slack-go doesn't know the function_executed event, register it so that
+// it gets parsed instead of being dropped with an error.
+func init() {
+	slackevents.EventsAPIInnerEventMapping[functions.FunctionExecuted] = functions.FunctionExecutedEvent{}
+}
+
+// Dispatcher for handling custom workflow steps.
+type Dispatcher struct {
+	handlers []functions.FunctionHandler
+}
+
+// NewDispatcher creates a new dispatcher for custom workflow steps.
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		handlers: []functions.FunctionHandler{
+			functions.NewGiveKudosHandler(),
+		},
+	}
+}
+
+// Matches reports whether the Events API event is the execution of a custom step.
+func (d *Dispatcher) Matches(eventsAPIEvent slackevents.EventsAPIEvent) bool {
+	return eventsAPIEvent.InnerEvent.Type == functions.FunctionExecuted
+}
+
+// Dispatch runs a custom step with the matching handler and completes it.
+func (d *Dispatcher) Dispatch(ctx context.Context, eventsAPIEvent slackevents.EventsAPIEvent, client respond.Responder) error {
+	functionEvent, ok := eventsAPIEvent.InnerEvent.Data.(*functions.FunctionExecutedEvent)
+	if !ok {
+		return fmt.Errorf("unexpected function event data: %T", eventsAPIEvent.InnerEvent.Data)
+	}
+
+	// Every execution has to be completed, or the workflow hangs until it
+	// times out, so it's completed even when the handler ran out of time
+	complete := context.Background()
+
+	callbackID := functionEvent.Function.CallbackID
+	for _, handler := range d.handlers {
+		if !handler.Matches(callbackID) {
+			continue
+		}
+
+		outputs, err := handler.Handle(ctx, client, eventsAPIEvent.TeamID, functionEvent)
+		if err != nil {
+			log.FromContext(ctx).Warnf("Step %s failed in workspace %s: %v", callbackID, eventsAPIEvent.TeamID, err)
+			return functions.CompleteError(complete, functionEvent, err.Error())
+		}
+		return functions.CompleteSuccess(complete, functionEvent, outputs)
+	}
+
+	return functions.CompleteError(complete, functionEvent, fmt.Sprintf("unknown step %s", callbackID))
+}
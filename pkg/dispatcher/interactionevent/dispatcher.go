@@ -0,0 +1,42 @@
+package interactionevent
+
+import (
+	"context"
+
+	"github.com/kaplan-michael/slack-kudos/pkg/handler/interactions"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+	"github.com/slack-go/slack"
+)
+
+// Dispatcher for handling interactive events such as button clicks.
+type Dispatcher struct {
+	handlers []interactions.ActionHandler
+}
+
+// NewDispatcher creates a new dispatcher for interactive events.
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		handlers: []interactions.ActionHandler{
+			interactions.NewUndoHandler(),
+		},
+	}
+}
+
+// Dispatch handles the actions of an interaction with the matching handlers.
+func (d *Dispatcher) Dispatch(ctx context.Context, callback slack.InteractionCallback, client respond.Responder) error {
+	if callback.Type != slack.InteractionTypeBlockActions {
+		return nil
+	}
+
+	for _, action := range callback.ActionCallback.BlockActions {
+		for _, handler := range d.handlers {
+			if handler.Matches(action.ActionID) {
+				if err := handler.Handle(ctx, client, &callback, action); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
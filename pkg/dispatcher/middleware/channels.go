@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/charmbracelet/log"
+	"github.com/kaplan-michael/slack-kudos/pkg/dispatcher"
+	"github.com/kaplan-michael/slack-kudos/pkg/handler"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+	"github.com/kaplan-michael/slack-kudos/pkg/settings"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// ChannelFilter drops the events of channels the bot doesn't listen in,
+// see the listen setting. Turning it off for the workspace and on for some
+// channels allows only those, turning it off for a channel denies it.
+// Slash commands and interactions work everywhere, so the setting can
+// always be changed back, and the bot keeps track of the channels it's in.
+func ChannelFilter() dispatcher.Middleware {
+	return func(next dispatcher.HandlerFunc) dispatcher.HandlerFunc {
+		return func(ctx context.Context, req handler.Request, api respond.Responder) error {
+			if req.Kind != handler.KindEvent {
+				return next(ctx, req, api)
+			}
+			switch req.Event.InnerEvent.Data.(type) {
+			case *slackevents.MemberJoinedChannelEvent, *slackevents.MemberLeftChannelEvent:
+				return next(ctx, req, api)
+			}
+
+			channelID := req.ChannelID()
+			if channelID == "" {
+				return next(ctx, req, api)
+			}
+
+			value, err := settings.GetForChannel(ctx, req.TeamID, channelID, settings.Listen)
+			if err != nil {
+				return fmt.Errorf("failed to get the listen setting of channel %s: %w", channelID, err)
+			}
+			listen, err := settings.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid listen setting of channel %s: %w", channelID, err)
+			}
+			if !listen {
+				log.FromContext(ctx).Debug("Dropping event of a channel the bot doesn't listen in")
+				dropped.Add("channel_filtered", 1)
+				return nil
+			}
+			return next(ctx, req, api)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/kaplan-michael/slack-kudos/pkg/dispatcher"
+	"github.com/kaplan-michael/slack-kudos/pkg/handler"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+)
+
+// Dedup drops requests Slack delivers again, e.g. an event it retried
+// because the first delivery wasn't acknowledged in time, or one delivered
+// over both Socket Mode and HTTP. Requests are remembered for the window.
+// Requests without an ID, see handler.Request.ID, and requests retried from
+// the dead-letter store are never dropped.
+func Dedup(window time.Duration) dispatcher.Middleware {
+	seen := &seenSet{window: window, expires: map[string]time.Time{}}
+
+	return func(next dispatcher.HandlerFunc) dispatcher.HandlerFunc {
+		return func(ctx context.Context, req handler.Request, api respond.Responder) error {
+			id := req.ID()
+			if id != "" && req.Retry == 0 && seen.Seen(req.TeamID+"/"+id, time.Now()) {
+				log.FromContext(ctx).Debug("Dropping duplicate request")
+				dropped.Add("duplicate", 1)
+				return nil
+			}
+			return next(ctx, req, api)
+		}
+	}
+}
+
+// seenSet remembers keys for a while.
+type seenSet struct {
+	window    time.Duration
+	mu        sync.Mutex
+	expires   map[string]time.Time
+	lastSweep time.Time
+}
+
+// Seen reports whether the key was seen within the window and remembers it.
+func (s *seenSet) Seen(key string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Forget the expired keys once in a while
+	if now.Sub(s.lastSweep) > s.window {
+		for k, expires := range s.expires {
+			if now.After(expires) {
+				delete(s.expires, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	if expires, ok := s.expires[key]; ok && now.Before(expires) {
+		return true
+	}
+	s.expires[key] = now.Add(s.window)
+	return false
+}
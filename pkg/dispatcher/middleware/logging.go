@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/kaplan-michael/slack-kudos/pkg/dispatcher"
+	"github.com/kaplan-michael/slack-kudos/pkg/handler"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+)
+
+type correlationKey struct{}
+
+// CorrelationID returns the ID Logging gave the request being handled.
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+// Logging gives every request a correlation ID and a logger that adds it,
+// the workspace and the channel to every line, see log.FromContext. The
+// ID is the one Slack gave the request, e.g. the event ID, if there is one.
+// The channel of a private request isn't logged, see handler.Request.Private.
+// It logs the outcome of every request.
+func Logging() dispatcher.Middleware {
+	return func(next dispatcher.HandlerFunc) dispatcher.HandlerFunc {
+		return func(ctx context.Context, req handler.Request, api respond.Responder) error {
+			id := req.ID()
+			if id == "" {
+				id = newCorrelationID()
+			}
+
+			logger := log.With("correlation_id", id, "team_id", req.TeamID, "kind", req.Kind)
+			if channelID := req.ChannelID(); channelID != "" && !req.Private() {
+				logger = logger.With("channel_id", channelID)
+			}
+			if req.Retry > 0 {
+				logger = logger.With("retry", req.Retry)
+			}
+			ctx = context.WithValue(ctx, correlationKey{}, id)
+			ctx = log.WithContext(ctx, logger)
+
+			start := time.Now()
+			err := next(ctx, req, api)
+			if err != nil {
+				logger.Warn("Request failed", "duration", time.Since(start), "err", err)
+			} else {
+				logger.Debug("Request handled", "duration", time.Since(start))
+			}
+			return err
+		}
+	}
+}
+
+// newCorrelationID creates a random ID for a request Slack gave none.
+func newCorrelationID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
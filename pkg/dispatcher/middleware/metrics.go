@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"time"
+
+	"github.com/kaplan-michael/slack-kudos/pkg/dispatcher"
+	"github.com/kaplan-michael/slack-kudos/pkg/handler"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+)
+
+// The metrics are published with expvar, see expvar.Handler.
+var (
+	// requests counts the handled requests by kind and outcome, e.g. "event.ok"
+	requests = expvar.NewMap("dispatcher_requests")
+	// durations sums up the seconds spent handling requests by kind
+	durations = expvar.NewMap("dispatcher_duration_seconds")
+	// inFlight is the number of requests being handled
+	inFlight = expvar.NewInt("dispatcher_in_flight")
+	// dropped counts the requests dropped by a middleware by reason, e.g. "duplicate"
+	dropped = expvar.NewMap("dispatcher_dropped")
+)
+
+// Metrics counts the requests by kind and outcome and measures how long
+// they take. Used outside Recover, it counts panics too.
+func Metrics() dispatcher.Middleware {
+	return func(next dispatcher.HandlerFunc) dispatcher.HandlerFunc {
+		return func(ctx context.Context, req handler.Request, api respond.Responder) error {
+			inFlight.Add(1)
+			defer inFlight.Add(-1)
+
+			start := time.Now()
+			err := next(ctx, req, api)
+			durations.AddFloat(string(req.Kind), time.Since(start).Seconds())
+			requests.Add(string(req.Kind)+"."+outcome(err), 1)
+			return err
+		}
+	}
+}
+
+// outcome classifies the result of a request.
+func outcome(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, ErrPanic):
+		return "panic"
+	case errors.Is(err, ErrRateLimited):
+		return "rate_limited"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "cancelled"
+	default:
+		return "error"
+	}
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/kaplan-michael/slack-kudos/pkg/dispatcher"
+	"github.com/kaplan-michael/slack-kudos/pkg/handler"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+)
+
+// ErrRateLimited is returned for the requests of a workspace over its rate
+// limit. It's retryable, see deadletter.Retryable, so they are handled
+// later rather than lost.
+var ErrRateLimited error = rateLimitedError{}
+
+type rateLimitedError struct{}
+
+func (rateLimitedError) Error() string   { return "workspace is over its rate limit" }
+func (rateLimitedError) Retryable() bool { return true }
+
+// RateLimit limits how many requests of a workspace are handled per
+// minute, so that one busy workspace can't starve the others. Bursts of up
+// to a minute's worth of requests are let through, requests over the limit
+// fail with ErrRateLimited.
+func RateLimit(perMinute int) dispatcher.Middleware {
+	limiter := &limiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(perMinute),
+		buckets: map[string]*bucket{},
+	}
+
+	return func(next dispatcher.HandlerFunc) dispatcher.HandlerFunc {
+		return func(ctx context.Context, req handler.Request, api respond.Responder) error {
+			if !limiter.Allow(req.TeamID, time.Now()) {
+				log.FromContext(ctx).Warn("Deferring request, the workspace is over its rate limit")
+				return ErrRateLimited
+			}
+			return next(ctx, req, api)
+		}
+	}
+}
+
+// limiter is a token bucket per workspace.
+type limiter struct {
+	// rate is the number of tokens added per second
+	rate    float64
+	burst   float64
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Allow takes a token from the workspace's bucket, if there is one.
+func (l *limiter) Allow(teamID string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[teamID]
+	if !ok {
+		b = &bucket{tokens: l.burst, updated: now}
+		l.buckets[teamID] = b
+	}
+
+	b.tokens += now.Sub(b.updated).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.updated = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
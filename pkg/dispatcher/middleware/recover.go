@@ -0,0 +1,34 @@
+// Package middleware provides the middlewares wrapped around every request
+// the dispatcher handles, see dispatcher.Dispatcher.Use.
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/charmbracelet/log"
+	"github.com/kaplan-michael/slack-kudos/pkg/dispatcher"
+	"github.com/kaplan-michael/slack-kudos/pkg/handler"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+)
+
+// ErrPanic is returned for a request whose handler panicked.
+var ErrPanic = errors.New("handler panicked")
+
+// Recover turns a panic in a handler into an error, so that one bad request
+// doesn't take down the bot with the requests of every other workspace.
+func Recover() dispatcher.Middleware {
+	return func(next dispatcher.HandlerFunc) dispatcher.HandlerFunc {
+		return func(ctx context.Context, req handler.Request, api respond.Responder) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					log.FromContext(ctx).Error("Handler panicked", "panic", r, "stack", string(debug.Stack()))
+					err = fmt.Errorf("%w: %v", ErrPanic, r)
+				}
+			}()
+			return next(ctx, req, api)
+		}
+	}
+}
@@ -1,11 +1,11 @@
 package slashcommandevent
 
 import (
-	"fmt"
+	"context"
 
 	"github.com/kaplan-michael/slack-kudos/pkg/handler/commands"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
 	"github.com/slack-go/slack"
-	"github.com/slack-go/slack/socketmode"
 )
 
 // Dispatcher for handling Slash Command events.
@@ -23,15 +23,11 @@ func NewDispatcher() *Dispatcher {
 	}
 }
 
-func (d *Dispatcher) Dispatch(evt *socketmode.Event, client *socketmode.Client) error {
-	command, ok := evt.Data.(slack.SlashCommand)
-	if !ok {
-		return fmt.Errorf("invalid command event type")
-	}
-
+// Dispatch handles a slash command with the matching handler.
+func (d *Dispatcher) Dispatch(ctx context.Context, command slack.SlashCommand, client respond.Responder) error {
 	for _, handler := range d.handlers {
 		if handler.Matches(command.Command) {
-			return handler.Handle(client, evt)
+			return handler.Handle(ctx, client, command)
 		}
 	}
 	return nil
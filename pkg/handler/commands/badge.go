@@ -0,0 +1,54 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/kaplan-michael/slack-kudos/pkg/kudos"
+	"github.com/kaplan-michael/slack-kudos/pkg/messages"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+)
+
+var emojiPattern = regexp.MustCompile(`^:[a-z0-9_+\-']+:$`)
+
+// badgeCommand handles "/kudos badge <milestone> <:emoji:> <name>",
+// letting admins name the badge awarded for a milestone.
+func badgeCommand(ctx context.Context, client respond.Responder, cmd request, args []string) error {
+	if len(args) < 3 {
+		return postEphemeral(ctx, client, cmd, "badge_usage", nil)
+	}
+
+	admin, err := isAdmin(ctx, client, cmd.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to check admin status: %w", err)
+	}
+	if !admin {
+		return postEphemeral(ctx, client, cmd, "admin_only", nil)
+	}
+
+	threshold, err := strconv.Atoi(args[0])
+	if err != nil || threshold <= 0 {
+		return postEphemeral(ctx, client, cmd, "badge_invalid_milestone", nil)
+	}
+
+	emoji := args[1]
+	if !emojiPattern.MatchString(emoji) {
+		return postEphemeral(ctx, client, cmd, "badge_invalid_emoji", nil)
+	}
+
+	name := strings.Join(args[2:], " ")
+	if err := kudos.SetBadge(ctx, cmd.TeamID, threshold, name, emoji); err != nil {
+		return err
+	}
+
+	log.FromContext(ctx).Infof("User %s named the %d kudos badge %q in workspace %s", cmd.UserID, threshold, name, cmd.TeamID)
+	return postEphemeral(ctx, client, cmd, "badge_saved", messages.Data{
+		"Threshold": threshold,
+		"Emoji":     emoji,
+		"Name":      name,
+	})
+}
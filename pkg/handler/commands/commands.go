@@ -1,27 +1,29 @@
 package commands
 
 import (
+	"context"
 	"regexp"
 
-	"github.com/slack-go/slack/socketmode"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+	"github.com/slack-go/slack"
 )
 
 // CommandHandler defines the interface for all message handlers.
 type CommandHandler interface {
 	Matches(text string) bool
-	Handle(client *socketmode.Client, event *socketmode.Event) error
+	Handle(ctx context.Context, client respond.Responder, cmd slack.SlashCommand) error
 }
 
 // RegexCommandHandler implements the MessageHandler interface with a regex pattern.
 type RegexCommandHandler struct {
 	Pattern    *regexp.Regexp
-	HandleFunc func(client *socketmode.Client, event *socketmode.Event) error
+	HandleFunc func(ctx context.Context, client respond.Responder, cmd slack.SlashCommand) error
 }
 
 func (h *RegexCommandHandler) Matches(text string) bool {
 	return h.Pattern.MatchString(text)
 }
 
-func (h *RegexCommandHandler) Handle(client *socketmode.Client, event *socketmode.Event) error {
-	return h.HandleFunc(client, event)
+func (h *RegexCommandHandler) Handle(ctx context.Context, client respond.Responder, cmd slack.SlashCommand) error {
+	return h.HandleFunc(ctx, client, cmd)
 }
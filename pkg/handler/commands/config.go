@@ -0,0 +1,145 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/kaplan-michael/slack-kudos/pkg/messages"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+	"github.com/kaplan-michael/slack-kudos/pkg/settings"
+)
+
+// configCommand handles "/kudos config [channel] [setting] [value]".
+// Without arguments it lists the workspace settings, with a setting and a
+// value it changes the setting. Changing settings is restricted to admins.
+// With "channel" the settings of the current channel are listed or changed.
+func configCommand(ctx context.Context, client respond.Responder, cmd request, args []string) error {
+	if len(args) > 0 && args[0] == "channel" {
+		return channelConfigCommand(ctx, client, cmd, args[1:])
+	}
+
+	if len(args) == 0 {
+		return listSettings(ctx, client, cmd, "")
+	}
+
+	if len(args) < 2 {
+		return postEphemeral(ctx, client, cmd, "config_usage", nil)
+	}
+
+	admin, err := isAdmin(ctx, client, cmd.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to check admin status: %w", err)
+	}
+	if !admin {
+		return postEphemeral(ctx, client, cmd, "admin_only", nil)
+	}
+
+	key := args[0]
+	value := strings.Join(args[1:], " ")
+	if err := settings.Set(ctx, cmd.TeamID, key, value); err != nil {
+		return postEphemeral(ctx, client, cmd, "config_invalid", messages.Data{"Key": key, "Error": err.Error()})
+	}
+
+	log.FromContext(ctx).Infof("User %s set %s to %q in workspace %s", cmd.UserID, key, value, cmd.TeamID)
+	return postEphemeral(ctx, client, cmd, "config_saved", messages.Data{"Key": key, "Value": value})
+}
+
+// settingValue is a setting with its current value, for display.
+type settingValue struct {
+	Key         string
+	Value       string
+	Description string
+}
+
+// channelConfigCommand handles "/kudos config channel [setting] [value]".
+func channelConfigCommand(ctx context.Context, client respond.Responder, cmd request, args []string) error {
+	if len(args) == 0 {
+		return listSettings(ctx, client, cmd, cmd.ChannelID)
+	}
+
+	if len(args) < 2 {
+		return postEphemeral(ctx, client, cmd, "config_channel_usage", nil)
+	}
+
+	admin, err := isAdmin(ctx, client, cmd.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to check admin status: %w", err)
+	}
+	if !admin {
+		return postEphemeral(ctx, client, cmd, "admin_only", nil)
+	}
+
+	key := args[0]
+	value := strings.Join(args[1:], " ")
+	if err := settings.SetForChannel(ctx, cmd.TeamID, cmd.ChannelID, key, value); err != nil {
+		return postEphemeral(ctx, client, cmd, "config_invalid", messages.Data{"Key": key, "Error": err.Error()})
+	}
+
+	log.FromContext(ctx).Infof("User %s set %s to %q in channel %s of workspace %s", cmd.UserID, key, value, cmd.ChannelID, cmd.TeamID)
+	return postEphemeral(ctx, client, cmd, "config_channel_saved", messages.Data{"Key": key, "Value": value, "ChannelID": cmd.ChannelID})
+}
+
+// listSettings shows the current value of every setting. With a channel
+// only the settings that can be changed per channel are listed.
+func listSettings(ctx context.Context, client respond.Responder, cmd request, channelID string) error {
+	values := make([]settingValue, 0, len(settings.Definitions))
+	for _, def := range settings.Definitions {
+		if channelID != "" && !def.ChannelScoped {
+			continue
+		}
+
+		var value string
+		var err error
+		if channelID != "" {
+			value, err = settings.GetForChannel(ctx, cmd.TeamID, channelID, def.Key)
+		} else {
+			value, err = settings.Get(ctx, cmd.TeamID, def.Key)
+		}
+		if err != nil {
+			log.FromContext(ctx).Warnf("Failed to get setting %s for workspace %s: %v", def.Key, cmd.TeamID, err)
+			value = def.Default
+		}
+		values = append(values, settingValue{Key: def.Key, Value: value, Description: def.Description})
+	}
+
+	title := "config_title"
+	if channelID != "" {
+		title = "config_channel_title"
+	}
+
+	locale := messages.Locale(ctx, client, cmd.TeamID, cmd.UserID)
+	msg, err := messages.Render(ctx, cmd.TeamID, locale, "settings", messages.Data{
+		"Key":       title,
+		"ChannelID": channelID,
+		"Settings":  values,
+	})
+	if err != nil {
+		return err
+	}
+	return sendEphemeral(ctx, client, cmd, msg)
+}
+
+// isAdmin reports whether the user is an admin or owner of the workspace.
+func isAdmin(ctx context.Context, client respond.Responder, userID string) (bool, error) {
+	user, err := client.GetUserInfoContext(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return user.IsAdmin || user.IsOwner || user.IsPrimaryOwner, nil
+}
+
+// postEphemeral renders a notice and shows it only to the user who ran the command.
+func postEphemeral(ctx context.Context, client respond.Responder, cmd request, key string, data messages.Data) error {
+	locale := messages.Locale(ctx, client, cmd.TeamID, cmd.UserID)
+	msg, err := messages.Notice(ctx, cmd.TeamID, locale, key, data)
+	if err != nil {
+		return err
+	}
+	return sendEphemeral(ctx, client, cmd, msg)
+}
+
+func sendEphemeral(ctx context.Context, client respond.Responder, cmd request, msg messages.Message) error {
+	return respond.EphemeralInThread(ctx, client, cmd.ChannelID, cmd.ThreadTS, cmd.UserID, msg)
+}
@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"context"
 	"fmt"
 	"regexp"
 	"strconv"
@@ -8,8 +9,9 @@ import (
 
 	"github.com/charmbracelet/log"
 	"github.com/kaplan-michael/slack-kudos/pkg/database"
+	"github.com/kaplan-michael/slack-kudos/pkg/messages"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
 	"github.com/slack-go/slack"
-	"github.com/slack-go/slack/socketmode"
 )
 
 func NewKudosHandler() *RegexCommandHandler {
@@ -19,91 +21,157 @@ func NewKudosHandler() *RegexCommandHandler {
 	}
 }
 
+// request is a kudos command, from the slash command or from a mention of the bot.
+type request struct {
+	slack.SlashCommand
+	// ThreadTS is the thread the command was given in, replies go to the same thread
+	ThreadTS string
+}
+
 // KudosCommand handles the "/kudos" slash command.
-func KudosCommand(client *socketmode.Client, evt *socketmode.Event) error {
-	cmd, ok := evt.Data.(slack.SlashCommand)
-	if !ok {
-		log.Warnf("expected SlashCommand in event data")
-		return nil
+func KudosCommand(ctx context.Context, client respond.Responder, cmd slack.SlashCommand) error {
+	err := runCommand(ctx, client, request{SlashCommand: cmd})
+	if respond.NotInChannel(err) && cmd.ResponseURL != "" {
+		return hintInvite(ctx, client, cmd, err)
+	}
+	return err
+}
+
+// hintInvite tells the user to invite the bot after a reply failed because
+// the bot isn't in the channel. The response URL works without membership.
+func hintInvite(ctx context.Context, client respond.Responder, cmd slack.SlashCommand, cause error) error {
+	log.FromContext(ctx).Infof("Bot is not a member of channel %s in workspace %s: %v", cmd.ChannelID, cmd.TeamID, cause)
+
+	authInfo, err := client.AuthTestContext(ctx)
+	if err != nil {
+		return fmt.Errorf("could not get bot info: %w", err)
+	}
+
+	locale := messages.Locale(ctx, client, cmd.TeamID, cmd.UserID)
+	msg, err := messages.Notice(ctx, cmd.TeamID, locale, "not_in_channel", messages.Data{"BotName": authInfo.User})
+	if err != nil {
+		return err
 	}
+	return respond.ToResponseURL(ctx, client, cmd.ResponseURL, msg)
+}
+
+// subcommands are the names runCommand routes to a subcommand.
+var subcommands = []string{"help", "top", "config", "reveal", "me", "stats", "badge", "template", "notifications"}
 
+// runCommand routes a kudos command to its subcommand. Without a
+// subcommand it shows the leaderboard.
+func runCommand(ctx context.Context, client respond.Responder, cmd request) error {
 	// Get the team ID from the slash command
 	teamID := cmd.TeamID
 	if teamID == "" {
-		log.Warn("Could not determine team ID for kudos command")
+		log.FromContext(ctx).Warn("Could not determine team ID for kudos command")
 		return fmt.Errorf("could not determine team ID")
 	}
 
+	args := strings.Fields(cmd.Text)
+
+	// Route subcommands
+	if len(args) > 0 {
+		switch args[0] {
+		case "help":
+			return postEphemeral(ctx, client, cmd, "help", nil)
+		case "top":
+			return leaderboardCommand(ctx, client, cmd, args[1:])
+		case "config":
+			return configCommand(ctx, client, cmd, args[1:])
+		case "reveal":
+			return revealCommand(ctx, client, cmd, args[1:])
+		case "me", "stats":
+			return meCommand(ctx, client, cmd)
+		case "badge":
+			return badgeCommand(ctx, client, cmd, args[1:])
+		case "template":
+			return templateCommand(ctx, client, cmd, args[1:])
+		case "notifications":
+			return notificationsCommand(ctx, client, cmd, args[1:])
+		}
+	}
+
+	return leaderboardCommand(ctx, client, cmd, args)
+}
+
+// leaderboardCommand handles "/kudos [top] [how many users]".
+func leaderboardCommand(ctx context.Context, client respond.Responder, cmd request, args []string) error {
+	teamID := cmd.TeamID
+	locale := messages.Locale(ctx, client, teamID, cmd.UserID)
+
 	// Default to showing top 5 users if no number is specified
 	topCount := 5
-	args := strings.Fields(cmd.Text)
 	if len(args) > 0 {
 		var err error
 		topCount, err = strconv.Atoi(args[0])
 		if err != nil {
-			msg := "Invalid number specified. Please enter a valid number."
-			_, _, err = client.PostMessage(cmd.ChannelID, slack.MsgOptionText(msg, false))
-			if err != nil {
-				return fmt.Errorf("failed to post message: %v", err)
-			}
-			return fmt.Errorf("invalid number specified: %v", err)
+			// The user is told, it's not an error of the bot
+			return postMessage(ctx, client, cmd, locale, "invalid_number")
 		}
 	}
 
-	users, err := GetTopKudosUsers(teamID, topCount)
+	users, err := GetTopKudosUsers(ctx, teamID, topCount)
 	if err != nil {
 		// Check for workspace not found error specifically
 		if strings.Contains(err.Error(), "workspace not found") {
-			msg := "This workspace hasn't been set up yet. Make sure the OAuth installation has been completed."
-			_, _, err = client.PostMessage(cmd.ChannelID, slack.MsgOptionText(msg, false))
-			if err != nil {
-				return fmt.Errorf("failed to post message: %v", err)
-			}
-			return nil
+			return postMessage(ctx, client, cmd, locale, "workspace_not_set_up")
 		}
 
 		// Other errors
-		msg := "Failed to retrieve top kudos users."
-		_, _, err = client.PostMessage(cmd.ChannelID, slack.MsgOptionText(msg, false))
-		if err != nil {
-			return fmt.Errorf("failed to post message: %v", err)
+		if err := postMessage(ctx, client, cmd, locale, "leaderboard_failed"); err != nil {
+			return err
 		}
-		return fmt.Errorf("failed to retrieve top kudos users: %v", err)
+		return fmt.Errorf("failed to retrieve top kudos users: %w", err)
 	}
 
 	// Check if any users were found
 	if len(users) == 0 {
-		response := "No kudos have been given in this workspace yet. Be the first to give kudos by mentioning someone with `++`!"
-		_, _, err = client.PostMessage(cmd.ChannelID, slack.MsgOptionText(response, false))
-		if err != nil {
-			return fmt.Errorf("failed to post message: %v", err)
-		}
-		return nil
+		return postMessage(ctx, client, cmd, locale, "leaderboard_empty")
 	}
 
 	// Build the response with the top users
-	response := fmt.Sprintf("Top %d kudos users in this workspace:\n", topCount)
-	for _, user := range users {
-		response += fmt.Sprintf("<@%s> - %d kudos\n", user.UserID, user.Count)
+	msg, err := messages.Render(ctx, teamID, locale, "leaderboard", messages.Data{
+		"Limit": topCount,
+		"Users": users,
+	})
+	if err != nil {
+		return err
 	}
 
-	_, _, err = client.PostMessage(cmd.ChannelID, slack.MsgOptionText(response, false))
+	return reply(ctx, client, cmd, msg)
+}
+
+// postMessage renders a notice and posts it where the command was given.
+func postMessage(ctx context.Context, client respond.Responder, cmd request, locale, key string) error {
+	msg, err := messages.Notice(ctx, cmd.TeamID, locale, key, nil)
 	if err != nil {
-		return fmt.Errorf("failed to post message: %v", err)
+		return err
+	}
+	return reply(ctx, client, cmd, msg)
+}
+
+// reply posts a message everyone can see where the command was given.
+func reply(ctx context.Context, client respond.Responder, cmd request, msg messages.Message) error {
+	var err error
+	if cmd.ThreadTS != "" {
+		_, err = respond.Thread(ctx, client, cmd.ChannelID, cmd.ThreadTS, msg)
+	} else {
+		_, err = respond.Channel(ctx, client, cmd.ChannelID, msg)
 	}
-	return nil
+	return err
 }
 
 // Note: This function is no longer used as we get the team ID directly
 // from the API or command data
 
 // GetTopKudosUsers retrieves the top 'limit' users with the most kudos for a specific workspace.
-func GetTopKudosUsers(teamID string, limit int) ([]KudosUser, error) {
+func GetTopKudosUsers(ctx context.Context, teamID string, limit int) ([]KudosUser, error) {
 	var users []KudosUser
 
 	// First check if workspace exists
 	var count int
-	err := database.DB.QueryRow(`SELECT COUNT(*) FROM workspaces WHERE team_id = ?`, teamID).Scan(&count)
+	err := database.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM workspaces WHERE team_id = ?`, teamID).Scan(&count)
 	if err != nil {
 		return nil, fmt.Errorf("error checking workspace: %w", err)
 	}
@@ -114,27 +182,27 @@ func GetTopKudosUsers(teamID string, limit int) ([]KudosUser, error) {
 	}
 
 	// Query workspace_kudos table for multi-tenant support
-	rows, err := database.DB.Query(`
+	rows, err := database.DB.QueryContext(ctx, `
         SELECT user_id, count 
         FROM workspace_kudos 
         WHERE team_id = ?
         ORDER BY count DESC 
         LIMIT ?`, teamID, limit)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query top kudos users: %v", err)
+		return nil, fmt.Errorf("failed to query top kudos users: %w", err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		var user KudosUser
 		if err := rows.Scan(&user.UserID, &user.Count); err != nil {
-			return nil, fmt.Errorf("failed to scan kudos user: %v", err)
+			return nil, fmt.Errorf("failed to scan kudos user: %w", err)
 		}
 		users = append(users, user)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("rows iteration error: %v", err)
+		return nil, fmt.Errorf("rows iteration error: %w", err)
 	}
 
 	// If no users found, return empty slice
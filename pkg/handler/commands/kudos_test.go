@@ -0,0 +1,62 @@
+package commands_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kaplan-michael/slack-kudos/pkg/handler/handlertest"
+	"github.com/kaplan-michael/slack-kudos/pkg/kudos"
+)
+
+func TestLeaderboard(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		// want are parts of the reply, in order
+		want []string
+		// not are parts the reply doesn't contain
+		not []string
+	}{
+		{name: "default", text: "", want: []string{"<@U2>", "<@U3>"}},
+		{name: "top", text: "top", want: []string{"<@U2>", "<@U3>"}},
+		{name: "how many", text: "top 1", want: []string{"<@U2>"}, not: []string{"<@U3>"}},
+		{name: "invalid number", text: "top many", want: []string{"Invalid number"}, not: []string{"<@U2>"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			client := handlertest.Setup(t, "T1")
+			for _, recipientID := range []string{"U2", "U2", "U3"} {
+				if _, err := kudos.Give(ctx, kudos.Kudos{TeamID: "T1", GiverID: "U1", RecipientID: recipientID, Amount: 1}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := client.Dispatch(ctx, handlertest.Command("T1", "C1", "U1", "/kudos", tt.text)); err != nil {
+				t.Fatalf("Dispatch() error = %v", err)
+			}
+
+			calls := client.Calls()
+			if len(calls) != 1 {
+				t.Fatalf("calls = %+v, want one reply", calls)
+			}
+			reply := calls[0].Content()
+
+			rest := reply
+			for _, want := range tt.want {
+				i := strings.Index(rest, want)
+				if i < 0 {
+					t.Fatalf("reply = %s, want %q in it after the previous parts", reply, want)
+				}
+				rest = rest[i+len(want):]
+			}
+			for _, not := range tt.not {
+				if strings.Contains(reply, not) {
+					t.Errorf("reply = %s, want no %q in it", reply, not)
+				}
+			}
+		})
+	}
+}
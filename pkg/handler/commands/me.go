@@ -0,0 +1,39 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kaplan-michael/slack-kudos/pkg/kudos"
+	"github.com/kaplan-michael/slack-kudos/pkg/messages"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+)
+
+// meCommand handles "/kudos me", showing the user's kudos, rank and badges.
+func meCommand(ctx context.Context, client respond.Responder, cmd request) error {
+	count, rank, err := kudos.Stats(ctx, cmd.TeamID, cmd.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get kudos stats: %w", err)
+	}
+
+	if count == 0 {
+		return postEphemeral(ctx, client, cmd, "me_empty", nil)
+	}
+
+	badges, err := kudos.UserBadges(ctx, cmd.TeamID, cmd.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get badges: %w", err)
+	}
+
+	locale := messages.Locale(ctx, client, cmd.TeamID, cmd.UserID)
+	msg, err := messages.Render(ctx, cmd.TeamID, locale, "me", messages.Data{
+		"Count":  count,
+		"Rank":   rank,
+		"Badges": badges,
+	})
+	if err != nil {
+		return err
+	}
+
+	return sendEphemeral(ctx, client, cmd, msg)
+}
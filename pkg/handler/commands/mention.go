@@ -0,0 +1,64 @@
+package commands
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/kaplan-michael/slack-kudos/pkg/handler/events"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// MentionCommand handles mentions of the bot like "@KudosBot top 10" by
+// running the text after the mention as a "/kudos" command.
+func MentionCommand(ctx context.Context, client respond.Responder, teamID string, ev *slackevents.AppMentionEvent) error {
+	// Ignore other bots, and kudos given in the same message as the mention
+	if ev.BotID != "" || events.NewKudosHandler().Matches(ev.Text) {
+		return nil
+	}
+
+	cmd := request{
+		SlashCommand: slack.SlashCommand{
+			TeamID:    teamID,
+			ChannelID: ev.Channel,
+			UserID:    ev.User,
+			Command:   "/kudos",
+			Text:      textAfterMention(ev.Text),
+		},
+		ThreadTS: ev.ThreadTimeStamp,
+	}
+
+	// Answer anything the bot doesn't understand with the help
+	args := strings.Fields(cmd.Text)
+	if len(args) == 0 || !isSubcommand(args[0]) {
+		return postEphemeral(ctx, client, cmd, "help", nil)
+	}
+
+	return runCommand(ctx, client, cmd)
+}
+
+// textAfterMention returns the text following the first user mention,
+// which is the mention of the bot.
+func textAfterMention(text string) string {
+	for _, token := range events.Tokenize(text) {
+		if token.Kind == events.TokenMention && token.Mention.Kind == events.MentionUser {
+			return strings.TrimSpace(text[token.End:])
+		}
+	}
+	return strings.TrimSpace(text)
+}
+
+// isSubcommand reports whether the argument is a subcommand or a number of users.
+func isSubcommand(arg string) bool {
+	if _, err := strconv.Atoi(arg); err == nil {
+		return true
+	}
+	for _, name := range subcommands {
+		if arg == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package commands
+
+import (
+	"context"
+
+	"github.com/charmbracelet/log"
+	"github.com/kaplan-michael/slack-kudos/pkg/messages"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+	"github.com/kaplan-michael/slack-kudos/pkg/settings"
+)
+
+// notificationsCommand handles "/kudos notifications [instant|daily|off|default]".
+// Without arguments it shows the user's current preference.
+func notificationsCommand(ctx context.Context, client respond.Responder, cmd request, args []string) error {
+	if len(args) == 0 {
+		value, err := settings.GetForUser(ctx, cmd.TeamID, cmd.UserID, settings.Notifications)
+		if err != nil {
+			return err
+		}
+		return postEphemeral(ctx, client, cmd, "notifications_current", messages.Data{"Value": value})
+	}
+
+	if len(args) > 1 {
+		return postEphemeral(ctx, client, cmd, "notifications_usage", nil)
+	}
+
+	if err := settings.SetForUser(ctx, cmd.TeamID, cmd.UserID, settings.Notifications, args[0]); err != nil {
+		return postEphemeral(ctx, client, cmd, "notifications_invalid", messages.Data{"Error": err.Error()})
+	}
+
+	// Show the effective value, "default" follows the workspace setting
+	value, err := settings.GetForUser(ctx, cmd.TeamID, cmd.UserID, settings.Notifications)
+	if err != nil {
+		return err
+	}
+
+	log.FromContext(ctx).Infof("User %s set their notifications to %q in workspace %s", cmd.UserID, value, cmd.TeamID)
+	return postEphemeral(ctx, client, cmd, "notifications_saved", messages.Data{"Value": value})
+}
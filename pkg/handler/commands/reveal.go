@@ -0,0 +1,54 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/charmbracelet/log"
+	"github.com/kaplan-michael/slack-kudos/pkg/kudos"
+	"github.com/kaplan-michael/slack-kudos/pkg/messages"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+)
+
+// revealCommand handles "/kudos reveal <kudos id>", letting admins see
+// who gave an anonymous kudos when investigating abuse.
+func revealCommand(ctx context.Context, client respond.Responder, cmd request, args []string) error {
+	if len(args) != 1 {
+		return postEphemeral(ctx, client, cmd, "reveal_usage", nil)
+	}
+
+	admin, err := isAdmin(ctx, client, cmd.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to check admin status: %w", err)
+	}
+	if !admin {
+		return postEphemeral(ctx, client, cmd, "admin_only", nil)
+	}
+
+	kudosID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return postEphemeral(ctx, client, cmd, "reveal_invalid", nil)
+	}
+
+	record, err := kudos.Get(ctx, cmd.TeamID, kudosID)
+	if errors.Is(err, kudos.ErrNotFound) {
+		return postEphemeral(ctx, client, cmd, "reveal_not_found", messages.Data{"KudosID": kudosID})
+	}
+	if err != nil {
+		return err
+	}
+
+	giverID, err := kudos.RevealGiver(record)
+	if err != nil {
+		return fmt.Errorf("failed to reveal giver of kudos %d: %w", kudosID, err)
+	}
+
+	log.FromContext(ctx).Infof("User %s revealed the giver of kudos %d in workspace %s", cmd.UserID, kudosID, cmd.TeamID)
+	return postEphemeral(ctx, client, cmd, "reveal_result", messages.Data{
+		"KudosID": kudosID,
+		"UserID":  record.RecipientID,
+		"GiverID": giverID,
+	})
+}
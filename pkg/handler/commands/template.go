@@ -0,0 +1,85 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/charmbracelet/log"
+	"github.com/kaplan-michael/slack-kudos/pkg/messages"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+)
+
+// slackUnescaper reverts the escaping Slack applies to command text.
+var slackUnescaper = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&")
+
+// templateCommand handles the template overrides of a workspace:
+//
+//	/kudos template text <locale> <key> [template|reset]
+//	/kudos template layout <name> [template|reset]
+//
+// Without a template the current one is shown. Changing templates is restricted to admins.
+func templateCommand(ctx context.Context, client respond.Responder, cmd request, args []string) error {
+	var locale, name string
+	var body []string
+	var skip int
+
+	switch {
+	case len(args) >= 3 && args[0] == "text":
+		locale, name, body = args[1], args[2], args[3:]
+		skip = 4
+	case len(args) >= 2 && args[0] == "layout":
+		name, body = args[1], args[2:]
+		skip = 3
+	default:
+		return postEphemeral(ctx, client, cmd, "template_usage", nil)
+	}
+
+	if len(body) == 0 {
+		source, err := messages.Source(ctx, cmd.TeamID, locale, name)
+		if err != nil {
+			return postEphemeral(ctx, client, cmd, "template_invalid", messages.Data{"Name": name, "Error": err.Error()})
+		}
+		return postEphemeral(ctx, client, cmd, "template_show", messages.Data{"Name": name, "Body": source})
+	}
+
+	admin, err := isAdmin(ctx, client, cmd.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to check admin status: %w", err)
+	}
+	if !admin {
+		return postEphemeral(ctx, client, cmd, "admin_only", nil)
+	}
+
+	if len(body) == 1 && body[0] == "reset" {
+		if err := messages.ResetOverride(ctx, cmd.TeamID, locale, name); err != nil {
+			return err
+		}
+		log.FromContext(ctx).Infof("User %s reset template %s (%s) in workspace %s", cmd.UserID, name, locale, cmd.TeamID)
+		return postEphemeral(ctx, client, cmd, "template_reset", messages.Data{"Name": name})
+	}
+
+	// Keep the template's original whitespace, it's everything after the name
+	source := slackUnescaper.Replace(skipFields(cmd.Text, skip))
+
+	if err := messages.SetOverride(ctx, cmd.TeamID, locale, name, source); err != nil {
+		return postEphemeral(ctx, client, cmd, "template_invalid", messages.Data{"Name": name, "Error": err.Error()})
+	}
+
+	log.FromContext(ctx).Infof("User %s changed template %s (%s) in workspace %s", cmd.UserID, name, locale, cmd.TeamID)
+	return postEphemeral(ctx, client, cmd, "template_saved", messages.Data{"Name": name})
+}
+
+// skipFields returns the text after the first n whitespace separated fields.
+func skipFields(text string, n int) string {
+	for i := 0; i < n; i++ {
+		text = strings.TrimLeftFunc(text, unicode.IsSpace)
+		end := strings.IndexFunc(text, unicode.IsSpace)
+		if end < 0 {
+			return ""
+		}
+		text = text[end:]
+	}
+	return strings.TrimSpace(text)
+}
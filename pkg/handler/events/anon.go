@@ -0,0 +1,152 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/kaplan-michael/slack-kudos/pkg/kudos"
+	"github.com/kaplan-michael/slack-kudos/pkg/messages"
+	"github.com/kaplan-michael/slack-kudos/pkg/notify"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+	"github.com/kaplan-michael/slack-kudos/pkg/settings"
+	"github.com/kaplan-michael/slack-kudos/pkg/wall"
+	"github.com/slack-go/slack/slackevents"
+)
+
+func NewAnonHandler() *TokenMessageHandler {
+	return &TokenMessageHandler{
+		Match: func(tokens []Token) bool {
+			_, ok := findAnon(tokens)
+			return ok
+		},
+		HandleFunc: handleAnonKudos,
+		// The message gives a kudos, it mustn't be given again as a regular one
+		Final: true,
+	}
+}
+
+// findAnon matches messages starting with "anon @user ++".
+func findAnon(tokens []Token) (trigger, bool) {
+	if len(tokens) < 3 || tokens[0].Kind != TokenText {
+		return trigger{}, false
+	}
+
+	// "anon" needs to be followed by whitespace, and nothing else before the mention
+	prefix := strings.TrimLeft(tokens[0].Text, " \t\n")
+	if !strings.HasPrefix(prefix, "anon") || len(prefix) == len("anon") || strings.TrimSpace(prefix[len("anon"):]) != "" {
+		return trigger{}, false
+	}
+
+	t, ok := operatorAfter(tokens[1], tokens[2])
+	if !ok || t.Operator != "++" {
+		return trigger{}, false
+	}
+	return t, true
+}
+
+// handleAnonKudos processes "anon @user ++ reason" messages sent to the bot
+// in a direct message. The kudos is delivered without revealing the giver.
+func handleAnonKudos(ctx context.Context, client respond.Responder, teamID string, msgEvent *slackevents.MessageEvent) error {
+	// Outside of a DM the giver is visible anyway, treat it as a regular kudos
+	if msgEvent.ChannelType != "im" {
+		return handleKudos(ctx, client, teamID, msgEvent)
+	}
+
+	t, ok := findAnon(Tokenize(msgEvent.Text))
+	if !ok {
+		log.FromContext(ctx).Debugf("Ignoring message, could not extract user ID from it")
+		return nil
+	}
+	userID := t.UserID
+	reason := strings.TrimSpace(msgEvent.Text[t.End:])
+
+	locale := messages.Locale(ctx, client, teamID, msgEvent.User)
+
+	if userID == msgEvent.User {
+		return postNotice(ctx, client, teamID, locale, msgEvent.Channel, "anon_self", nil)
+	}
+
+	// Deliver to the configured channel, or straight to the recipient. The
+	// kudos is recorded where it's delivered, the giver's DM with the bot
+	// would give the giver away.
+	anonChannel, err := settings.Get(ctx, teamID, settings.AnonChannel)
+	if err != nil {
+		return fmt.Errorf("failed to get anonymous kudos channel: %w", err)
+	}
+	channelID := anonChannel
+	if channelID == "" {
+		channelID, err = respond.OpenDM(ctx, client, userID)
+		if err != nil {
+			return fmt.Errorf("failed to deliver anonymous kudos: %w", err)
+		}
+	}
+
+	result, err := kudos.Give(ctx, kudos.Kudos{
+		TeamID:      teamID,
+		GiverID:     msgEvent.User,
+		RecipientID: userID,
+		ChannelID:   channelID,
+		SourceID:    kudos.AnonSourceID(teamID, msgEvent.Channel, msgEvent.TimeStamp),
+		Amount:      1,
+		Reason:      reason,
+		Anonymous:   true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to give anonymous kudos to user %s in workspace %s: %w", userID, teamID, err)
+	}
+
+	msg, err := messages.Render(ctx, teamID, locale, "kudos", messages.Data{
+		"Key":     "kudos_anon",
+		"UserID":  userID,
+		"Count":   result.Count,
+		"Reason":  messages.UserText(reason),
+		"KudosID": result.Kudos.ID,
+		"ShowID":  true,
+	})
+	if err != nil {
+		return err
+	}
+
+	// A retried event only redoes what failed before, see kudos.Result.Deliver
+	err = result.Deliver(ctx, kudos.StepAnnounce, func() error {
+		if _, err := respond.Channel(ctx, client, channelID, msg); err != nil {
+			return fmt.Errorf("failed to deliver anonymous kudos: %w", err)
+		}
+		log.FromContext(ctx).Infof("Delivered anonymous kudos %d to user %s in workspace %s", result.Kudos.ID, userID, teamID)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Kudos announced in a channel can be missed, DMs can't
+	if anonChannel != "" {
+		err := result.Deliver(ctx, kudos.StepNotify, func() error {
+			return notify.Recipient(ctx, client, result.Kudos)
+		})
+		if err != nil {
+			log.FromContext(ctx).Warnf("Failed to notify user %s about kudos %d: %v", userID, result.Kudos.ID, err)
+		}
+	}
+
+	err = result.Deliver(ctx, kudos.StepWall, func() error {
+		return wall.Post(ctx, client, result)
+	})
+	if err != nil {
+		log.FromContext(ctx).Warnf("Failed to cross-post kudos %d to the kudos wall: %v", result.Kudos.ID, err)
+	}
+
+	target := respond.Target{TeamID: teamID, ChannelID: channelID, RecipientID: userID}
+	err = result.Deliver(ctx, kudos.StepCelebrate, func() error {
+		return Celebrate(ctx, client, locale, settings.ModeChannel, target, result.Badges)
+	})
+	if err != nil {
+		log.FromContext(ctx).Warnf("Failed to celebrate milestones of user %s: %v", userID, err)
+	}
+
+	return result.Deliver(ctx, kudos.StepAcknowledge, func() error {
+		return postNotice(ctx, client, teamID, locale, msgEvent.Channel, "anon_delivered", messages.Data{"UserID": userID})
+	})
+}
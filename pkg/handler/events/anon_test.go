@@ -0,0 +1,52 @@
+package events_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kaplan-michael/slack-kudos/pkg/handler/handlertest"
+	"github.com/kaplan-michael/slack-kudos/pkg/kudos"
+	"github.com/slack-go/slack/slackevents"
+)
+
+func TestAnonKudosHidesGiver(t *testing.T) {
+	ctx := context.Background()
+	client := handlertest.Setup(t, "T1")
+
+	req := handlertest.Message("T1", "D1", "U1", "anon <@U2> ++ for the help")
+	msgEvent := req.Event.InnerEvent.Data.(*slackevents.MessageEvent)
+	msgEvent.ChannelType = "im"
+	if !req.Private() {
+		t.Errorf("Private() = false, want true for a DM")
+	}
+
+	// Retried, it's still given once
+	for i := 0; i < 2; i++ {
+		if err := client.Dispatch(ctx, req); err != nil {
+			t.Fatalf("Dispatch() error = %v", err)
+		}
+	}
+
+	count, _, err := kudos.Stats(ctx, "T1", "U2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("count = %d, want 1", count)
+	}
+
+	k, err := kudos.Get(ctx, "T1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.GiverID != "" || k.ChannelID == "D1" || k.MessageTS != "" {
+		t.Errorf("kudos = %+v, want no giver, DM channel or message", k)
+	}
+	if strings.Contains(k.SourceID, "D1") || strings.Contains(k.SourceID, msgEvent.TimeStamp) {
+		t.Errorf("SourceID = %q, want the DM hidden", k.SourceID)
+	}
+	if giver, err := kudos.RevealGiver(k); err != nil || giver != "U1" {
+		t.Errorf("RevealGiver() = %q, %v, want U1", giver, err)
+	}
+}
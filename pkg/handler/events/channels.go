@@ -0,0 +1,108 @@
+package events
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/charmbracelet/log"
+	"github.com/kaplan-michael/slack-kudos/pkg/channels"
+	"github.com/kaplan-michael/slack-kudos/pkg/kudos"
+	"github.com/kaplan-michael/slack-kudos/pkg/messages"
+	"github.com/kaplan-michael/slack-kudos/pkg/oauth2"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+	"github.com/kaplan-michael/slack-kudos/pkg/settings"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// HandleMemberJoined welcomes the channel with a short usage guide when the
+// bot itself joins it, and remembers the channel as active.
+func HandleMemberJoined(ctx context.Context, client respond.Responder, teamID string, ev *slackevents.MemberJoinedChannelEvent) error {
+	isBot, err := isBotUser(ctx, teamID, ev.User)
+	if err != nil || !isBot {
+		return err
+	}
+
+	if err := channels.MarkActive(ctx, teamID, ev.Channel); err != nil {
+		log.FromContext(ctx).Warnf("Failed to remember channel %s in workspace %s: %v", ev.Channel, teamID, err)
+	}
+
+	log.FromContext(ctx).Infof("Bot joined channel %s in workspace %s", ev.Channel, teamID)
+
+	msg, err := welcomeMessage(ctx, client, teamID, ev.Channel, ev.Inviter)
+	if err != nil {
+		return err
+	}
+	_, err = respond.Channel(ctx, client, ev.Channel, msg)
+	return err
+}
+
+// HandleMemberLeft forgets the channel when the bot is removed from it.
+func HandleMemberLeft(ctx context.Context, client respond.Responder, teamID string, ev *slackevents.MemberLeftChannelEvent) error {
+	isBot, err := isBotUser(ctx, teamID, ev.User)
+	if err != nil || !isBot {
+		return err
+	}
+
+	log.FromContext(ctx).Infof("Bot left channel %s in workspace %s", ev.Channel, teamID)
+	return channels.MarkInactive(ctx, teamID, ev.Channel)
+}
+
+// isBotUser reports whether the user is the bot user of the workspace.
+func isBotUser(ctx context.Context, teamID, userID string) (bool, error) {
+	creds, err := oauth2.GetWorkspaceCredentials(ctx, teamID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get bot user of workspace %s: %w", teamID, err)
+	}
+	return creds.BotUserID != "" && creds.BotUserID == userID, nil
+}
+
+// welcomeMessage renders the usage guide and setup checklist for a channel,
+// in the language of the user who invited the bot.
+func welcomeMessage(ctx context.Context, client respond.Responder, teamID, channelID, inviterID string) (messages.Message, error) {
+	locale := messages.DefaultLocale
+	if inviterID != "" {
+		locale = messages.Locale(ctx, client, teamID, inviterID)
+	}
+
+	mode := respond.ModeFor(ctx, teamID, channelID)
+
+	milestones, err := settings.Get(ctx, teamID, settings.Milestones)
+	if err != nil {
+		log.FromContext(ctx).Warnf("Failed to get milestones for workspace %s: %v", teamID, err)
+	}
+
+	allowMinusMinus, err := settings.GetBool(ctx, teamID, settings.AllowMinusMinus)
+	if err != nil {
+		log.FromContext(ctx).Warnf("Failed to get minus-minus setting for workspace %s: %v", teamID, err)
+	}
+
+	badge, err := kudos.GetBadge(ctx, teamID, firstMilestone(milestones))
+	if err != nil {
+		log.FromContext(ctx).Warnf("Failed to get first badge for workspace %s: %v", teamID, err)
+	}
+
+	return messages.Render(ctx, teamID, locale, "welcome", messages.Data{
+		"ChannelID":       channelID,
+		"ResponseMode":    mode,
+		"Milestones":      milestones,
+		"AllowMinusMinus": allowMinusMinus,
+		"Emoji":           badge.Emoji,
+		"BadgeName":       badge.Name,
+		"Threshold":       badge.Threshold,
+	})
+}
+
+// firstMilestone returns the lowest milestone in a milestones setting value.
+func firstMilestone(value string) int {
+	list, err := settings.ParseIntList(value)
+	if err != nil || len(list) == 0 {
+		return 0
+	}
+	lowest := list[0]
+	for _, m := range list[1:] {
+		if m < lowest {
+			lowest = m
+		}
+	}
+	return lowest
+}
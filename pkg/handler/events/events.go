@@ -1,28 +1,86 @@
 package events
 
 import (
-	"regexp"
+	"context"
+	"errors"
 
+	"github.com/kaplan-michael/slack-kudos/pkg/messages"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
 	"github.com/slack-go/slack/slackevents"
-	"github.com/slack-go/slack/socketmode"
 )
 
 // MessageHandler defines the interface for all message handlers.
 type MessageHandler interface {
 	Matches(text string) bool
-	Handle(client *socketmode.Client, msgEvent *slackevents.MessageEvent) error
+	Handle(ctx context.Context, client respond.Responder, teamID string, msgEvent *slackevents.MessageEvent) error
 }
 
-// RegexMessageHandler implements the MessageHandler interface with a regex pattern.
-type RegexMessageHandler struct {
-	Pattern    *regexp.Regexp
-	HandleFunc func(client *socketmode.Client, msgEvent *slackevents.MessageEvent) error
+// Priorities of the built-in message handlers. Every handler matching a
+// message handles it, the ones with higher priorities first.
+const (
+	PriorityAnon  = 100
+	PriorityKudos = 50
+)
+
+// Stop marks the result of a message handler, so that the handlers after it
+// don't handle the message. The error may be nil.
+func Stop(err error) error {
+	return &stopError{err: err}
+}
+
+type stopError struct {
+	err error
+}
+
+func (e *stopError) Error() string {
+	if e.err == nil {
+		return "message handling stopped"
+	}
+	return e.err.Error()
+}
+
+func (e *stopError) Unwrap() error {
+	return e.err
+}
+
+// Stopped reports whether a handler's result is marked with Stop, and
+// returns the handler's error without the mark.
+func Stopped(err error) (bool, error) {
+	var stop *stopError
+	if errors.As(err, &stop) {
+		return true, stop.err
+	}
+	return false, err
+}
+
+// TokenMessageHandler implements the MessageHandler interface with a
+// matcher over the tokenized message text, see Tokenize.
+type TokenMessageHandler struct {
+	Match      func(tokens []Token) bool
+	HandleFunc func(ctx context.Context, client respond.Responder, teamID string, msgEvent *slackevents.MessageEvent) error
+	// Final handlers stop the message from being handled by the handlers
+	// after them, see Stop
+	Final bool
+}
+
+func (h *TokenMessageHandler) Matches(text string) bool {
+	return h.Match(Tokenize(text))
 }
 
-func (h *RegexMessageHandler) Matches(text string) bool {
-	return h.Pattern.MatchString(text)
+func (h *TokenMessageHandler) Handle(ctx context.Context, client respond.Responder, teamID string, msgEvent *slackevents.MessageEvent) error {
+	err := h.HandleFunc(ctx, client, teamID, msgEvent)
+	if h.Final {
+		return Stop(err)
+	}
+	return err
 }
 
-func (h *RegexMessageHandler) Handle(client *socketmode.Client, msgEvent *slackevents.MessageEvent) error {
-	return h.HandleFunc(client, msgEvent)
+// postNotice renders a notice and posts it to the channel.
+func postNotice(ctx context.Context, client respond.Responder, teamID, locale, channelID, key string, data messages.Data) error {
+	msg, err := messages.Notice(ctx, teamID, locale, key, data)
+	if err != nil {
+		return err
+	}
+	_, err = respond.Channel(ctx, client, channelID, msg)
+	return err
 }
@@ -1,103 +1,183 @@
 package events
 
 import (
+	"context"
 	"fmt"
-	"regexp"
+	"strings"
 
 	"github.com/charmbracelet/log"
-	"github.com/kaplan-michael/slack-kudos/pkg/database"
-	"github.com/slack-go/slack"
+	"github.com/kaplan-michael/slack-kudos/pkg/kudos"
+	"github.com/kaplan-michael/slack-kudos/pkg/messages"
+	"github.com/kaplan-michael/slack-kudos/pkg/notify"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+	"github.com/kaplan-michael/slack-kudos/pkg/settings"
+	"github.com/kaplan-michael/slack-kudos/pkg/wall"
 	"github.com/slack-go/slack/slackevents"
-	"github.com/slack-go/slack/socketmode"
 )
 
-func NewKudosHandler() *RegexMessageHandler {
-	return &RegexMessageHandler{
-		Pattern:    regexp.MustCompile(`<@(\w+)>\s*\+\+`),
+// UndoActionID is the action ID of the "Undo" button on kudos confirmations.
+const UndoActionID = "kudos_undo"
+
+// trigger is a "@user ++" or "@user --" found in a message.
+type trigger struct {
+	UserID   string
+	Operator string
+	// End is the byte offset of the end of the operator in the text
+	End int
+}
+
+func NewKudosHandler() *TokenMessageHandler {
+	return &TokenMessageHandler{
+		Match: func(tokens []Token) bool {
+			_, ok := findKudos(tokens)
+			return ok
+		},
 		HandleFunc: handleKudos,
 	}
 }
 
 // handleKudos processes messages that give kudos to users.
-func handleKudos(client *socketmode.Client, msgEvent *slackevents.MessageEvent) error {
-	// Get team ID using auth test
-	api := client.Client
-	authInfo, err := api.AuthTest()
-	if err != nil {
-		log.Warnf("Error getting team ID from auth test: %v", err)
-		return fmt.Errorf("could not get team info: %w", err)
+func handleKudos(ctx context.Context, client respond.Responder, teamID string, msgEvent *slackevents.MessageEvent) error {
+	userID, operator, reason := extractKudos(msgEvent.Text)
+	if userID == "" {
+		log.FromContext(ctx).Debugf("Ignoring message, could not extract user ID from it")
+		return nil
 	}
 
-	teamID := authInfo.TeamID
-	if teamID == "" {
-		log.Warn("Could not determine team ID for kudos event, skipping")
-		return fmt.Errorf("empty team ID from auth test")
+	amount := 1
+	if operator == "--" {
+		allowed, err := settings.GetBool(ctx, teamID, settings.AllowMinusMinus)
+		if err != nil {
+			return fmt.Errorf("failed to check minus-minus setting: %w", err)
+		}
+		if !allowed {
+			log.FromContext(ctx).Debugf("Ignoring -- for user %s, disabled in workspace %s", userID, teamID)
+			return nil
+		}
+		amount = -1
 	}
 
-	log.Infof("Using team ID: %s", teamID)
+	log.FromContext(ctx).Infof("User %s in workspace %s received %+d kudos", userID, teamID, amount)
+
+	result, err := kudos.Give(ctx, kudos.Kudos{
+		TeamID:      teamID,
+		GiverID:     msgEvent.User,
+		RecipientID: userID,
+		ChannelID:   msgEvent.Channel,
+		MessageTS:   msgEvent.TimeStamp,
+		Amount:      amount,
+		Reason:      reason,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to give kudos to user %s in workspace %s: %w", userID, teamID, err)
+	}
 
-	userID := extractUserID(msgEvent.Text)
-	if userID == "" {
-		return fmt.Errorf("could not extract user ID from message")
+	key := "kudos_given"
+	if amount < 0 {
+		key = "kudos_taken"
+	}
+
+	data := messages.Data{
+		"Key":     key,
+		"UserID":  userID,
+		"Count":   result.Count,
+		"Reason":  messages.UserText(reason),
+		"KudosID": result.Kudos.ID,
 	}
 
-	log.Infof("User %s in workspace %s received kudos", userID, teamID)
+	mode := respond.ModeFor(ctx, teamID, msgEvent.Channel)
 
-	count, err := incrementKudosCount(teamID, userID)
+	undoWindow, err := settings.GetInt(ctx, teamID, settings.UndoWindowMinutes)
 	if err != nil {
-		return fmt.Errorf("failed to increment kudos for user %s in workspace %s: %v", userID, teamID, err)
+		log.FromContext(ctx).Warnf("Failed to get undo window for workspace %s: %v", teamID, err)
+	}
+	if undoWindow > 0 && respond.Interactive(mode) {
+		data["UndoActionID"] = UndoActionID
 	}
 
-	response := fmt.Sprintf("<@%s> got a kudos! 🎉\n Now has %d kudos in this workspace!", userID, count)
-	_, _, err = client.PostMessage(msgEvent.Channel, slack.MsgOptionText(response, false))
-	return err
-}
+	locale := messages.Locale(ctx, client, teamID, msgEvent.User)
+	msg, err := messages.Render(ctx, teamID, locale, "kudos", data)
+	if err != nil {
+		return err
+	}
 
-// extractUserID extracts a user ID from the message text.
-func extractUserID(text string) string {
-	re := regexp.MustCompile(`<@(\w+)>`)
-	matches := re.FindStringSubmatch(text)
-	if len(matches) > 1 {
-		return matches[1]
+	target := respond.Target{
+		TeamID:      teamID,
+		ChannelID:   msgEvent.Channel,
+		MessageTS:   msgEvent.TimeStamp,
+		ThreadTS:    msgEvent.ThreadTimeStamp,
+		UserID:      msgEvent.User,
+		RecipientID: userID,
 	}
-	return ""
-}
 
-// Note: This function is no longer used as we get the team ID directly
-// from the API or command data
+	// A retried event only redoes what failed before, see kudos.Result.Deliver
+	err = result.Deliver(ctx, kudos.StepAnnounce, func() error {
+		_, _, err := respond.Send(ctx, client, mode, target, msg)
+		return err
+	})
+	if err != nil {
+		return err
+	}
 
-// incrementKudosCount increments the kudos count for the given user and returns the new count.
-func incrementKudosCount(teamID, userID string) (int, error) {
-	var newCount int
+	// The dm mode already told the recipient
+	if mode != settings.ModeDM {
+		err := result.Deliver(ctx, kudos.StepNotify, func() error {
+			return notify.Recipient(ctx, client, result.Kudos)
+		})
+		if err != nil {
+			log.FromContext(ctx).Warnf("Failed to notify user %s about kudos %d: %v", userID, result.Kudos.ID, err)
+		}
+	}
 
-	// First check if workspace exists (to avoid foreign key constraint error)
-	var count int
-	err := database.DB.QueryRow(`SELECT COUNT(*) FROM workspaces WHERE team_id = ?`, teamID).Scan(&count)
+	err = result.Deliver(ctx, kudos.StepWall, func() error {
+		return wall.Post(ctx, client, result)
+	})
 	if err != nil {
-		log.Warnf("Error checking if workspace exists: %v", err)
-		return 0, fmt.Errorf("error checking workspace: %w", err)
+		log.FromContext(ctx).Warnf("Failed to cross-post kudos %d to the kudos wall: %v", result.Kudos.ID, err)
 	}
 
-	// If the workspace doesn't exist in our database, we can't record kudos yet
-	if count == 0 {
-		log.Warnf("Workspace %s not found in database. Make sure OAuth setup is complete.", teamID)
-		return 0, fmt.Errorf("workspace %s not found in database", teamID)
+	return result.Deliver(ctx, kudos.StepCelebrate, func() error {
+		return Celebrate(ctx, client, locale, mode, target, result.Badges)
+	})
+}
+
+// extractKudos extracts the recipient, the operator (++ or --) and the
+// optional reason following it from the message text.
+func extractKudos(text string) (userID, operator, reason string) {
+	t, ok := findKudos(Tokenize(text))
+	if !ok {
+		return "", "", ""
 	}
+	reason = strings.TrimSpace(text[t.End:])
+	if i := strings.IndexByte(reason, '\n'); i >= 0 {
+		reason = strings.TrimSpace(reason[:i])
+	}
+	return t.UserID, t.Operator, reason
+}
 
-	// Using workspace_kudos table for multi-tenant support
-	err = database.DB.QueryRow(`
-        INSERT INTO workspace_kudos (team_id, user_id, count) 
-        VALUES (?, ?, 1) 
-        ON CONFLICT(team_id, user_id) 
-        DO UPDATE SET count = count + 1 
-        WHERE team_id = ? AND user_id = ?
-        RETURNING count;`, teamID, userID, teamID, userID).Scan(&newCount)
+// findKudos finds the first user mention directly followed by ++ or --.
+// Mentions in code and quotes don't count.
+func findKudos(tokens []Token) (trigger, bool) {
+	for i := 0; i+1 < len(tokens); i++ {
+		if t, ok := operatorAfter(tokens[i], tokens[i+1]); ok {
+			return t, true
+		}
+	}
+	return trigger{}, false
+}
 
-	if err != nil {
-		log.Warnf("Failed to increment and fetch kudos count for user %s in workspace %s: %v", userID, teamID, err)
-		return 0, err
+// operatorAfter checks whether the mention token is followed by ++ or --.
+func operatorAfter(mention, next Token) (trigger, bool) {
+	if mention.Kind != TokenMention || mention.Mention.Kind != MentionUser || next.Kind != TokenText {
+		return trigger{}, false
 	}
 
-	log.Infof("Incremented kudos count for user %s in workspace %s, now has %d", userID, teamID, newCount)
-	return newCount, nil
+	rest := strings.TrimLeft(next.Text, " \t")
+	for _, operator := range []string{"++", "--"} {
+		if strings.HasPrefix(rest, operator) {
+			end := next.End - len(rest) + len(operator)
+			return trigger{UserID: mention.Mention.ID, Operator: operator, End: end}, true
+		}
+	}
+	return trigger{}, false
 }
@@ -0,0 +1,164 @@
+package events_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kaplan-michael/slack-kudos/pkg/handler/handlertest"
+	"github.com/kaplan-michael/slack-kudos/pkg/kudos"
+	"github.com/kaplan-michael/slack-kudos/pkg/settings"
+	"github.com/slack-go/slack"
+)
+
+func TestKudos(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		settings map[string]string
+		// count is the recipient's kudos after the message
+		count int
+		// reply is a part of the confirmation, empty when there's none
+		reply string
+	}{
+		{name: "plus plus", text: "<@U2> ++", count: 1, reply: "<@U2> got a kudos!"},
+		{name: "with reason", text: "<@U2> ++ for the review", count: 1, reply: "For: for the review"},
+		{name: "label", text: "thanks <@U2|bob>++", count: 1, reply: "<@U2> got a kudos!"},
+		{name: "minus minus disabled", text: "<@U2> --", count: 0},
+		{name: "minus minus", text: "<@U2> --", settings: map[string]string{settings.AllowMinusMinus: "true"}, count: -1, reply: "<@U2>"},
+		{name: "in code", text: "`<@U2> ++`", count: 0},
+		{name: "in code block", text: "```\n<@U2> ++\n```", count: 0},
+		{name: "in quote", text: "&gt; <@U2> ++", count: 0},
+		{name: "not followed by operator", text: "<@U2> did ++", count: 0},
+		{name: "special mention in reason", text: "<@U2> ++ <!channel> <!subteam^S1|@devs>", count: 1, reply: "For: @channel @devs"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			client := handlertest.Setup(t, "T1")
+			for key, value := range tt.settings {
+				if err := settings.Set(ctx, "T1", key, value); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := client.Dispatch(ctx, handlertest.Message("T1", "C1", "U1", tt.text)); err != nil {
+				t.Fatalf("Dispatch() error = %v", err)
+			}
+
+			count, _, err := kudos.Stats(ctx, "T1", "U2")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != tt.count {
+				t.Errorf("count = %d, want %d", count, tt.count)
+			}
+
+			calls := client.Calls()
+			if tt.reply == "" {
+				if len(calls) != 0 {
+					t.Errorf("calls = %+v, want none", calls)
+				}
+				return
+			}
+			if len(calls) != 1 || calls[0].Method != "chat.postMessage" || calls[0].ChannelID != "C1" {
+				t.Fatalf("calls = %+v, want one chat.postMessage in C1", calls)
+			}
+			reply := calls[0].Content()
+			if !strings.Contains(reply, tt.reply) {
+				t.Errorf("reply = %s, want %q in it", reply, tt.reply)
+			}
+			if strings.Contains(reply, "<!") {
+				t.Errorf("reply = %s, want no special mentions in it", reply)
+			}
+		})
+	}
+}
+
+func TestKudosRetried(t *testing.T) {
+	ctx := context.Background()
+	client := handlertest.Setup(t, "T1")
+
+	// Slack delivers an event again when it isn't acknowledged in time
+	req := handlertest.Message("T1", "C1", "U1", "<@U2> ++")
+	for i := 0; i < 2; i++ {
+		if err := client.Dispatch(ctx, req); err != nil {
+			t.Fatalf("Dispatch() error = %v", err)
+		}
+	}
+
+	count, _, err := kudos.Stats(ctx, "T1", "U2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("count = %d, want 1", count)
+	}
+	if calls := client.Calls(); len(calls) != 1 {
+		t.Errorf("calls = %+v, want one confirmation", calls)
+	}
+}
+
+func TestKudosSeparateMessages(t *testing.T) {
+	ctx := context.Background()
+	client := handlertest.Setup(t, "T1")
+
+	for i := 0; i < 3; i++ {
+		if err := client.Dispatch(ctx, handlertest.Message("T1", "C1", "U1", "<@U2> ++")); err != nil {
+			t.Fatalf("Dispatch() error = %v", err)
+		}
+	}
+
+	count, _, err := kudos.Stats(ctx, "T1", "U2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("count = %d, want 3", count)
+	}
+}
+
+func TestKudosRetriedAfterFailure(t *testing.T) {
+	ctx := context.Background()
+	client := handlertest.Setup(t, "T1")
+	if err := settings.Set(ctx, "T1", settings.Milestones, "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The confirmation fails, the retry has to post it and celebrate the
+	// badge the kudos earned the first time
+	client.FailNext("chat.postMessage", slack.SlackErrorResponse{Err: "internal_error"})
+	req := handlertest.Message("T1", "C1", "U1", "<@U2> ++")
+	if err := client.Dispatch(ctx, req); err == nil {
+		t.Fatal("Dispatch() error = nil, want the failed confirmation")
+	}
+	if calls := client.Calls(); len(calls) != 0 {
+		t.Fatalf("calls = %+v, want none", calls)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := client.Dispatch(ctx, req); err != nil {
+			t.Fatalf("Dispatch() error = %v", err)
+		}
+	}
+
+	count, _, err := kudos.Stats(ctx, "T1", "U2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("count = %d, want 1", count)
+	}
+
+	calls := client.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("calls = %+v, want the confirmation and the milestone once", calls)
+	}
+	if reply := calls[0].Content(); !strings.Contains(reply, "<@U2> got a kudos!") {
+		t.Errorf("confirmation = %s, want the kudos in it", reply)
+	}
+	if milestone := calls[1].Content(); !strings.Contains(milestone, "Kudos") {
+		t.Errorf("milestone = %s, want the badge in it", milestone)
+	}
+}
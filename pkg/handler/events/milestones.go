@@ -0,0 +1,58 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/kaplan-michael/slack-kudos/pkg/kudos"
+	"github.com/kaplan-michael/slack-kudos/pkg/messages"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+	"github.com/kaplan-michael/slack-kudos/pkg/settings"
+)
+
+// Celebrate responds with a celebratory message for every badge the
+// recipient just earned, following the channel's response mode, and
+// announces it in the milestone channel.
+func Celebrate(ctx context.Context, client respond.Responder, locale, mode string, target respond.Target, badges []kudos.Badge) error {
+	if len(badges) == 0 {
+		return nil
+	}
+
+	teamID := target.TeamID
+	userID := target.RecipientID
+
+	announceChannel, err := settings.Get(ctx, teamID, settings.MilestoneChannel)
+	if err != nil {
+		log.FromContext(ctx).Warnf("Failed to get milestone channel for workspace %s: %v", teamID, err)
+	}
+
+	for _, badge := range badges {
+		msg, err := messages.Render(ctx, teamID, locale, "milestone", messages.Data{
+			"UserID":    userID,
+			"Threshold": badge.Threshold,
+			"BadgeName": badge.Name,
+			"Emoji":     badge.Emoji,
+		})
+		if err != nil {
+			return err
+		}
+
+		// In the reaction mode the badge's emoji is the celebration
+		target.Reaction = strings.Trim(badge.Emoji, ":")
+		if _, _, err := respond.Send(ctx, client, mode, target, msg); err != nil {
+			return fmt.Errorf("failed to post milestone message: %w", err)
+		}
+
+		if announceChannel != "" && announceChannel != target.ChannelID {
+			if _, err := respond.Channel(ctx, client, announceChannel, msg); err != nil {
+				return fmt.Errorf("failed to announce milestone: %w", err)
+			}
+		}
+
+		log.FromContext(ctx).Infof("User %s earned the %s badge in workspace %s", userID, badge.Name, teamID)
+	}
+
+	return nil
+}
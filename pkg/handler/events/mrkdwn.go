@@ -0,0 +1,178 @@
+package events
+
+import "strings"
+
+// TokenKind is the kind of a token in Slack mrkdwn text.
+type TokenKind int
+
+const (
+	// TokenText is plain text
+	TokenText TokenKind = iota
+	// TokenMention is a user, user group, channel or special mention like <@U123>
+	TokenMention
+	// TokenLink is any other <...> entity, e.g. a URL or a date
+	TokenLink
+	// TokenCode is inline code between backticks
+	TokenCode
+	// TokenCodeBlock is a ``` fenced code block
+	TokenCodeBlock
+	// TokenQuote is a quoted line (> ...) or the rest of a message after >>>
+	TokenQuote
+)
+
+// MentionKind is the kind of entity a mention refers to.
+type MentionKind string
+
+const (
+	MentionUser    MentionKind = "user"
+	MentionSubteam MentionKind = "subteam"
+	MentionChannel MentionKind = "channel"
+	// MentionSpecial is @here, @channel or @everyone
+	MentionSpecial MentionKind = "special"
+)
+
+// Mention is a mention of a user, user group, channel or everyone.
+type Mention struct {
+	Kind MentionKind
+	// ID is the user, user group or channel ID, or the name of a special mention
+	ID string
+	// Label is the optional display label, e.g. "name" in <@U123|name>
+	Label string
+	// Start and End are the byte offsets of the mention in the text
+	Start int
+	End   int
+}
+
+// Token is a piece of Slack mrkdwn text.
+type Token struct {
+	Kind TokenKind
+	Text string
+	// Start and End are the byte offsets of the token in the text
+	Start int
+	End   int
+	// Mention is set for TokenMention tokens
+	Mention Mention
+}
+
+// Tokenize splits Slack mrkdwn text, as received in events, into tokens.
+// Mentions inside code and quotes are not reported as mentions, they are
+// part of the code or quote token.
+func Tokenize(text string) []Token {
+	var tokens []Token
+	textStart := 0
+
+	emit := func(kind TokenKind, start, end int) *Token {
+		if textStart < start {
+			tokens = append(tokens, Token{Kind: TokenText, Text: text[textStart:start], Start: textStart, End: start})
+		}
+		tokens = append(tokens, Token{Kind: kind, Text: text[start:end], Start: start, End: end})
+		textStart = end
+		return &tokens[len(tokens)-1]
+	}
+
+	lineStart := true
+	for i := 0; i < len(text); {
+		rest := text[i:]
+
+		if lineStart {
+			lineStart = false
+
+			// >>> quotes everything that follows
+			if strings.HasPrefix(rest, "&gt;&gt;&gt;") || strings.HasPrefix(rest, ">>>") {
+				emit(TokenQuote, i, len(text))
+				i = len(text)
+				continue
+			}
+
+			// > quotes the rest of the line
+			if strings.HasPrefix(rest, "&gt;") || strings.HasPrefix(rest, ">") {
+				end := lineEnd(text, i)
+				emit(TokenQuote, i, end)
+				i = end
+				continue
+			}
+		}
+
+		switch {
+		case strings.HasPrefix(rest, "```"):
+			if end := strings.Index(rest[3:], "```"); end >= 0 {
+				end = i + 3 + end + 3
+				emit(TokenCodeBlock, i, end)
+				i = end
+				continue
+			}
+
+		case rest[0] == '`':
+			if end := strings.IndexAny(rest[1:], "`\n"); end > 0 && rest[1+end] == '`' {
+				end = i + 1 + end + 1
+				emit(TokenCode, i, end)
+				i = end
+				continue
+			}
+
+		case rest[0] == '<':
+			if end := strings.IndexAny(rest[1:], ">\n"); end >= 0 && rest[1+end] == '>' {
+				inner := rest[1 : 1+end]
+				end = i + 1 + end + 1
+				if mention, ok := parseMention(inner); ok {
+					mention.Start, mention.End = i, end
+					emit(TokenMention, i, end).Mention = mention
+				} else {
+					emit(TokenLink, i, end)
+				}
+				i = end
+				continue
+			}
+
+		case rest[0] == '\n':
+			lineStart = true
+		}
+
+		i++
+	}
+
+	if textStart < len(text) {
+		tokens = append(tokens, Token{Kind: TokenText, Text: text[textStart:], Start: textStart, End: len(text)})
+	}
+
+	return tokens
+}
+
+// Mentions returns the mentions in the text, outside of code and quotes.
+func Mentions(text string) []Mention {
+	var mentions []Mention
+	for _, token := range Tokenize(text) {
+		if token.Kind == TokenMention {
+			mentions = append(mentions, token.Mention)
+		}
+	}
+	return mentions
+}
+
+// parseMention parses the inside of a <...> entity as a mention.
+func parseMention(inner string) (Mention, bool) {
+	var label string
+	if i := strings.IndexByte(inner, '|'); i >= 0 {
+		inner, label = inner[:i], inner[i+1:]
+	}
+
+	switch {
+	case strings.HasPrefix(inner, "@") && len(inner) > 1:
+		return Mention{Kind: MentionUser, ID: inner[1:], Label: label}, true
+	case strings.HasPrefix(inner, "#") && len(inner) > 1:
+		return Mention{Kind: MentionChannel, ID: inner[1:], Label: label}, true
+	case strings.HasPrefix(inner, "!subteam^") && len(inner) > len("!subteam^"):
+		return Mention{Kind: MentionSubteam, ID: inner[len("!subteam^"):], Label: label}, true
+	case inner == "!here" || inner == "!channel" || inner == "!everyone":
+		return Mention{Kind: MentionSpecial, ID: inner[1:], Label: label}, true
+	}
+	return Mention{}, false
+}
+
+// lineEnd returns the offset of the end of the line starting at or before i.
+func lineEnd(text string, i int) int {
+	if end := strings.IndexByte(text[i:], '\n'); end >= 0 {
+		return i + end
+	}
+	return len(text)
+}
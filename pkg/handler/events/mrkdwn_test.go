@@ -0,0 +1,176 @@
+package events
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	user := func(text, id, label string) Token {
+		return Token{Kind: TokenMention, Text: text, Mention: Mention{Kind: MentionUser, ID: id, Label: label}}
+	}
+
+	tests := []struct {
+		name string
+		text string
+		want []Token
+	}{
+		{name: "empty", text: "", want: nil},
+		{name: "plain text", text: "thanks", want: []Token{{Kind: TokenText, Text: "thanks"}}},
+		{
+			name: "user mention",
+			text: "<@U123> ++",
+			want: []Token{user("<@U123>", "U123", ""), {Kind: TokenText, Text: " ++"}},
+		},
+		{
+			name: "user mention with label",
+			text: "hi <@U123|bob>++",
+			want: []Token{{Kind: TokenText, Text: "hi "}, user("<@U123|bob>", "U123", "bob"), {Kind: TokenText, Text: "++"}},
+		},
+		{
+			name: "label with spaces",
+			text: "<@U123|bob smith>",
+			want: []Token{user("<@U123|bob smith>", "U123", "bob smith")},
+		},
+		{
+			name: "other mentions",
+			text: "<#C1|general> <!subteam^S1|@devs> <!here>",
+			want: []Token{
+				{Kind: TokenMention, Text: "<#C1|general>", Mention: Mention{Kind: MentionChannel, ID: "C1", Label: "general"}},
+				{Kind: TokenText, Text: " "},
+				{Kind: TokenMention, Text: "<!subteam^S1|@devs>", Mention: Mention{Kind: MentionSubteam, ID: "S1", Label: "@devs"}},
+				{Kind: TokenText, Text: " "},
+				{Kind: TokenMention, Text: "<!here>", Mention: Mention{Kind: MentionSpecial, ID: "here"}},
+			},
+		},
+		{
+			name: "link",
+			text: "see <https://example.com|this>",
+			want: []Token{{Kind: TokenText, Text: "see "}, {Kind: TokenLink, Text: "<https://example.com|this>"}},
+		},
+		{name: "empty mention", text: "<@>", want: []Token{{Kind: TokenLink, Text: "<@>"}}},
+		{
+			name: "escaped quote",
+			text: "&gt; <@U123> ++\n<@U456> ++",
+			want: []Token{
+				{Kind: TokenQuote, Text: "&gt; <@U123> ++"},
+				{Kind: TokenText, Text: "\n"},
+				user("<@U456>", "U456", ""),
+				{Kind: TokenText, Text: " ++"},
+			},
+		},
+		{
+			name: "quote",
+			text: "> <@U123> ++",
+			want: []Token{{Kind: TokenQuote, Text: "> <@U123> ++"}},
+		},
+		{
+			name: "escaped block quote",
+			text: "ok\n&gt;&gt;&gt; <@U123> ++\n<@U456> ++",
+			want: []Token{{Kind: TokenText, Text: "ok\n"}, {Kind: TokenQuote, Text: "&gt;&gt;&gt; <@U123> ++\n<@U456> ++"}},
+		},
+		{
+			name: "quote marker inside a line",
+			text: "a &gt; <@U123>",
+			want: []Token{{Kind: TokenText, Text: "a &gt; "}, user("<@U123>", "U123", "")},
+		},
+		{
+			name: "inline code",
+			text: "`<@U123> ++` <@U456>",
+			want: []Token{{Kind: TokenCode, Text: "`<@U123> ++`"}, {Kind: TokenText, Text: " "}, user("<@U456>", "U456", "")},
+		},
+		{
+			name: "unclosed backtick",
+			text: "`<@U123> ++",
+			want: []Token{{Kind: TokenText, Text: "`"}, user("<@U123>", "U123", ""), {Kind: TokenText, Text: " ++"}},
+		},
+		{
+			name: "backtick closed on the next line",
+			text: "`<@U123>\n` ++",
+			want: []Token{{Kind: TokenText, Text: "`"}, user("<@U123>", "U123", ""), {Kind: TokenText, Text: "\n` ++"}},
+		},
+		{
+			name: "code block",
+			text: "```\n<@U123> ++\n``` <@U456>",
+			want: []Token{{Kind: TokenCodeBlock, Text: "```\n<@U123> ++\n```"}, {Kind: TokenText, Text: " "}, user("<@U456>", "U456", "")},
+		},
+		{
+			name: "unclosed code block",
+			text: "```<@U123>",
+			want: []Token{{Kind: TokenText, Text: "```"}, user("<@U123>", "U123", "")},
+		},
+		{
+			name: "angle bracket split across lines",
+			text: "<@U123\n> ++",
+			want: []Token{{Kind: TokenText, Text: "<@U123\n"}, {Kind: TokenQuote, Text: "> ++"}},
+		},
+		{
+			name: "unclosed angle bracket",
+			text: "<@U123 ++",
+			want: []Token{{Kind: TokenText, Text: "<@U123 ++"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Tokenize(tt.text)
+
+			// Tokens cover the text without gaps
+			end := 0
+			for _, token := range got {
+				if token.Start != end || tt.text[token.Start:token.End] != token.Text {
+					t.Errorf("token %+v doesn't follow offset %d", token, end)
+				}
+				if token.Kind == TokenMention && (token.Mention.Start != token.Start || token.Mention.End != token.End) {
+					t.Errorf("mention %+v isn't at its token's offsets", token.Mention)
+				}
+				end = token.End
+			}
+			if end != len(tt.text) {
+				t.Errorf("tokens end at %d, want %d", end, len(tt.text))
+			}
+
+			if !reflect.DeepEqual(withoutOffsets(got), tt.want) {
+				t.Errorf("Tokenize(%q) =\n%+v\nwant\n%+v", tt.text, withoutOffsets(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractKudos(t *testing.T) {
+	tests := []struct {
+		text     string
+		userID   string
+		operator string
+		reason   string
+	}{
+		{text: "<@U1> ++", userID: "U1", operator: "++"},
+		{text: "<@U1>++ for the review", userID: "U1", operator: "++", reason: "for the review"},
+		{text: "<@U1|bob> -- oops", userID: "U1", operator: "--", reason: "oops"},
+		{text: "<@U1> ++ first line\nsecond line", userID: "U1", operator: "++", reason: "first line"},
+		{text: "thanks <@U1> and <@U2> ++", userID: "U2", operator: "++"},
+		{text: "`<@U1> ++`"},
+		{text: "&gt; <@U1> ++"},
+		{text: "<@U1> +"},
+	}
+
+	for _, tt := range tests {
+		userID, operator, reason := extractKudos(tt.text)
+		if userID != tt.userID || operator != tt.operator || reason != tt.reason {
+			t.Errorf("extractKudos(%q) = %q, %q, %q, want %q, %q, %q",
+				tt.text, userID, operator, reason, tt.userID, tt.operator, tt.reason)
+		}
+	}
+}
+
+// withoutOffsets clears the offsets of the tokens, to compare their kinds
+// and texts.
+func withoutOffsets(tokens []Token) []Token {
+	var cleared []Token
+	for _, token := range tokens {
+		token.Start, token.End = 0, 0
+		token.Mention.Start, token.Mention.End = 0, 0
+		cleared = append(cleared, token)
+	}
+	return cleared
+}
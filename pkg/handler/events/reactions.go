@@ -0,0 +1,33 @@
+package events
+
+import (
+	"context"
+
+	"github.com/kaplan-michael/slack-kudos/pkg/kudos"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// HandleReactionAdded counts reactions to kudos messages, for the digest's shout-out.
+func HandleReactionAdded(ctx context.Context, client respond.Responder, teamID string, ev *slackevents.ReactionAddedEvent) error {
+	return countReaction(ctx, teamID, ev.User, ev.Item, 1)
+}
+
+// HandleReactionRemoved stops counting a removed reaction.
+func HandleReactionRemoved(ctx context.Context, client respond.Responder, teamID string, ev *slackevents.ReactionRemovedEvent) error {
+	return countReaction(ctx, teamID, ev.User, ev.Item, -1)
+}
+
+func countReaction(ctx context.Context, teamID, userID string, item slackevents.Item, delta int) error {
+	if item.Type != "message" {
+		return nil
+	}
+
+	// The bot's own reactions, e.g. in the reaction response mode, don't count
+	isBot, err := isBotUser(ctx, teamID, userID)
+	if err != nil || isBot {
+		return err
+	}
+
+	return kudos.AddReactions(ctx, teamID, item.Channel, item.Timestamp, delta)
+}
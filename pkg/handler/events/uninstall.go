@@ -0,0 +1,23 @@
+package events
+
+import (
+	"context"
+
+	"github.com/kaplan-michael/slack-kudos/pkg/oauth2"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// HandleAppUninstalled stops serving a workspace that uninstalled the app.
+func HandleAppUninstalled(ctx context.Context, client respond.Responder, teamID string, ev *slackevents.AppUninstalledEvent) error {
+	return oauth2.Uninstall(ctx, teamID)
+}
+
+// HandleTokensRevoked stops serving a workspace that revoked the bot's token.
+// Revoked user tokens don't matter, the bot only uses its own.
+func HandleTokensRevoked(ctx context.Context, client respond.Responder, teamID string, ev *slackevents.TokensRevokedEvent) error {
+	if len(ev.Tokens.Bot) == 0 {
+		return nil
+	}
+	return oauth2.Uninstall(ctx, teamID)
+}
@@ -0,0 +1,114 @@
+package functions
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+	"github.com/slack-go/slack"
+)
+
+// FunctionExecuted is the type of the event sent when a workflow runs one
+// of the app's custom steps.
+const FunctionExecuted = "function_executed"
+
+// FunctionExecutedEvent is sent when a workflow runs one of the app's custom
+// steps. slack-go doesn't support it yet, see the functionevent dispatcher.
+type FunctionExecutedEvent struct {
+	Type     string `json:"type"`
+	Function struct {
+		ID         string `json:"id"`
+		CallbackID string `json:"callback_id"`
+		Title      string `json:"title"`
+	} `json:"function"`
+	Inputs              map[string]interface{} `json:"inputs"`
+	FunctionExecutionID string                 `json:"function_execution_id"`
+	WorkflowExecutionID string                 `json:"workflow_execution_id"`
+	EventTimestamp      string                 `json:"event_ts"`
+	// BotAccessToken is a token valid for the duration of the execution
+	BotAccessToken string `json:"bot_access_token"`
+}
+
+// StringInput returns a string input of the step, or "" if it wasn't provided.
+func (e *FunctionExecutedEvent) StringInput(name string) string {
+	value, _ := e.Inputs[name].(string)
+	return value
+}
+
+// FunctionHandler defines the interface for all custom step handlers.
+// Handle returns the outputs of the step.
+type FunctionHandler interface {
+	Matches(callbackID string) bool
+	Handle(ctx context.Context, client respond.Responder, teamID string, evt *FunctionExecutedEvent) (map[string]interface{}, error)
+}
+
+// RegexFunctionHandler implements the FunctionHandler interface with a regex pattern.
+type RegexFunctionHandler struct {
+	Pattern    *regexp.Regexp
+	HandleFunc func(ctx context.Context, client respond.Responder, teamID string, evt *FunctionExecutedEvent) (map[string]interface{}, error)
+}
+
+func (h *RegexFunctionHandler) Matches(callbackID string) bool {
+	return h.Pattern.MatchString(callbackID)
+}
+
+func (h *RegexFunctionHandler) Handle(ctx context.Context, client respond.Responder, teamID string, evt *FunctionExecutedEvent) (map[string]interface{}, error) {
+	return h.HandleFunc(ctx, client, teamID, evt)
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// CompleteSuccess reports a successful execution of the step with its outputs.
+func CompleteSuccess(ctx context.Context, evt *FunctionExecutedEvent, outputs map[string]interface{}) error {
+	if outputs == nil {
+		outputs = map[string]interface{}{}
+	}
+	return call(ctx, "functions.completeSuccess", evt.BotAccessToken, map[string]interface{}{
+		"function_execution_id": evt.FunctionExecutionID,
+		"outputs":               outputs,
+	})
+}
+
+// CompleteError reports a failed execution of the step, the error is shown
+// to the workflow's builder.
+func CompleteError(ctx context.Context, evt *FunctionExecutedEvent, message string) error {
+	return call(ctx, "functions.completeError", evt.BotAccessToken, map[string]interface{}{
+		"function_execution_id": evt.FunctionExecutionID,
+		"error":                 message,
+	})
+}
+
+// call calls a Web API method slack-go doesn't have a wrapper for.
+func call(ctx context.Context, method, token string, body interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s request: %w", method, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, slack.APIURL+method, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create %s request: %w", method, err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call %s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	var result slack.SlackResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", method, err)
+	}
+	if !result.Ok {
+		return fmt.Errorf("%s failed: %s", method, result.Error)
+	}
+	return nil
+}
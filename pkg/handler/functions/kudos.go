@@ -0,0 +1,147 @@
+package functions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/charmbracelet/log"
+	"github.com/kaplan-michael/slack-kudos/pkg/handler/events"
+	"github.com/kaplan-michael/slack-kudos/pkg/kudos"
+	"github.com/kaplan-michael/slack-kudos/pkg/messages"
+	"github.com/kaplan-michael/slack-kudos/pkg/notify"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+	"github.com/kaplan-michael/slack-kudos/pkg/settings"
+	"github.com/kaplan-michael/slack-kudos/pkg/wall"
+)
+
+// GiveKudosCallbackID is the callback ID of the "Give kudos" step in the manifest.
+const GiveKudosCallbackID = "give_kudos"
+
+func NewGiveKudosHandler() *RegexFunctionHandler {
+	return &RegexFunctionHandler{
+		Pattern:    regexp.MustCompile(`^` + GiveKudosCallbackID + `$`),
+		HandleFunc: handleGiveKudos,
+	}
+}
+
+// handleGiveKudos runs the "Give kudos" workflow step, giving kudos to the
+// recipient and announcing it in the optional channel. The step is held to
+// the limits of kudos given in messages: it needs a giver other than the
+// recipient, and a channel the bot listens in.
+func handleGiveKudos(ctx context.Context, client respond.Responder, teamID string, evt *FunctionExecutedEvent) (map[string]interface{}, error) {
+	recipientID := evt.StringInput("recipient_id")
+	giverID := evt.StringInput("giver_id")
+	channelID := evt.StringInput("channel_id")
+	// Inputs are plain text, reasons are stored as mrkdwn like those of messages
+	reason := messages.Escape(evt.StringInput("reason"))
+
+	if recipientID == "" {
+		return nil, errors.New("a recipient is required")
+	}
+	if giverID == "" {
+		return nil, errors.New("a giver is required")
+	}
+	if giverID == recipientID {
+		return nil, errors.New("users can't give kudos to themselves")
+	}
+	if channelID != "" {
+		listen, err := listens(ctx, teamID, channelID)
+		if err != nil {
+			return nil, err
+		}
+		if !listen {
+			return nil, fmt.Errorf("the bot doesn't listen in channel %s, see the listen setting", channelID)
+		}
+	}
+
+	result, err := kudos.Give(ctx, kudos.Kudos{
+		TeamID:      teamID,
+		GiverID:     giverID,
+		RecipientID: recipientID,
+		ChannelID:   channelID,
+		SourceID:    evt.FunctionExecutionID,
+		Amount:      1,
+		Reason:      reason,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to give kudos: %w", err)
+	}
+
+	outputs := map[string]interface{}{
+		"kudos_id": result.Kudos.ID,
+		"count":    result.Count,
+	}
+
+	log.FromContext(ctx).Infof("Workflow %s gave kudos %d to user %s in workspace %s", evt.WorkflowExecutionID, result.Kudos.ID, recipientID, teamID)
+
+	// Without a channel there's nowhere to celebrate in place
+	mode := settings.ModeSilent
+	if channelID != "" {
+		mode = settings.ModeChannel
+	}
+
+	locale := messages.Locale(ctx, client, teamID, giverID)
+
+	// A retried step only redoes what failed before, see kudos.Result.Deliver
+	if channelID != "" {
+		msg, err := messages.Render(ctx, teamID, locale, "kudos", messages.Data{
+			"Key":    "kudos_given",
+			"UserID": recipientID,
+			"Count":  result.Count,
+			"Reason": messages.UserText(reason),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		err = result.Deliver(ctx, kudos.StepAnnounce, func() error {
+			_, err := respond.Channel(ctx, client, channelID, msg)
+			return err
+		})
+		if err != nil {
+			// The kudos is recorded, the announcement is a nice to have
+			log.FromContext(ctx).Warnf("Failed to announce kudos %d in channel %s: %v", result.Kudos.ID, channelID, err)
+			mode = settings.ModeSilent
+		}
+	}
+
+	err = result.Deliver(ctx, kudos.StepNotify, func() error {
+		return notify.Recipient(ctx, client, result.Kudos)
+	})
+	if err != nil {
+		log.FromContext(ctx).Warnf("Failed to notify user %s about kudos %d: %v", recipientID, result.Kudos.ID, err)
+	}
+
+	err = result.Deliver(ctx, kudos.StepWall, func() error {
+		return wall.Post(ctx, client, result)
+	})
+	if err != nil {
+		log.FromContext(ctx).Warnf("Failed to cross-post kudos %d to the kudos wall: %v", result.Kudos.ID, err)
+	}
+
+	target := respond.Target{TeamID: teamID, ChannelID: channelID, UserID: giverID, RecipientID: recipientID}
+	err = result.Deliver(ctx, kudos.StepCelebrate, func() error {
+		return events.Celebrate(ctx, client, locale, mode, target, result.Badges)
+	})
+	if err != nil {
+		log.FromContext(ctx).Warnf("Failed to celebrate milestones of user %s: %v", recipientID, err)
+	}
+
+	return outputs, nil
+}
+
+// listens reports whether the bot listens in a channel, see the listen
+// setting and the ChannelFilter middleware doing the same for messages.
+func listens(ctx context.Context, teamID, channelID string) (bool, error) {
+	value, err := settings.GetForChannel(ctx, teamID, channelID, settings.Listen)
+	if err != nil {
+		return false, fmt.Errorf("failed to get the listen setting of channel %s: %w", channelID, err)
+	}
+	listen, err := settings.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid listen setting of channel %s: %w", channelID, err)
+	}
+	return listen, nil
+}
@@ -0,0 +1,57 @@
+package functions_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kaplan-michael/slack-kudos/pkg/handler/functions"
+	"github.com/kaplan-michael/slack-kudos/pkg/handler/handlertest"
+	"github.com/kaplan-michael/slack-kudos/pkg/kudos"
+	"github.com/kaplan-michael/slack-kudos/pkg/settings"
+)
+
+func TestGiveKudos(t *testing.T) {
+	tests := []struct {
+		name   string
+		inputs map[string]interface{}
+		// wantErr is set when the step has to fail
+		wantErr bool
+		// count is the recipient's kudos after the step
+		count int
+	}{
+		{name: "given", inputs: map[string]interface{}{"recipient_id": "U2", "giver_id": "U1", "channel_id": "C1"}, count: 1},
+		{name: "without channel", inputs: map[string]interface{}{"recipient_id": "U2", "giver_id": "U1"}, count: 1},
+		{name: "no recipient", inputs: map[string]interface{}{"giver_id": "U1"}, wantErr: true},
+		{name: "no giver", inputs: map[string]interface{}{"recipient_id": "U2"}, wantErr: true},
+		{name: "to themselves", inputs: map[string]interface{}{"recipient_id": "U2", "giver_id": "U2"}, wantErr: true},
+		{name: "channel not listened in", inputs: map[string]interface{}{"recipient_id": "U2", "giver_id": "U1", "channel_id": "C2"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			client := handlertest.Setup(t, "T1")
+			if err := settings.SetForChannel(ctx, "T1", "C2", settings.Listen, "off"); err != nil {
+				t.Fatal(err)
+			}
+
+			evt := &functions.FunctionExecutedEvent{
+				Inputs:              tt.inputs,
+				FunctionExecutionID: "Fx1",
+				WorkflowExecutionID: "Wf1",
+			}
+			_, err := functions.NewGiveKudosHandler().Handle(ctx, client, "T1", evt)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Handle() error = %v, want error %v", err, tt.wantErr)
+			}
+
+			count, _, err := kudos.Stats(ctx, "T1", "U2")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != tt.count {
+				t.Errorf("count = %d, want %d", count, tt.count)
+			}
+		})
+	}
+}
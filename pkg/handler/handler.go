@@ -1,21 +1,163 @@
 package handler
 
 import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
-	"github.com/slack-go/slack/socketmode"
 )
 
-// EventHandler handles generic events.
-type EventHandler interface {
-	HandleEvent(client *socketmode.Client, evt interface{}) error
+// Kind is the kind of a request from Slack.
+type Kind string
+
+const (
+	// KindEvent is an Events API event
+	KindEvent Kind = "event"
+	// KindCommand is a slash command
+	KindCommand Kind = "command"
+	// KindInteraction is an interaction, e.g. a button click
+	KindInteraction Kind = "interaction"
+)
+
+// Request is an event, slash command or interaction from Slack. It's the
+// same whether it arrived over Socket Mode, the HTTP Events API or from a
+// test, the transport acknowledges it before it's dispatched.
+type Request struct {
+	Kind Kind
+	// TeamID is the workspace the request came from
+	TeamID string
+	// Event is set for KindEvent
+	Event slackevents.EventsAPIEvent
+	// Command is set for KindCommand
+	Command slack.SlashCommand
+	// Interaction is set for KindInteraction
+	Interaction slack.InteractionCallback
+	// Retry counts the earlier attempts of a request retried from the
+	// dead-letter store, it's 0 when Slack delivered the request
+	Retry int
+}
+
+// EventRequest creates the request of an Events API event.
+func EventRequest(evt slackevents.EventsAPIEvent) Request {
+	return Request{Kind: KindEvent, TeamID: evt.TeamID, Event: evt}
+}
+
+// CommandRequest creates the request of a slash command.
+func CommandRequest(cmd slack.SlashCommand) Request {
+	return Request{Kind: KindCommand, TeamID: cmd.TeamID, Command: cmd}
+}
+
+// InteractionRequest creates the request of an interaction.
+func InteractionRequest(callback slack.InteractionCallback) Request {
+	return Request{Kind: KindInteraction, TeamID: callback.Team.ID, Interaction: callback}
+}
+
+// ID returns an identifier of the request that stays the same when Slack
+// delivers it again, e.g. the event ID of an event. It's empty when the
+// request has none, e.g. for a hand-made event.
+func (r Request) ID() string {
+	switch r.Kind {
+	case KindEvent:
+		if callback, ok := r.Event.Data.(*slackevents.EventsAPICallbackEvent); ok {
+			return callback.EventID
+		}
+	case KindCommand:
+		return r.Command.TriggerID
+	case KindInteraction:
+		return r.Interaction.TriggerID
+	}
+	return ""
+}
+
+// ChannelID returns the channel the request came from, if any.
+func (r Request) ChannelID() string {
+	switch r.Kind {
+	case KindEvent:
+		switch ev := r.Event.InnerEvent.Data.(type) {
+		case *slackevents.MessageEvent:
+			return ev.Channel
+		case *slackevents.AppMentionEvent:
+			return ev.Channel
+		case *slackevents.ReactionAddedEvent:
+			return ev.Item.Channel
+		case *slackevents.ReactionRemovedEvent:
+			return ev.Item.Channel
+		case *slackevents.MemberJoinedChannelEvent:
+			return ev.Channel
+		case *slackevents.MemberLeftChannelEvent:
+			return ev.Channel
+		}
+	case KindCommand:
+		return r.Command.ChannelID
+	case KindInteraction:
+		return r.Interaction.Channel.ID
+	}
+	return ""
+}
+
+// Private reports whether the request could give away the giver of an
+// anonymous kudos, i.e. it's a message sent to the bot in a DM. Its channel
+// isn't logged and its payload is only stored sealed.
+func (r Request) Private() bool {
+	if r.Kind != KindEvent {
+		return false
+	}
+	ev, ok := r.Event.InnerEvent.Data.(*slackevents.MessageEvent)
+	return ok && ev.ChannelType == "im"
 }
 
-// MessageEventHandler handles message events specifically.
-type MessageEventHandler interface {
-	HandleMessage(client *socketmode.Client, msgEvent *slackevents.MessageEvent) error
+// Marshal encodes the request's payload in the form Slack sent it, so that
+// it can be stored and decoded with Unmarshal.
+func (r Request) Marshal() ([]byte, error) {
+	switch r.Kind {
+	case KindEvent:
+		callback, ok := r.Event.Data.(*slackevents.EventsAPICallbackEvent)
+		if !ok || callback.InnerEvent == nil {
+			// A hand-made event, wrap it the way Slack would
+			inner, err := json.Marshal(r.Event.InnerEvent.Data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode event: %w", err)
+			}
+			raw := json.RawMessage(inner)
+			callback = &slackevents.EventsAPICallbackEvent{
+				Type:         r.Event.Type,
+				TeamID:       r.Event.TeamID,
+				APIAppID:     r.Event.APIAppID,
+				EnterpriseID: r.Event.EnterpriseID,
+				InnerEvent:   &raw,
+			}
+		}
+		return json.Marshal(callback)
+	case KindCommand:
+		return json.Marshal(r.Command)
+	case KindInteraction:
+		return json.Marshal(&r.Interaction)
+	}
+	return nil, fmt.Errorf("unknown request kind %q", r.Kind)
 }
 
-// CommandHandler handles slash commands.
-type CommandHandler interface {
-	HandleCommand(client *socketmode.Client, cmd string, event *socketmode.Event) error
+// Unmarshal decodes a request of the kind encoded by Request.Marshal.
+func Unmarshal(kind Kind, payload []byte) (Request, error) {
+	switch kind {
+	case KindEvent:
+		evt, err := slackevents.ParseEvent(json.RawMessage(payload), slackevents.OptionNoVerifyToken())
+		if err != nil {
+			return Request{}, fmt.Errorf("failed to decode event: %w", err)
+		}
+		return EventRequest(evt), nil
+	case KindCommand:
+		var cmd slack.SlashCommand
+		if err := json.Unmarshal(payload, &cmd); err != nil {
+			return Request{}, fmt.Errorf("failed to decode command: %w", err)
+		}
+		return CommandRequest(cmd), nil
+	case KindInteraction:
+		var callback slack.InteractionCallback
+		if err := json.Unmarshal(payload, &callback); err != nil {
+			return Request{}, fmt.Errorf("failed to decode interaction: %w", err)
+		}
+		return InteractionRequest(callback), nil
+	}
+	return Request{}, fmt.Errorf("unknown request kind %q", kind)
 }
@@ -0,0 +1,301 @@
+// Package handlertest runs the bot's handlers without Slack. Its Client is
+// a respond.Responder that records every call instead of sending it, so a
+// handler can be run on a hand-made request and its responses inspected.
+// The handlers still need a database, see Setup.
+package handlertest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/kaplan-michael/slack-kudos/pkg/config"
+	"github.com/kaplan-michael/slack-kudos/pkg/database"
+	"github.com/kaplan-michael/slack-kudos/pkg/dispatcher"
+	"github.com/kaplan-michael/slack-kudos/pkg/handler"
+	"github.com/kaplan-michael/slack-kudos/pkg/oauth2"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// Call is a Slack API call made by a handler.
+type Call struct {
+	// Method is the Slack API method, e.g. "chat.postMessage", or "webhook"
+	// for posts to a response URL
+	Method    string
+	ChannelID string
+	UserID    string
+	// Timestamp is the message the call is about, e.g. the updated message
+	Timestamp string
+	// Values are the parameters of a message, e.g. "text", "blocks" and "thread_ts"
+	Values url.Values
+	// Webhook is the message posted to a response URL
+	Webhook *slack.WebhookMessage
+	// Reaction is the emoji of an added reaction
+	Reaction string
+}
+
+// Content returns the text and the blocks of the message the call posted,
+// the blocks as JSON without HTML escaping, e.g. to look for a text in it.
+func (c Call) Content() string {
+	text, blocks := c.Values.Get("text"), c.Values.Get("blocks")
+	if c.Webhook != nil {
+		raw, _ := json.Marshal(c.Webhook.Blocks)
+		text, blocks = c.Webhook.Text, string(raw)
+	}
+
+	var decoded any
+	if err := json.Unmarshal([]byte(blocks), &decoded); err != nil {
+		return text + "\n" + blocks
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(decoded)
+	return text + "\n" + buf.String()
+}
+
+// Client is a fake Slack API client of a workspace.
+type Client struct {
+	TeamID    string
+	BotUserID string
+	BotName   string
+	// Users are returned by GetUserInfoContext, unknown users get a default profile
+	Users map[string]*slack.User
+	// Channels are returned by GetConversationInfoContext, unknown channels are public
+	Channels map[string]*slack.Channel
+
+	mu    sync.Mutex
+	calls []Call
+	// failures are the errors of the next calls of a method, see FailNext
+	failures map[string][]error
+}
+
+// lastTS numbers the timestamps of the messages, those posted by users and
+// those posted by the bot alike, so that no two messages share one.
+var lastTS atomic.Int64
+
+// nextTS returns a new message timestamp.
+func nextTS() string {
+	return fmt.Sprintf("1700000000.%06d", lastTS.Add(1))
+}
+
+// New creates a fake client for a workspace.
+func New(teamID string) *Client {
+	return &Client{
+		TeamID:    teamID,
+		BotUserID: "UBOT",
+		BotName:   "kudos",
+		Users:     map[string]*slack.User{},
+		Channels:  map[string]*slack.Channel{},
+	}
+}
+
+// Setup gives the test a database of its own, with the workspace installed,
+// and returns the workspace's fake client. The database is the global one
+// the handlers use, so tests using Setup can't run in parallel.
+func Setup(t testing.TB, teamID string) *Client {
+	t.Helper()
+
+	previous := *config.AppConfig
+	config.AppConfig.SQLiteFilename = filepath.Join(t.TempDir(), "kudos.db")
+	if config.AppConfig.AnonSecret == "" {
+		config.AppConfig.AnonSecret = "handlertest"
+	}
+	if err := database.InitDB(); err != nil {
+		t.Fatalf("failed to initialize database: %v", err)
+	}
+	t.Cleanup(func() {
+		database.DB.Close()
+		*config.AppConfig = previous
+	})
+
+	c := New(teamID)
+	err := oauth2.SaveWorkspaceCredentials(context.Background(), oauth2.WorkspaceCredentials{
+		TeamID:      teamID,
+		TeamName:    "Test",
+		AccessToken: "xoxb-test",
+		BotUserID:   c.BotUserID,
+	})
+	if err != nil {
+		t.Fatalf("failed to install workspace %s: %v", teamID, err)
+	}
+	return c
+}
+
+// Dispatch handles a request like the bot does, with c as the workspace's
+// client. Handlers have no deadline other than ctx's.
+func (c *Client) Dispatch(ctx context.Context, req handler.Request) error {
+	return dispatcher.NewDispatcher(dispatcher.Timeouts{}).Dispatch(ctx, req, c)
+}
+
+// Calls returns the calls made so far.
+func (c *Client) Calls() []Call {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Call(nil), c.calls...)
+}
+
+// Reset forgets the calls made so far.
+func (c *Client) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = nil
+}
+
+// FailNext makes the next call of the method, e.g. "chat.postMessage", fail
+// with err instead of being recorded.
+func (c *Client) FailNext(method string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failures == nil {
+		c.failures = map[string][]error{}
+	}
+	c.failures[method] = append(c.failures[method], err)
+}
+
+// failure returns the error the next call of the method fails with, if any.
+func (c *Client) failure(method string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	errs := c.failures[method]
+	if len(errs) == 0 {
+		return nil
+	}
+	c.failures[method] = errs[1:]
+	return errs[0]
+}
+
+func (c *Client) record(call Call) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, call)
+	return nextTS()
+}
+
+func (c *Client) message(method, channelID string, options []slack.MsgOption) (Call, error) {
+	if err := c.failure(method); err != nil {
+		return Call{}, err
+	}
+	_, values, err := slack.UnsafeApplyMsgOptions("", channelID, "", options...)
+	if err != nil {
+		return Call{}, err
+	}
+	values.Del("token")
+	return Call{Method: method, ChannelID: channelID, Values: values}, nil
+}
+
+func (c *Client) PostMessageContext(ctx context.Context, channelID string, options ...slack.MsgOption) (string, string, error) {
+	call, err := c.message("chat.postMessage", channelID, options)
+	if err != nil {
+		return "", "", err
+	}
+	return channelID, c.record(call), nil
+}
+
+func (c *Client) PostEphemeralContext(ctx context.Context, channelID, userID string, options ...slack.MsgOption) (string, error) {
+	call, err := c.message("chat.postEphemeral", channelID, options)
+	if err != nil {
+		return "", err
+	}
+	call.UserID = userID
+	return c.record(call), nil
+}
+
+func (c *Client) UpdateMessageContext(ctx context.Context, channelID, timestamp string, options ...slack.MsgOption) (string, string, string, error) {
+	call, err := c.message("chat.update", channelID, options)
+	if err != nil {
+		return "", "", "", err
+	}
+	call.Timestamp = timestamp
+	c.record(call)
+	return channelID, timestamp, call.Values.Get("text"), nil
+}
+
+func (c *Client) AddReactionContext(ctx context.Context, name string, item slack.ItemRef) error {
+	if err := c.failure("reactions.add"); err != nil {
+		return err
+	}
+	c.record(Call{Method: "reactions.add", ChannelID: item.Channel, Timestamp: item.Timestamp, Reaction: name})
+	return nil
+}
+
+func (c *Client) OpenConversationContext(ctx context.Context, params *slack.OpenConversationParameters) (*slack.Channel, bool, bool, error) {
+	if len(params.Users) == 0 {
+		return nil, false, false, fmt.Errorf("no users")
+	}
+	channel := &slack.Channel{}
+	channel.ID = "D" + params.Users[0]
+	channel.IsIM = true
+	return channel, false, false, nil
+}
+
+func (c *Client) GetPermalinkContext(ctx context.Context, params *slack.PermalinkParameters) (string, error) {
+	return fmt.Sprintf("https://slack.test/archives/%s/p%s", params.Channel, params.Ts), nil
+}
+
+func (c *Client) GetConversationInfoContext(ctx context.Context, input *slack.GetConversationInfoInput) (*slack.Channel, error) {
+	if channel, ok := c.Channels[input.ChannelID]; ok {
+		return channel, nil
+	}
+	channel := &slack.Channel{}
+	channel.ID = input.ChannelID
+	return channel, nil
+}
+
+func (c *Client) GetUserInfoContext(ctx context.Context, userID string) (*slack.User, error) {
+	if user, ok := c.Users[userID]; ok {
+		return user, nil
+	}
+	return &slack.User{ID: userID, Name: userID, Locale: "en-US"}, nil
+}
+
+func (c *Client) AuthTestContext(ctx context.Context) (*slack.AuthTestResponse, error) {
+	c.record(Call{Method: "auth.test"})
+	return &slack.AuthTestResponse{TeamID: c.TeamID, UserID: c.BotUserID, User: c.BotName}, nil
+}
+
+func (c *Client) PostWebhookContext(ctx context.Context, url string, msg *slack.WebhookMessage) error {
+	if err := c.failure("webhook"); err != nil {
+		return err
+	}
+	c.record(Call{Method: "webhook", Webhook: msg})
+	return nil
+}
+
+// Message creates the request of a message posted by a user. Every message
+// gets a timestamp of its own, like in Slack.
+func Message(teamID, channelID, userID, text string) handler.Request {
+	return handler.EventRequest(slackevents.EventsAPIEvent{
+		Type:   slackevents.CallbackEvent,
+		TeamID: teamID,
+		InnerEvent: slackevents.EventsAPIInnerEvent{
+			Type: string(slackevents.Message),
+			Data: &slackevents.MessageEvent{
+				Type:      string(slackevents.Message),
+				Channel:   channelID,
+				User:      userID,
+				Text:      text,
+				TimeStamp: nextTS(),
+			},
+		},
+	})
+}
+
+// Command creates the request of a slash command.
+func Command(teamID, channelID, userID, command, text string) handler.Request {
+	return handler.CommandRequest(slack.SlashCommand{
+		TeamID:      teamID,
+		ChannelID:   channelID,
+		UserID:      userID,
+		Command:     command,
+		Text:        text,
+		ResponseURL: "https://slack.test/response",
+	})
+}
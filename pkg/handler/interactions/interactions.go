@@ -0,0 +1,29 @@
+package interactions
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+	"github.com/slack-go/slack"
+)
+
+// ActionHandler defines the interface for all block action handlers.
+type ActionHandler interface {
+	Matches(actionID string) bool
+	Handle(ctx context.Context, client respond.Responder, callback *slack.InteractionCallback, action *slack.BlockAction) error
+}
+
+// RegexActionHandler implements the ActionHandler interface with a regex pattern.
+type RegexActionHandler struct {
+	Pattern    *regexp.Regexp
+	HandleFunc func(ctx context.Context, client respond.Responder, callback *slack.InteractionCallback, action *slack.BlockAction) error
+}
+
+func (h *RegexActionHandler) Matches(actionID string) bool {
+	return h.Pattern.MatchString(actionID)
+}
+
+func (h *RegexActionHandler) Handle(ctx context.Context, client respond.Responder, callback *slack.InteractionCallback, action *slack.BlockAction) error {
+	return h.HandleFunc(ctx, client, callback, action)
+}
@@ -0,0 +1,106 @@
+package interactions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/kaplan-michael/slack-kudos/pkg/handler/events"
+	"github.com/kaplan-michael/slack-kudos/pkg/kudos"
+	"github.com/kaplan-michael/slack-kudos/pkg/messages"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+	"github.com/kaplan-michael/slack-kudos/pkg/settings"
+	"github.com/slack-go/slack"
+)
+
+func NewUndoHandler() *RegexActionHandler {
+	return &RegexActionHandler{
+		Pattern:    regexp.MustCompile(`^` + events.UndoActionID + `$`),
+		HandleFunc: handleUndo,
+	}
+}
+
+// handleUndo revokes a kudos when its giver clicks the "Undo" button.
+func handleUndo(ctx context.Context, client respond.Responder, callback *slack.InteractionCallback, action *slack.BlockAction) error {
+	teamID := callback.Team.ID
+	channelID := callback.Channel.ID
+	userID := callback.User.ID
+
+	kudosID, err := strconv.ParseInt(action.Value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid kudos id %q: %w", action.Value, err)
+	}
+
+	locale := messages.Locale(ctx, client, teamID, userID)
+
+	record, err := kudos.Get(ctx, teamID, kudosID)
+	if err != nil {
+		if errors.Is(err, kudos.ErrNotFound) {
+			return postEphemeral(ctx, client, teamID, locale, channelID, userID, "undo_gone", nil)
+		}
+		return err
+	}
+
+	if record.RevokedAt != nil {
+		return postEphemeral(ctx, client, teamID, locale, channelID, userID, "undo_already", nil)
+	}
+
+	if record.GiverID != userID {
+		return postEphemeral(ctx, client, teamID, locale, channelID, userID, "undo_not_giver", messages.Data{"GiverID": record.GiverID})
+	}
+
+	undoWindow, err := settings.GetInt(ctx, teamID, settings.UndoWindowMinutes)
+	if err != nil {
+		return fmt.Errorf("failed to get undo window: %w", err)
+	}
+	if time.Since(record.CreatedAt) > time.Duration(undoWindow)*time.Minute {
+		return postEphemeral(ctx, client, teamID, locale, channelID, userID, "undo_expired", messages.Data{"Minutes": undoWindow})
+	}
+
+	count, err := kudos.Revoke(ctx, teamID, kudosID)
+	if err != nil {
+		if errors.Is(err, kudos.ErrNotFound) {
+			return postEphemeral(ctx, client, teamID, locale, channelID, userID, "undo_already", nil)
+		}
+		return fmt.Errorf("failed to revoke kudos %d: %w", kudosID, err)
+	}
+
+	log.FromContext(ctx).Infof("User %s undid kudos %d in workspace %s", userID, kudosID, teamID)
+
+	// Replace the confirmation (and its button) with a note about the undo
+	msg, err := messages.Notice(ctx, teamID, locale, "kudos_undone", messages.Data{
+		"GiverID": userID,
+		"UserID":  record.RecipientID,
+		"Count":   count,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Ephemeral confirmations can only be replaced through the response URL
+	if callback.Container.IsEphemeral {
+		return respond.Replace(ctx, client, callback.ResponseURL, msg)
+	}
+
+	// A reply confirming several kudos keeps the confirmations of the others
+	blocks, combined, err := respond.ReplacePart(callback.Message.Blocks, action.BlockID, msg)
+	if err != nil {
+		return err
+	}
+	if combined {
+		msg = messages.Message{Text: callback.Message.Text, Blocks: blocks}
+	}
+	return respond.Update(ctx, client, channelID, callback.Message.Timestamp, msg)
+}
+
+func postEphemeral(ctx context.Context, client respond.Responder, teamID, locale, channelID, userID, key string, data messages.Data) error {
+	msg, err := messages.Notice(ctx, teamID, locale, key, data)
+	if err != nil {
+		return err
+	}
+	return respond.Ephemeral(ctx, client, channelID, userID, msg)
+}
@@ -0,0 +1,95 @@
+package kudos
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/kaplan-michael/slack-kudos/pkg/config"
+)
+
+// sealGiver encrypts the giver of an anonymous kudos so it can only be
+// revealed by someone holding the anonymous kudos secret.
+func sealGiver(userID string) (string, error) {
+	return Seal([]byte(userID))
+}
+
+// RevealGiver decrypts the giver of an anonymous kudos.
+// It is meant for admins investigating abuse.
+func RevealGiver(k Kudos) (string, error) {
+	if !k.Anonymous {
+		return k.GiverID, nil
+	}
+
+	userID, err := Open(k.giverSecret)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt giver: %w", err)
+	}
+	return string(userID), nil
+}
+
+// Seal encrypts data that could give away the giver of an anonymous kudos,
+// e.g. a failed request kept for a retry, with the anonymous kudos secret.
+func Seal(data []byte) (string, error) {
+	gcm, err := anonCipher()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := gcm.Seal(nonce, nonce, data, nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts data encrypted by Seal.
+func Open(sealed string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode sealed data: %w", err)
+	}
+
+	gcm, err := anonCipher()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw) < gcm.NonceSize() {
+		return nil, errors.New("sealed data is too short")
+	}
+
+	nonce, ciphertext := raw[:gcm.NonceSize()], raw[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+// AnonSourceID identifies the DM message that gave an anonymous kudos, see
+// Kudos.SourceID, without storing the DM. It's keyed with the anonymous
+// kudos secret, so it can't be matched to the giver's conversations.
+func AnonSourceID(teamID, channelID, messageTS string) string {
+	mac := hmac.New(sha256.New, []byte(config.AppConfig.AnonSecret))
+	mac.Write([]byte(teamID + "/" + channelID + "/" + messageTS))
+	return "anon:" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// anonCipher derives the AES-GCM cipher from the configured secret.
+func anonCipher() (cipher.AEAD, error) {
+	if config.AppConfig.AnonSecret == "" {
+		return nil, errors.New("no anonymous kudos secret configured")
+	}
+	key := sha256.Sum256([]byte(config.AppConfig.AnonSecret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
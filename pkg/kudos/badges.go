@@ -0,0 +1,198 @@
+package kudos
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/kaplan-michael/slack-kudos/pkg/database"
+	"github.com/kaplan-michael/slack-kudos/pkg/settings"
+)
+
+// Badge is a named achievement awarded when a user reaches a kudos milestone.
+type Badge struct {
+	Threshold int
+	Name      string
+	Emoji     string
+	AwardedAt time.Time
+}
+
+// defaultBadges are used for milestones the workspace hasn't named itself.
+var defaultBadges = map[int]Badge{
+	10:  {Threshold: 10, Name: "Rising Star", Emoji: ":star:"},
+	50:  {Threshold: 50, Name: "Team Player", Emoji: ":handshake:"},
+	100: {Threshold: 100, Name: "Kudos Champion", Emoji: ":trophy:"},
+	500: {Threshold: 500, Name: "Legend", Emoji: ":crown:"},
+}
+
+// GetBadge returns the badge awarded for the given milestone in a workspace.
+func GetBadge(ctx context.Context, teamID string, threshold int) (Badge, error) {
+	badge := Badge{Threshold: threshold}
+	err := database.DB.QueryRowContext(ctx,
+		`SELECT name, emoji FROM badges WHERE team_id = ? AND threshold = ?`,
+		teamID, threshold,
+	).Scan(&badge.Name, &badge.Emoji)
+	if errors.Is(err, sql.ErrNoRows) {
+		if def, ok := defaultBadges[threshold]; ok {
+			return def, nil
+		}
+		return Badge{Threshold: threshold, Name: fmt.Sprintf("%d Kudos", threshold), Emoji: ":medal:"}, nil
+	}
+	if err != nil {
+		return badge, fmt.Errorf("failed to get badge for %d kudos: %w", threshold, err)
+	}
+	return badge, nil
+}
+
+// SetBadge names the badge awarded for the given milestone in a workspace.
+func SetBadge(ctx context.Context, teamID string, threshold int, name, emoji string) error {
+	_, err := database.DB.ExecContext(ctx, `
+		INSERT INTO badges (team_id, threshold, name, emoji)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(team_id, threshold)
+		DO UPDATE SET name = excluded.name, emoji = excluded.emoji`,
+		teamID, threshold, name, emoji,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save badge for %d kudos: %w", threshold, err)
+	}
+	return nil
+}
+
+// UserBadges returns the badges a user has earned, lowest milestone first.
+func UserBadges(ctx context.Context, teamID, userID string) ([]Badge, error) {
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT threshold, awarded_at
+		FROM user_badges
+		WHERE team_id = ? AND user_id = ?
+		ORDER BY threshold`, teamID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query badges: %w", err)
+	}
+	defer rows.Close()
+
+	var earned []Badge
+	for rows.Next() {
+		var threshold int
+		var awardedAt time.Time
+		if err := rows.Scan(&threshold, &awardedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan badge: %w", err)
+		}
+		earned = append(earned, Badge{Threshold: threshold, AwardedAt: awardedAt})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	// Resolve the badge names once the rows are closed
+	badges := make([]Badge, 0, len(earned))
+	for _, e := range earned {
+		badge, err := GetBadge(ctx, teamID, e.Threshold)
+		if err != nil {
+			return nil, err
+		}
+		badge.AwardedAt = e.AwardedAt
+		badges = append(badges, badge)
+	}
+	return badges, nil
+}
+
+// awardMilestones awards the badges for every milestone the kudos made its
+// recipient cross, their count going from oldCount to newCount. Badges are
+// only awarded once.
+func awardMilestones(ctx context.Context, k Kudos, oldCount, newCount int) ([]Badge, error) {
+	teamID, userID := k.TeamID, k.RecipientID
+	milestones, err := settings.GetIntList(ctx, teamID, settings.Milestones)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get milestones: %w", err)
+	}
+	sort.Ints(milestones)
+
+	var awarded []Badge
+	for _, milestone := range milestones {
+		if milestone <= oldCount || milestone > newCount {
+			continue
+		}
+
+		result, err := database.DB.ExecContext(ctx, `
+			INSERT OR IGNORE INTO user_badges (team_id, user_id, threshold, awarded_at, kudos_id)
+			VALUES (?, ?, ?, ?, ?)`, teamID, userID, milestone, time.Now(), k.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to award badge for %d kudos: %w", milestone, err)
+		}
+
+		// Already earned earlier, e.g. before losing some kudos
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			continue
+		}
+
+		badge, err := GetBadge(ctx, teamID, milestone)
+		if err != nil {
+			return nil, err
+		}
+		awarded = append(awarded, badge)
+	}
+	return awarded, nil
+}
+
+// kudosBadges returns the badges the kudos earned its recipient, lowest
+// milestone first.
+func kudosBadges(ctx context.Context, k Kudos) ([]Badge, error) {
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT threshold FROM user_badges
+		WHERE team_id = ? AND kudos_id = ?
+		ORDER BY threshold`, k.TeamID, k.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query badges of kudos %d: %w", k.ID, err)
+	}
+	defer rows.Close()
+
+	var thresholds []int
+	for rows.Next() {
+		var threshold int
+		if err := rows.Scan(&threshold); err != nil {
+			return nil, fmt.Errorf("failed to scan badge: %w", err)
+		}
+		thresholds = append(thresholds, threshold)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	badges := make([]Badge, 0, len(thresholds))
+	for _, threshold := range thresholds {
+		badge, err := GetBadge(ctx, k.TeamID, threshold)
+		if err != nil {
+			return nil, err
+		}
+		badges = append(badges, badge)
+	}
+	return badges, nil
+}
+
+// Stats returns the user's kudos count and their rank in the workspace.
+func Stats(ctx context.Context, teamID, userID string) (count, rank int, err error) {
+	err = database.DB.QueryRowContext(ctx,
+		`SELECT count FROM workspace_kudos WHERE team_id = ? AND user_id = ?`,
+		teamID, userID,
+	).Scan(&count)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get kudos count: %w", err)
+	}
+
+	err = database.DB.QueryRowContext(ctx,
+		`SELECT COUNT(*) + 1 FROM workspace_kudos WHERE team_id = ? AND count > ?`,
+		teamID, count,
+	).Scan(&rank)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get kudos rank: %w", err)
+	}
+
+	return count, rank, nil
+}
@@ -0,0 +1,68 @@
+package kudos
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/kaplan-michael/slack-kudos/pkg/database"
+)
+
+// Step is a step of delivering a kudos, e.g. announcing it. The steps done
+// are recorded, so that a retried event only redoes the ones that failed.
+type Step string
+
+const (
+	// StepAnnounce is the confirmation, or the delivery of an anonymous kudos
+	StepAnnounce Step = "announce"
+	// StepNotify is the DM telling the recipient about the kudos
+	StepNotify Step = "notify"
+	// StepWall is the cross-post to the kudos wall
+	StepWall Step = "wall"
+	// StepCelebrate is the celebration of the badges the kudos earned
+	StepCelebrate Step = "celebrate"
+	// StepAcknowledge tells the giver of an anonymous kudos it was delivered
+	StepAcknowledge Step = "acknowledge"
+)
+
+// Deliver runs a step of delivering the kudos, unless it was already done
+// when the kudos was given before, see Result.Repeated, and records it when
+// it succeeds. A revoked kudos isn't delivered anymore.
+func (r Result) Deliver(ctx context.Context, step Step, deliver func() error) error {
+	if r.Delivered[step] || r.Kudos.RevokedAt != nil {
+		return nil
+	}
+	if err := deliver(); err != nil {
+		return err
+	}
+
+	_, err := database.DB.ExecContext(ctx, `
+		INSERT OR IGNORE INTO kudos_deliveries (team_id, kudos_id, step, delivered_at)
+		VALUES (?, ?, ?, ?)`, r.Kudos.TeamID, r.Kudos.ID, string(step), time.Now())
+	if err != nil {
+		// It's done, failing would only make a retry do it again
+		log.FromContext(ctx).Warnf("Failed to record %s of kudos %d: %v", step, r.Kudos.ID, err)
+	}
+	return nil
+}
+
+// deliveredSteps returns the steps of delivering the kudos already done.
+func deliveredSteps(ctx context.Context, k Kudos) (map[Step]bool, error) {
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT step FROM kudos_deliveries WHERE team_id = ? AND kudos_id = ?`, k.TeamID, k.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deliveries of kudos %d: %w", k.ID, err)
+	}
+	defer rows.Close()
+
+	delivered := map[Step]bool{}
+	for rows.Next() {
+		var step string
+		if err := rows.Scan(&step); err != nil {
+			return nil, fmt.Errorf("failed to scan delivery: %w", err)
+		}
+		delivered[Step(step)] = true
+	}
+	return delivered, rows.Err()
+}
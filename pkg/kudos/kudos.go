@@ -0,0 +1,308 @@
+package kudos
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/kaplan-michael/slack-kudos/pkg/database"
+)
+
+// ErrWorkspaceNotFound is returned when kudos are given in a workspace that
+// hasn't completed the OAuth installation.
+var ErrWorkspaceNotFound = errors.New("workspace not found")
+
+// ErrNotFound is returned when a kudos record doesn't exist or was already revoked.
+var ErrNotFound = errors.New("kudos not found")
+
+// Kudos is a single kudos given (or taken away) by one user to another.
+type Kudos struct {
+	ID          int64
+	TeamID      string
+	GiverID     string
+	RecipientID string
+	ChannelID   string
+	MessageTS   string
+	// SourceID identifies what gave a kudos that has no message of its own,
+	// e.g. the workflow step execution, see also AnonSourceID
+	SourceID  string
+	Amount    int
+	Reason    string
+	Anonymous bool
+	CreatedAt time.Time
+	RevokedAt *time.Time
+
+	// giverSecret holds the encrypted giver of an anonymous kudos
+	giverSecret string
+}
+
+// Result is the outcome of giving a kudos.
+type Result struct {
+	Kudos Kudos
+	// Count is the recipient's new kudos count
+	Count int
+	// Badges are the badges the recipient earned with this kudos
+	Badges []Badge
+	// Repeated is set when the message or source already gave the kudos,
+	// e.g. when its event was retried. Nothing was recorded, Delivered
+	// tells what of its delivery is left to do.
+	Repeated bool
+	// Delivered are the steps of delivering the kudos already done, see Deliver
+	Delivered map[Step]bool
+}
+
+// errRepeated is returned by give when the kudos was already given.
+var errRepeated = errors.New("kudos already given")
+
+// Give records the kudos, updates the recipient's total and awards the
+// badges of any milestone the recipient crossed. A message or source gives
+// its kudos once, giving it again, e.g. when its event is retried, returns
+// the kudos already recorded, see Result.Repeated.
+func Give(ctx context.Context, k Kudos) (Result, error) {
+	result, err := give(ctx, k)
+	if errors.Is(err, errRepeated) {
+		return given(ctx, k)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	if k.Amount > 0 {
+		result.Badges, err = awardMilestones(ctx, result.Kudos, result.Count-k.Amount, result.Count)
+		if err != nil {
+			// The kudos itself is recorded, don't fail because of the badges
+			log.FromContext(ctx).Warnf("Failed to award milestones to user %s in workspace %s: %v", k.RecipientID, k.TeamID, err)
+		}
+	}
+
+	return result, nil
+}
+
+func give(ctx context.Context, k Kudos) (Result, error) {
+	if err := checkWorkspace(ctx, k.TeamID); err != nil {
+		return Result{Kudos: k}, err
+	}
+
+	k.CreatedAt = time.Now()
+
+	// Never store the giver of an anonymous kudos in plain text
+	giverID := k.GiverID
+	if k.Anonymous {
+		secret, err := sealGiver(k.GiverID)
+		if err != nil {
+			return Result{Kudos: k}, err
+		}
+		k.GiverID = ""
+		k.giverSecret = secret
+	}
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Result{Kudos: k}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer rollback(tx)
+
+	// The unique indexes of the message and the source skip a kudos that
+	// was already given
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO kudos_log (
+			team_id, giver_id, recipient_id, channel_id, message_ts,
+			source_id, amount, reason, anonymous, giver_secret, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT DO NOTHING`,
+		k.TeamID, k.GiverID, k.RecipientID, k.ChannelID, k.MessageTS,
+		k.SourceID, k.Amount, k.Reason, k.Anonymous, k.giverSecret, k.CreatedAt,
+	)
+	if err != nil {
+		return Result{Kudos: k}, fmt.Errorf("failed to record kudos: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return Result{Kudos: k}, fmt.Errorf("failed to record kudos: %w", err)
+	} else if n == 0 {
+		return Result{Kudos: k}, errRepeated
+	}
+
+	k.ID, err = res.LastInsertId()
+	if err != nil {
+		return Result{Kudos: k}, fmt.Errorf("failed to get kudos id: %w", err)
+	}
+
+	newCount, err := addToCount(ctx, tx, k.TeamID, k.RecipientID, k.Amount)
+	if err != nil {
+		return Result{Kudos: k}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Result{Kudos: k}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	if k.Anonymous {
+		giverID = "(anonymous)"
+	}
+	log.FromContext(ctx).Infof("User %s gave %+d kudos to %s in workspace %s, now has %d", giverID, k.Amount, k.RecipientID, k.TeamID, newCount)
+	return Result{Kudos: k, Count: newCount}, nil
+}
+
+// given returns the kudos the message or source already gave the recipient.
+func given(ctx context.Context, k Kudos) (Result, error) {
+	query := `SELECT id FROM kudos_log WHERE team_id = ? AND recipient_id = ? AND channel_id = ? AND message_ts = ?`
+	args := []any{k.TeamID, k.RecipientID, k.ChannelID, k.MessageTS}
+	if k.SourceID != "" {
+		query = `SELECT id FROM kudos_log WHERE team_id = ? AND recipient_id = ? AND source_id = ?`
+		args = []any{k.TeamID, k.RecipientID, k.SourceID}
+	}
+
+	var id int64
+	if err := database.DB.QueryRowContext(ctx, query, args...).Scan(&id); err != nil {
+		return Result{Kudos: k}, fmt.Errorf("failed to get the kudos already given: %w", err)
+	}
+
+	existing, err := Get(ctx, k.TeamID, id)
+	if err != nil {
+		return Result{Kudos: k}, err
+	}
+	count, _, err := Stats(ctx, k.TeamID, k.RecipientID)
+	if err != nil {
+		return Result{Kudos: k}, err
+	}
+	badges, err := kudosBadges(ctx, existing)
+	if err != nil {
+		return Result{Kudos: k}, err
+	}
+	delivered, err := deliveredSteps(ctx, existing)
+	if err != nil {
+		return Result{Kudos: k}, err
+	}
+
+	log.FromContext(ctx).Debugf("Kudos %d was already given to user %s in workspace %s", id, k.RecipientID, k.TeamID)
+	return Result{Kudos: existing, Count: count, Badges: badges, Repeated: true, Delivered: delivered}, nil
+}
+
+// Get retrieves a kudos record by its ID.
+func Get(ctx context.Context, teamID string, id int64) (Kudos, error) {
+	var k Kudos
+	var revokedAt sql.NullTime
+
+	err := database.DB.QueryRowContext(ctx, `
+		SELECT id, team_id, giver_id, recipient_id, channel_id,
+		       message_ts, source_id, amount, reason, anonymous, giver_secret,
+		       created_at, revoked_at
+		FROM kudos_log
+		WHERE team_id = ? AND id = ?`, teamID, id).Scan(
+		&k.ID,
+		&k.TeamID,
+		&k.GiverID,
+		&k.RecipientID,
+		&k.ChannelID,
+		&k.MessageTS,
+		&k.SourceID,
+		&k.Amount,
+		&k.Reason,
+		&k.Anonymous,
+		&k.giverSecret,
+		&k.CreatedAt,
+		&revokedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return k, ErrNotFound
+	}
+	if err != nil {
+		return k, fmt.Errorf("failed to get kudos %d: %w", id, err)
+	}
+
+	if revokedAt.Valid {
+		k.RevokedAt = &revokedAt.Time
+	}
+
+	return k, nil
+}
+
+// Revoke marks the kudos as revoked and reverts its effect on the recipient's total.
+// It returns the recipient's new kudos count.
+func Revoke(ctx context.Context, teamID string, id int64) (int, error) {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer rollback(tx)
+
+	var recipientID string
+	var amount int
+	err = tx.QueryRowContext(ctx, `
+		UPDATE kudos_log
+		SET revoked_at = ?
+		WHERE team_id = ? AND id = ? AND revoked_at IS NULL
+		RETURNING recipient_id, amount`, time.Now(), teamID, id).Scan(&recipientID, &amount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke kudos %d: %w", id, err)
+	}
+
+	newCount, err := addToCount(ctx, tx, teamID, recipientID, -amount)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	log.FromContext(ctx).Infof("Revoked kudos %d for user %s in workspace %s, now has %d", id, recipientID, teamID, newCount)
+	return newCount, nil
+}
+
+// checkWorkspace makes sure the workspace exists to avoid a foreign key constraint error.
+func checkWorkspace(ctx context.Context, teamID string) error {
+	var count int
+	err := database.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM workspaces WHERE team_id = ?`, teamID).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("error checking workspace: %w", err)
+	}
+
+	if count == 0 {
+		log.FromContext(ctx).Warnf("Workspace %s not found in database. Make sure OAuth setup is complete.", teamID)
+		return fmt.Errorf("%w: %s", ErrWorkspaceNotFound, teamID)
+	}
+
+	return nil
+}
+
+// addToCount adds amount to the user's total and returns the new total.
+func addToCount(ctx context.Context, tx *sql.Tx, teamID, userID string, amount int) (int, error) {
+	var newCount int
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO workspace_kudos (team_id, user_id, count)
+		VALUES (?, ?, ?)
+		ON CONFLICT(team_id, user_id)
+		DO UPDATE SET count = count + excluded.count
+		RETURNING count;`, teamID, userID, amount).Scan(&newCount)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update kudos count for user %s in workspace %s: %w", userID, teamID, err)
+	}
+	return newCount, nil
+}
+
+func rollback(tx *sql.Tx) {
+	if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		log.Warnf("Failed to rollback transaction: %v", err)
+	}
+}
+
+// AddReactions adds delta to the reaction count of the kudos given in a message.
+func AddReactions(ctx context.Context, teamID, channelID, messageTS string, delta int) error {
+	_, err := database.DB.ExecContext(ctx, `
+		UPDATE kudos_log
+		SET reactions = MAX(reactions + ?, 0)
+		WHERE team_id = ? AND channel_id = ? AND message_ts = ?`,
+		delta, teamID, channelID, messageTS,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to count reactions to message %s: %w", messageTS, err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package messages
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/kaplan-michael/slack-kudos/pkg/settings"
+	"github.com/slack-go/slack"
+)
+
+// userLocaleTTL is how long a user's Slack locale is cached.
+const userLocaleTTL = time.Hour
+
+// UserInfoGetter looks up Slack users, implemented by the Slack clients.
+type UserInfoGetter interface {
+	GetUserInfoContext(ctx context.Context, user string) (*slack.User, error)
+}
+
+type cachedLocale struct {
+	locale    string
+	expiresAt time.Time
+}
+
+var (
+	userLocales   = map[string]cachedLocale{}
+	userLocalesMu sync.Mutex
+)
+
+// Locale picks the locale for a message to a user: the workspace's locale
+// setting if there is one, otherwise the user's Slack locale.
+func Locale(ctx context.Context, api UserInfoGetter, teamID, userID string) string {
+	locale, err := settings.Get(ctx, teamID, settings.Locale)
+	if err != nil {
+		log.FromContext(ctx).Warnf("Failed to get locale for workspace %s: %v", teamID, err)
+	}
+	if locale != "" {
+		return locale
+	}
+
+	if userID == "" || api == nil {
+		return DefaultLocale
+	}
+	return userLocale(ctx, api, teamID, userID)
+}
+
+// userLocale returns the user's Slack locale, e.g. "cs" for "cs-CZ".
+func userLocale(ctx context.Context, api UserInfoGetter, teamID, userID string) string {
+	key := teamID + "/" + userID
+
+	userLocalesMu.Lock()
+	cached, ok := userLocales[key]
+	userLocalesMu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.locale
+	}
+
+	locale := DefaultLocale
+	user, err := api.GetUserInfoContext(ctx, userID)
+	if err != nil {
+		log.FromContext(ctx).Warnf("Failed to get locale of user %s: %v", userID, err)
+	} else if user.Locale != "" {
+		locale = normalizeLocale(user.Locale)
+	}
+
+	userLocalesMu.Lock()
+	userLocales[key] = cachedLocale{locale: locale, expiresAt: time.Now().Add(userLocaleTTL)}
+	userLocalesMu.Unlock()
+
+	return locale
+}
+
+// normalizeLocale maps a Slack locale to one of the built-in locales.
+func normalizeLocale(locale string) string {
+	language := strings.ToLower(strings.SplitN(locale, "-", 2)[0])
+	if _, ok := builtinTexts[language]; ok {
+		return language
+	}
+	return DefaultLocale
+}
@@ -0,0 +1,251 @@
+package messages
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/charmbracelet/log"
+	"github.com/slack-go/slack"
+)
+
+//go:embed templates
+var builtinFS embed.FS
+
+// DefaultLocale is used when no template exists for the requested locale.
+const DefaultLocale = "en"
+
+// Data holds the values available to the templates.
+type Data map[string]interface{}
+
+// Message is a rendered message, ready to be sent to Slack.
+type Message struct {
+	Text   string       `json:"text"`
+	Blocks slack.Blocks `json:"blocks"`
+}
+
+// Options returns the message as options for the Slack chat methods.
+func (m Message) Options() []slack.MsgOption {
+	return []slack.MsgOption{
+		slack.MsgOptionText(m.Text, false),
+		slack.MsgOptionBlocks(m.Blocks.BlockSet...),
+	}
+}
+
+// UserText is mrkdwn written by a user, e.g. the reason of a kudos. It
+// prints with its special mentions (@here, @channel, @everyone and user
+// groups) turned into plain text that doesn't notify anyone, whatever the
+// template, so that the bot
+// doesn't ping people on behalf of its users, e.g. of an anonymous giver.
+type UserText string
+
+// specialMention matches <!here>, <!channel>, <!everyone> and
+// <!subteam^ID>, with an optional |label.
+var specialMention = regexp.MustCompile(`<!(here|channel|everyone|subteam\^[^|>]*)(?:\|([^>]*))?>`)
+
+func (t UserText) String() string {
+	return specialMention.ReplaceAllStringFunc(string(t), func(mention string) string {
+		m := specialMention.FindStringSubmatch(mention)
+		switch {
+		case m[2] != "":
+			return "@" + strings.TrimPrefix(m[2], "@")
+		case strings.HasPrefix(m[1], "subteam^"):
+			return "@group"
+		}
+		return "@" + m[1]
+	})
+}
+
+// MarshalJSON encodes the text as printed, for templates using json.
+func (t UserText) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+// Escape escapes plain text for use as mrkdwn, see
+// https://api.slack.com/reference/surfaces/formatting#escaping.
+func Escape(text string) string {
+	return mrkdwnEscaper.Replace(text)
+}
+
+var mrkdwnEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// builtinTexts holds the embedded text templates, by locale and key.
+var builtinTexts = map[string]map[string]string{}
+
+func init() {
+	entries, err := builtinFS.ReadDir("templates/locales")
+	if err != nil {
+		panic(fmt.Sprintf("failed to read embedded locales: %v", err))
+	}
+	for _, entry := range entries {
+		raw, err := builtinFS.ReadFile(path.Join("templates/locales", entry.Name()))
+		if err != nil {
+			panic(fmt.Sprintf("failed to read embedded locale %s: %v", entry.Name(), err))
+		}
+		texts := map[string]string{}
+		if err := json.Unmarshal(raw, &texts); err != nil {
+			panic(fmt.Sprintf("failed to parse embedded locale %s: %v", entry.Name(), err))
+		}
+		builtinTexts[strings.TrimSuffix(entry.Name(), ".json")] = texts
+	}
+}
+
+// Locales returns the locales that have built-in templates.
+func Locales() []string {
+	locales := make([]string, 0, len(builtinTexts))
+	for locale := range builtinTexts {
+		locales = append(locales, locale)
+	}
+	return locales
+}
+
+// Render renders the named Block Kit layout for a workspace in the given locale.
+func Render(ctx context.Context, teamID, locale, layout string, data Data) (Message, error) {
+	var msg Message
+
+	body, err := layoutSource(ctx, teamID, layout)
+	if err != nil {
+		return msg, err
+	}
+
+	out, err := execute(ctx, teamID, locale, "layout:"+layout, body, data)
+	if err != nil {
+		return msg, err
+	}
+
+	if err := json.Unmarshal([]byte(out), &msg); err != nil {
+		return msg, fmt.Errorf("layout %s rendered invalid JSON: %w", layout, err)
+	}
+
+	return msg, nil
+}
+
+// Notice renders a single line of text, used for errors and short replies.
+func Notice(ctx context.Context, teamID, locale, key string, data Data) (Message, error) {
+	if data == nil {
+		data = Data{}
+	}
+	data["Key"] = key
+	return Render(ctx, teamID, locale, "notice", data)
+}
+
+// Text renders a single text template for a workspace in the given locale.
+func Text(ctx context.Context, teamID, locale, key string, data interface{}) (string, error) {
+	body, err := textSource(ctx, teamID, locale, key)
+	if err != nil {
+		return "", err
+	}
+	return execute(ctx, teamID, locale, key, body, data)
+}
+
+// execute parses and executes a template with the functions available to all templates.
+func execute(ctx context.Context, teamID, locale, name, body string, data interface{}) (string, error) {
+	tmpl, err := template.New(name).Funcs(funcs(ctx, teamID, locale)).Parse(body)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template %s: %w", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render template %s: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+// funcs returns the template functions.
+// Layouts use "text" and "textEach" to embed localized texts as JSON strings.
+func funcs(ctx context.Context, teamID, locale string) template.FuncMap {
+	return template.FuncMap{
+		// json encodes a value, e.g. {{json .UserID}}
+		"json": toJSON,
+		// text renders a localized text as a JSON string, e.g. {{text "kudos_given" .}}
+		"text": func(key string, data interface{}) (string, error) {
+			out, err := Text(ctx, teamID, locale, key, data)
+			if err != nil {
+				return "", err
+			}
+			return toJSON(out)
+		},
+		// textEach renders a localized text for every item and joins them
+		// with new lines as a JSON string, e.g. {{textEach "leaderboard_entry" .Users}}
+		"textEach": func(key string, items interface{}) (string, error) {
+			list := reflect.ValueOf(items)
+			if list.Kind() != reflect.Slice {
+				return "", fmt.Errorf("textEach expects a list, got %T", items)
+			}
+			lines := make([]string, 0, list.Len())
+			for i := 0; i < list.Len(); i++ {
+				out, err := Text(ctx, teamID, locale, key, list.Index(i).Interface())
+				if err != nil {
+					return "", err
+				}
+				lines = append(lines, out)
+			}
+			return toJSON(strings.Join(lines, "\n"))
+		},
+	}
+}
+
+func toJSON(v interface{}) (string, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+// layoutSource returns the workspace's layout override, or the built-in layout.
+func layoutSource(ctx context.Context, teamID, layout string) (string, error) {
+	if body, ok := override(ctx, teamID, "", layout); ok {
+		if _, err := template.New(layout).Funcs(funcs(ctx, teamID, DefaultLocale)).Parse(body); err == nil {
+			return body, nil
+		}
+		log.FromContext(ctx).Warnf("Ignoring invalid %s layout override in workspace %s", layout, teamID)
+	}
+
+	raw, err := builtinFS.ReadFile(path.Join("templates/layouts", layout+".json.tmpl"))
+	if err != nil {
+		return "", fmt.Errorf("unknown layout %s", layout)
+	}
+	return string(raw), nil
+}
+
+// textSource returns the text template for a key, preferring the workspace's
+// override and the requested locale, falling back to the default locale.
+func textSource(ctx context.Context, teamID, locale, key string) (string, error) {
+	for _, l := range []string{locale, DefaultLocale} {
+		if body, ok := override(ctx, teamID, l, key); ok {
+			return body, nil
+		}
+		if body, ok := builtinTexts[l][key]; ok {
+			return body, nil
+		}
+	}
+	return "", fmt.Errorf("unknown text %s", key)
+}
+
+// Source returns the template currently used by a workspace, for display.
+// An empty locale selects a layout.
+func Source(ctx context.Context, teamID, locale, name string) (string, error) {
+	if locale == "" {
+		return layoutSource(ctx, teamID, name)
+	}
+	return textSource(ctx, teamID, locale, name)
+}
+
+// Validate checks that a template override parses and refers to a known template.
+// An empty locale selects a layout.
+func Validate(ctx context.Context, teamID, locale, name, body string) error {
+	if _, err := Source(ctx, teamID, locale, name); err != nil {
+		return err
+	}
+	_, err := template.New(name).Funcs(funcs(ctx, teamID, DefaultLocale)).Parse(body)
+	return err
+}
@@ -0,0 +1,262 @@
+package messages
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+var (
+	day1 = time.Date(2024, time.March, 4, 9, 30, 0, 0, time.UTC)
+	day7 = time.Date(2024, time.March, 10, 9, 30, 0, 0, time.UTC)
+)
+
+var layoutTests = []struct {
+	name   string
+	layout string
+	data   Data
+}{
+	{name: "kudos_given", layout: "kudos", data: Data{
+		"Key": "kudos_given", "UserID": "U2", "Count": 3, "Reason": UserText("for the review"),
+		"KudosID": 42, "UndoActionID": "kudos_undo",
+	}},
+	{name: "kudos_taken", layout: "kudos", data: Data{"Key": "kudos_taken", "UserID": "U2", "Count": -1}},
+	{name: "kudos_anon", layout: "kudos", data: Data{
+		"Key": "kudos_anon", "UserID": "U2", "Count": 3, "Reason": UserText("for the review"),
+		"KudosID": 42, "ShowID": true,
+	}},
+	{name: "kudos_special_mentions", layout: "kudos", data: Data{
+		"Key": "kudos_given", "UserID": "U2", "Count": 3,
+		"Reason": UserText("<!channel> <!here|here> <!subteam^S1|@devs> <@U3> &lt;3"),
+	}},
+	{name: "leaderboard", layout: "leaderboard", data: Data{
+		"Limit": 2,
+		"Users": []Data{{"UserID": "U2", "Count": 5}, {"UserID": "U3", "Count": 3}},
+	}},
+	{name: "me", layout: "me", data: Data{
+		"Count": 12, "Rank": 1,
+		"Badges": []Data{{"Emoji": ":star:", "Name": "Star", "Threshold": 10, "AwardedAt": day1}},
+	}},
+	{name: "me_without_badges", layout: "me", data: Data{"Count": 2, "Rank": 4}},
+	{name: "milestone", layout: "milestone", data: Data{
+		"Emoji": ":star:", "UserID": "U2", "Threshold": 10, "BadgeName": "Star",
+	}},
+	{name: "notice", layout: "notice", data: Data{"Key": "undo_expired", "Minutes": 5}},
+	{name: "notification", layout: "notification", data: Data{
+		"GiverID": "U1", "ChannelID": "C1", "Reason": UserText("for the review"),
+		"Permalink": "https://slack.test/archives/C1/p1700000000000001",
+	}},
+	{name: "notification_anonymous", layout: "notification", data: Data{
+		"Anonymous": true, "Reason": UserText("for the review"),
+	}},
+	{name: "notification_digest", layout: "notification_digest", data: Data{
+		"Count": 3,
+		"Entries": []Data{
+			{"GiverID": "U1", "ChannelID": "C1", "Reason": UserText("for the review"), "Permalink": "https://slack.test/archives/C1/p1700000000000001"},
+			{"Anonymous": true, "Reason": UserText("<!channel> thanks")},
+		},
+		"More": 1,
+	}},
+	{name: "settings", layout: "settings", data: Data{
+		"Key": "config_title",
+		"Settings": []Data{
+			{"Key": "response_mode", "Value": "thread", "Description": "Where kudos are confirmed"},
+			{"Key": "anon_channel", "Value": "", "Description": "Where anonymous kudos are posted"},
+		},
+	}},
+	{name: "wall", layout: "wall", data: Data{
+		"GiverID": "U1", "UserID": "U2", "ChannelID": "C1", "Count": 3, "Reason": UserText("for the review"),
+		"Permalink": "https://slack.test/archives/C1/p1700000000000001",
+	}},
+	{name: "wall_workflow", layout: "wall", data: Data{"UserID": "U2", "Count": 3}},
+	{name: "welcome", layout: "welcome", data: Data{
+		"ChannelID": "C1", "ResponseMode": "channel", "Threshold": 10, "Emoji": ":star:",
+		"BadgeName": "Star", "Milestones": "10, 50, 100", "AllowMinusMinus": false,
+	}},
+	{name: "digest", layout: "digest", data: Data{
+		"From": day1, "To": day7, "Total": 7,
+		"Recipients":    []Data{{"Rank": 1, "UserID": "U2", "Count": 4}, {"Rank": 2, "UserID": "U3", "Count": 3}},
+		"Givers":        []Data{{"Rank": 1, "UserID": "U1", "Count": 7}},
+		"Milestones":    []Data{{"Emoji": ":star:", "UserID": "U2", "Threshold": 10, "Name": "Star"}},
+		"Categories":    []Data{{"Name": "teamwork", "Count": 5}},
+		"Uncategorized": 2,
+		"ShoutOut": Data{
+			"Reactions": 4, "GiverID": "U1", "UserID": "U2", "Reason": UserText("for the #teamwork"),
+			"Permalink": "https://slack.test/archives/C1/p1700000000000001",
+		},
+	}},
+	{name: "digest_empty", layout: "digest", data: Data{"From": day1, "To": day7, "Total": 0}},
+}
+
+// TestLayouts renders every layout in every locale and compares the
+// Block Kit output with testdata/<locale>/<name>.json. Run the tests with
+// -update to write the output instead, after changing a template.
+func TestLayouts(t *testing.T) {
+	for _, locale := range sortedLocales() {
+		for _, tt := range layoutTests {
+			t.Run(locale+"/"+tt.name, func(t *testing.T) {
+				msg, err := Render(context.Background(), "", locale, tt.layout, copyData(tt.data))
+				if err != nil {
+					t.Fatalf("Render() error = %v", err)
+				}
+				golden(t, filepath.Join("testdata", locale, tt.name+".json"), msg)
+			})
+		}
+	}
+}
+
+// TestTexts renders every text of every locale as a notice, with a value
+// for every field the texts use, and compares the Block Kit output with
+// testdata/<locale>/texts.json.
+func TestTexts(t *testing.T) {
+	for _, locale := range sortedLocales() {
+		t.Run(locale, func(t *testing.T) {
+			notices := map[string]Message{}
+			for key := range builtinTexts[locale] {
+				msg, err := Notice(context.Background(), "", locale, key, allFields())
+				if err != nil {
+					t.Fatalf("Notice(%s) error = %v", key, err)
+				}
+				notices[key] = msg
+			}
+			golden(t, filepath.Join("testdata", locale, "texts.json"), notices)
+		})
+	}
+}
+
+func TestLocalesHaveSameKeys(t *testing.T) {
+	for _, locale := range sortedLocales() {
+		for key := range builtinTexts[DefaultLocale] {
+			if _, ok := builtinTexts[locale][key]; !ok {
+				t.Errorf("locale %s has no text %s", locale, key)
+			}
+		}
+		for key := range builtinTexts[locale] {
+			if _, ok := builtinTexts[DefaultLocale][key]; !ok {
+				t.Errorf("locale %s has text %s, which %s doesn't have", locale, key, DefaultLocale)
+			}
+		}
+	}
+}
+
+func TestUserText(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "for the review", want: "for the review"},
+		{text: "<!here> <!channel> <!everyone>", want: "@here @channel @everyone"},
+		{text: "<!here|here> <!channel|@channel>", want: "@here @channel"},
+		{text: "<!subteam^S123|@devs> <!subteam^S123>", want: "@devs @group"},
+		{text: "<@U123> <#C123|general> <https://example.com|link>", want: "<@U123> <#C123|general> <https://example.com|link>"},
+		{text: "<!date^1700000000^{date}|Nov 14>", want: "<!date^1700000000^{date}|Nov 14>"},
+		{text: "&lt;!channel&gt;", want: "&lt;!channel&gt;"},
+	}
+
+	for _, tt := range tests {
+		if got := UserText(tt.text).String(); got != tt.want {
+			t.Errorf("UserText(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+// allFields returns a value for every field the built-in texts use.
+func allFields() Data {
+	return Data{
+		"AllowMinusMinus": true,
+		"Anonymous":       false,
+		"AwardedAt":       day1,
+		"BadgeName":       "Star",
+		"Body":            "{{.Reason}}",
+		"BotName":         "kudos",
+		"ChannelID":       "C1",
+		"Count":           3,
+		"Description":     "Where kudos are confirmed",
+		"Emoji":           ":star:",
+		"Error":           "invalid value",
+		"From":            day1,
+		"GiverID":         "U1",
+		"KudosID":         42,
+		"Limit":           5,
+		"Milestones":      "10, 50, 100",
+		"Minutes":         5,
+		"More":            1,
+		"Name":            "Star",
+		"Permalink":       "https://slack.test/archives/C1/p1700000000000001",
+		"Rank":            2,
+		"Reactions":       4,
+		"Reason":          UserText("for the review"),
+		"ResponseMode":    "thread",
+		"Threshold":       10,
+		"To":              day7,
+		"Total":           7,
+		"Uncategorized":   2,
+		"UserID":          "U2",
+		"Value":           "daily",
+	}
+}
+
+func sortedLocales() []string {
+	locales := Locales()
+	sort.Strings(locales)
+	return locales
+}
+
+// copyData copies the top level of the data, which Render may change.
+func copyData(data Data) Data {
+	c := Data{}
+	for k, v := range data {
+		c[k] = v
+	}
+	return c
+}
+
+// golden compares v as indented JSON with the golden file, or writes it to
+// the file with -update.
+func golden(t *testing.T, path string, v interface{}) {
+	t.Helper()
+
+	// Blocks escape their JSON themselves, decoding it again unescapes it
+	raw, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file, run the tests with -update to create it: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("output differs from %s, run the tests with -update and review the diff:\n%s", path, buf.String())
+	}
+}
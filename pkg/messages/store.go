@@ -0,0 +1,66 @@
+package messages
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/kaplan-michael/slack-kudos/pkg/database"
+)
+
+// override returns the workspace's override of a template, if any.
+// Layouts are stored with an empty locale.
+func override(ctx context.Context, teamID, locale, name string) (string, bool) {
+	if teamID == "" || database.DB == nil {
+		return "", false
+	}
+
+	var body string
+	err := database.DB.QueryRowContext(ctx,
+		`SELECT body FROM message_templates WHERE team_id = ? AND locale = ? AND name = ?`,
+		teamID, locale, name,
+	).Scan(&body)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.FromContext(ctx).Warnf("Failed to get template %s (%s) for workspace %s: %v", name, locale, teamID, err)
+		}
+		return "", false
+	}
+	return body, true
+}
+
+// SetOverride stores a workspace's override of a template.
+// An empty locale selects a layout.
+func SetOverride(ctx context.Context, teamID, locale, name, body string) error {
+	if err := Validate(ctx, teamID, locale, name, body); err != nil {
+		return err
+	}
+
+	_, err := database.DB.ExecContext(ctx, `
+		INSERT INTO message_templates (team_id, locale, name, body, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(team_id, locale, name)
+		DO UPDATE SET body = excluded.body, updated_at = excluded.updated_at`,
+		teamID, locale, name, body, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save template %s: %w", name, err)
+	}
+	return nil
+}
+
+// ResetOverride removes a workspace's override of a template.
+// An empty locale selects a layout.
+func ResetOverride(ctx context.Context, teamID, locale, name string) error {
+	_, err := database.DB.ExecContext(ctx,
+		`DELETE FROM message_templates WHERE team_id = ? AND locale = ? AND name = ?`,
+		teamID, locale, name,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to reset template %s: %w", name, err)
+	}
+	return nil
+}
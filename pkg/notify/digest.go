@@ -0,0 +1,166 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/charmbracelet/log"
+	"github.com/kaplan-michael/slack-kudos/pkg/database"
+	"github.com/kaplan-michael/slack-kudos/pkg/messages"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+	"github.com/kaplan-michael/slack-kudos/pkg/schedule"
+)
+
+// maxDigestEntries limits the number of kudos listed in a single digest.
+const maxDigestEntries = 20
+
+// pending is a queued notification joined with its kudos.
+type pending struct {
+	id        int64
+	userID    string
+	giverID   string
+	anonymous bool
+	channelID string
+	messageTS string
+	reason    string
+	revoked   bool
+}
+
+// DigestJobName is the name of the scheduled job that sends the daily digests.
+const DigestJobName = "notification_digests"
+
+// RegisterDigests schedules the daily digests every day at the given hour
+// (server time). A digest missed while the bot was down is sent once it's
+// back, so queued notifications don't wait another day.
+func RegisterDigests(ctx context.Context, hour int, clients respond.ClientLookup) error {
+	schedule.Register(DigestJobName, func(ctx context.Context, job schedule.Job) error {
+		FlushDigests(ctx, clients)
+		return nil
+	})
+
+	// The job isn't tied to a workspace, it sends the digests of all of them
+	expr := fmt.Sprintf("0 %d * * *", hour)
+	return schedule.Ensure(ctx, "", DigestJobName, expr, "Local", schedule.CatchUpOnce)
+}
+
+// FlushDigests sends every queued notification as one digest per user.
+func FlushDigests(ctx context.Context, clients respond.ClientLookup) {
+	teams, err := pendingTeams(ctx)
+	if err != nil {
+		log.FromContext(ctx).Warnf("Failed to get workspaces with pending notifications: %v", err)
+		return
+	}
+
+	for _, teamID := range teams {
+		api, ok := clients(teamID)
+		if !ok {
+			log.FromContext(ctx).Warnf("Skipping notification digests for workspace %s, no client available", teamID)
+			continue
+		}
+		if err := flushTeam(ctx, api, teamID); err != nil {
+			log.FromContext(ctx).Warnf("Failed to send notification digests in workspace %s: %v", teamID, err)
+		}
+	}
+}
+
+func pendingTeams(ctx context.Context) ([]string, error) {
+	rows, err := database.DB.QueryContext(ctx, `SELECT DISTINCT team_id FROM pending_notifications`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pending notifications: %w", err)
+	}
+	defer rows.Close()
+
+	var teams []string
+	for rows.Next() {
+		var teamID string
+		if err := rows.Scan(&teamID); err != nil {
+			return nil, fmt.Errorf("failed to scan workspace: %w", err)
+		}
+		teams = append(teams, teamID)
+	}
+	return teams, rows.Err()
+}
+
+// flushTeam sends the digests of a single workspace.
+func flushTeam(ctx context.Context, api respond.Responder, teamID string) error {
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT p.id, p.user_id, k.giver_id, k.anonymous, k.channel_id,
+		       k.message_ts, k.reason, k.revoked_at IS NOT NULL
+		FROM pending_notifications p
+		JOIN kudos_log k ON k.id = p.kudos_id
+		WHERE p.team_id = ?
+		ORDER BY p.user_id, p.id`, teamID)
+	if err != nil {
+		return fmt.Errorf("failed to query pending notifications: %w", err)
+	}
+
+	byUser := map[string][]pending{}
+	var users []string
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.userID, &p.giverID, &p.anonymous, &p.channelID, &p.messageTS, &p.reason, &p.revoked); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan pending notification: %w", err)
+		}
+		if _, ok := byUser[p.userID]; !ok {
+			users = append(users, p.userID)
+		}
+		byUser[p.userID] = append(byUser[p.userID], p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	for _, userID := range users {
+		queued := byUser[userID]
+		if err := sendDigest(ctx, api, teamID, userID, queued); err != nil {
+			// Keep the notifications queued for the next digest
+			log.FromContext(ctx).Warnf("Failed to send notification digest to user %s: %v", userID, err)
+			continue
+		}
+
+		_, err := database.DB.ExecContext(ctx,
+			`DELETE FROM pending_notifications WHERE team_id = ? AND user_id = ? AND id <= ?`,
+			teamID, userID, queued[len(queued)-1].id,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to clear pending notifications of user %s: %w", userID, err)
+		}
+	}
+
+	return nil
+}
+
+// sendDigest sends one DM summarizing the queued kudos of a user.
+// Kudos undone since they were queued are left out.
+func sendDigest(ctx context.Context, api respond.Responder, teamID, userID string, queued []pending) error {
+	var entries []Entry
+	for _, p := range queued {
+		if p.revoked {
+			continue
+		}
+		entries = append(entries, newEntry(ctx, api, p.giverID, p.anonymous, p.reason, p.channelID, p.messageTS))
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	total := len(entries)
+	if len(entries) > maxDigestEntries {
+		entries = entries[:maxDigestEntries]
+	}
+
+	locale := messages.Locale(ctx, api, teamID, userID)
+	msg, err := messages.Render(ctx, teamID, locale, "notification_digest", messages.Data{
+		"Count":   total,
+		"Entries": entries,
+		"More":    total - len(entries),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, _, err = respond.DM(ctx, api, userID, msg)
+	return err
+}
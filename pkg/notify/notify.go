@@ -0,0 +1,99 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/kaplan-michael/slack-kudos/pkg/database"
+	"github.com/kaplan-michael/slack-kudos/pkg/kudos"
+	"github.com/kaplan-michael/slack-kudos/pkg/messages"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+	"github.com/kaplan-michael/slack-kudos/pkg/settings"
+)
+
+// Entry describes a received kudos in a notification.
+type Entry struct {
+	GiverID   string
+	Anonymous bool
+	Reason    messages.UserText
+	ChannelID string
+	Permalink string
+}
+
+// Recipient lets the recipient of a kudos know about it by DM, right away
+// or in the next daily digest, depending on their notification preference.
+func Recipient(ctx context.Context, api respond.Responder, k kudos.Kudos) error {
+	// Only positive kudos from someone else are worth a notification
+	if k.Amount <= 0 || k.GiverID == k.RecipientID {
+		return nil
+	}
+
+	preference, err := settings.GetForUser(ctx, k.TeamID, k.RecipientID, settings.Notifications)
+	if err != nil {
+		return fmt.Errorf("failed to get notification preference: %w", err)
+	}
+
+	switch preference {
+	case settings.NotifyInstant:
+		return sendInstant(ctx, api, k)
+	case settings.NotifyDaily:
+		return queue(ctx, k)
+	}
+	return nil
+}
+
+// sendInstant sends a DM about a single kudos to its recipient.
+func sendInstant(ctx context.Context, api respond.Responder, k kudos.Kudos) error {
+	locale := messages.Locale(ctx, api, k.TeamID, k.RecipientID)
+	entry := newEntry(ctx, api, k.GiverID, k.Anonymous, k.Reason, k.ChannelID, k.MessageTS)
+
+	msg, err := messages.Render(ctx, k.TeamID, locale, "notification", messages.Data{
+		"GiverID":   entry.GiverID,
+		"Anonymous": entry.Anonymous,
+		"Reason":    entry.Reason,
+		"ChannelID": entry.ChannelID,
+		"Permalink": entry.Permalink,
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, _, err := respond.DM(ctx, api, k.RecipientID, msg); err != nil {
+		return err
+	}
+
+	log.FromContext(ctx).Debugf("Notified user %s about kudos %d in workspace %s", k.RecipientID, k.ID, k.TeamID)
+	return nil
+}
+
+// queue stores the kudos for the recipient's next daily digest.
+func queue(ctx context.Context, k kudos.Kudos) error {
+	_, err := database.DB.ExecContext(ctx, `
+		INSERT INTO pending_notifications (team_id, user_id, kudos_id, created_at)
+		VALUES (?, ?, ?, ?)`, k.TeamID, k.RecipientID, k.ID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to queue notification for user %s: %w", k.RecipientID, err)
+	}
+	return nil
+}
+
+// newEntry builds a notification entry, resolving the permalink of the
+// message the kudos was given in. Anonymous kudos have no message.
+func newEntry(ctx context.Context, api respond.Responder, giverID string, anonymous bool, reason, channelID, messageTS string) Entry {
+	entry := Entry{GiverID: giverID, Anonymous: anonymous, Reason: messages.UserText(reason), ChannelID: channelID}
+	if anonymous {
+		entry.GiverID = ""
+	}
+
+	if messageTS != "" {
+		permalink, err := respond.Permalink(ctx, api, channelID, messageTS)
+		if err != nil {
+			log.FromContext(ctx).Warnf("Failed to link notification to the kudos message: %v", err)
+		} else {
+			entry.Permalink = permalink
+		}
+	}
+	return entry
+}
@@ -1,6 +1,7 @@
 package oauth2
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -32,6 +33,7 @@ type OAuthHandler struct {
 	clientSecret string
 	redirectURI  string
 	scopes       []string
+	installHooks []func(creds WorkspaceCredentials)
 }
 
 // NewOAuthHandler creates a new OAuth handler
@@ -41,17 +43,28 @@ func NewOAuthHandler() *OAuthHandler {
 		clientSecret: config.AppConfig.SlackClientSecret,
 		redirectURI:  config.AppConfig.SlackRedirectURI,
 		scopes: []string{
+			"app_mentions:read",
 			"channels:history",
 			"channels:read",
 			"chat:write",
 			"commands",
 			"groups:history",
+			"groups:read",
 			"im:history",
+			"im:write",
+			"reactions:read",
+			"reactions:write",
 			"users:read",
 		},
 	}
 }
 
+// OnInstall registers a function called with the saved credentials after a
+// workspace installed or re-installed the app
+func (h *OAuthHandler) OnInstall(fn func(creds WorkspaceCredentials)) {
+	h.installHooks = append(h.installHooks, fn)
+}
+
 // StartOAuth initiates the OAuth process by redirecting to Slack's authorization page
 func (h *OAuthHandler) StartOAuth(w http.ResponseWriter, r *http.Request) {
 	url := fmt.Sprintf(
@@ -65,6 +78,7 @@ func (h *OAuthHandler) StartOAuth(w http.ResponseWriter, r *http.Request) {
 
 // OAuthCallback handles the OAuth callback from Slack
 func (h *OAuthHandler) OAuthCallback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	code := r.URL.Query().Get("code")
 	if code == "" {
 		http.Error(w, "Code not found", http.StatusBadRequest)
@@ -75,7 +89,8 @@ func (h *OAuthHandler) OAuthCallback(w http.ResponseWriter, r *http.Request) {
 	httpClient := &http.Client{}
 
 	// Exchange the code for an access token
-	response, err := slack.GetOAuthV2Response(
+	response, err := slack.GetOAuthV2ResponseContext(
+		ctx,
 		httpClient,
 		h.clientID,
 		h.clientSecret,
@@ -105,14 +120,19 @@ func (h *OAuthHandler) OAuthCallback(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Save workspace credentials
-	if err := SaveWorkspaceCredentials(creds); err != nil {
+	if err := SaveWorkspaceCredentials(ctx, creds); err != nil {
 		http.Error(w, "Failed to save workspace credentials: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// Start serving the workspace right away
+	for _, fn := range h.installHooks {
+		fn(creds)
+	}
+
 	// Get bot info to display username
 	api := slack.New(creds.AccessToken)
-	botInfo, err := api.AuthTest()
+	botInfo, err := api.AuthTestContext(ctx)
 	botName := "the bot"
 	if err == nil && botInfo != nil {
 		botName = "@" + botInfo.User
@@ -179,7 +199,7 @@ func (h *OAuthHandler) OAuthCallback(w http.ResponseWriter, r *http.Request) {
 }
 
 // SaveWorkspaceCredentials saves the workspace credentials to the database
-func SaveWorkspaceCredentials(creds WorkspaceCredentials) error {
+func SaveWorkspaceCredentials(ctx context.Context, creds WorkspaceCredentials) error {
 	scopesJSON, err := json.Marshal(creds.Scopes)
 	if err != nil {
 		return fmt.Errorf("failed to marshal scopes: %w", err)
@@ -197,7 +217,7 @@ func SaveWorkspaceCredentials(creds WorkspaceCredentials) error {
 		expiresAt = &creds.ExpiresAt
 	}
 
-	_, err = database.DB.Exec(
+	_, err = database.DB.ExecContext(ctx,
 		query,
 		creds.TeamID,
 		creds.TeamName,
@@ -213,7 +233,7 @@ func SaveWorkspaceCredentials(creds WorkspaceCredentials) error {
 }
 
 // GetWorkspaceCredentials retrieves credentials for a specific workspace
-func GetWorkspaceCredentials(teamID string) (WorkspaceCredentials, error) {
+func GetWorkspaceCredentials(ctx context.Context, teamID string) (WorkspaceCredentials, error) {
 	var creds WorkspaceCredentials
 	var expiresAt sql.NullTime
 	var scopesStr string
@@ -225,7 +245,7 @@ func GetWorkspaceCredentials(teamID string) (WorkspaceCredentials, error) {
 		WHERE team_id = ?
 	`
 
-	err := database.DB.QueryRow(query, teamID).Scan(
+	err := database.DB.QueryRowContext(ctx, query, teamID).Scan(
 		&creds.TeamID,
 		&creds.TeamName,
 		&creds.AccessToken,
@@ -251,17 +271,18 @@ func GetWorkspaceCredentials(teamID string) (WorkspaceCredentials, error) {
 	return creds, nil
 }
 
-// GetAllWorkspaceCredentials retrieves all workspace credentials
-func GetAllWorkspaceCredentials() ([]WorkspaceCredentials, error) {
+// GetAllWorkspaceCredentials retrieves the credentials of all installed workspaces
+func GetAllWorkspaceCredentials(ctx context.Context) ([]WorkspaceCredentials, error) {
 	var workspaces []WorkspaceCredentials
 
 	query := `
 		SELECT team_id, team_name, access_token, bot_user_id, 
 		       scopes, expires_at, refresh_token, last_updated 
 		FROM workspaces
+		WHERE uninstalled_at IS NULL
 	`
 
-	rows, err := database.DB.Query(query)
+	rows, err := database.DB.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query workspaces: %w", err)
 	}
@@ -305,41 +326,23 @@ func GetAllWorkspaceCredentials() ([]WorkspaceCredentials, error) {
 	return workspaces, nil
 }
 
-// RefreshTokenIfNeeded checks if a token needs refreshing and refreshes it
-// This is a package-level function to be called from main
-func RefreshTokenIfNeeded(teamID string) error {
-	creds, err := GetWorkspaceCredentials(teamID)
+// RefreshTokenIfNeeded refreshes the workspace's token when it expires
+// within the next hour
+func RefreshTokenIfNeeded(ctx context.Context, teamID string) error {
+	mu := refreshLock(teamID)
+	mu.Lock()
+	defer mu.Unlock()
+
+	creds, err := GetWorkspaceCredentials(ctx, teamID)
 	if err != nil {
 		return err
 	}
 
 	// If token doesn't expire or is not close to expiry, return
-	if creds.ExpiresAt.IsZero() || time.Until(creds.ExpiresAt) > 1*time.Hour {
+	if creds.ExpiresAt.IsZero() || time.Until(creds.ExpiresAt) > refreshBefore {
 		return nil
 	}
 
-	// Use client ID and secret from config
-	clientID := config.AppConfig.SlackClientID
-	clientSecret := config.AppConfig.SlackClientSecret
-
-	// Create HTTP client
-	httpClient := &http.Client{}
-
-	// Token needs refreshing
-	resp, err := slack.RefreshOAuthV2Token(httpClient, creds.RefreshToken, clientID, clientSecret)
-	if err != nil {
-		return fmt.Errorf("failed to refresh token: %w", err)
-	}
-
-	// Update credentials with new tokens
-	creds.AccessToken = resp.AccessToken
-	creds.ExpiresAt = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
-	creds.LastUpdated = time.Now()
-
-	if resp.RefreshToken != "" {
-		creds.RefreshToken = resp.RefreshToken
-	}
-
-	// Save updated credentials
-	return SaveWorkspaceCredentials(creds)
+	_, err = refresh(ctx, creds)
+	return err
 }
@@ -0,0 +1,289 @@
+package oauth2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/slack-go/slack"
+
+	"github.com/kaplan-michael/slack-kudos/pkg/config"
+	"github.com/kaplan-michael/slack-kudos/pkg/schedule"
+)
+
+// RefreshJobName is the name of the scheduled job that refreshes expiring tokens.
+const RefreshJobName = "token_refresh"
+
+// refreshBefore is how long before expiry a token is refreshed.
+const refreshBefore = 1 * time.Hour
+
+var (
+	// tokens are the current access tokens of the workspaces, used by the
+	// clients created with NewHTTPClient
+	tokens   = map[string]string{}
+	tokensMu sync.RWMutex
+
+	// refreshing serializes the refreshes of each workspace, a refresh
+	// token can only be used once
+	refreshing   = map[string]*sync.Mutex{}
+	refreshingMu sync.Mutex
+
+	refreshHooks []func(creds WorkspaceCredentials)
+)
+
+// SetToken sets the current access token of a workspace. Clients created
+// with NewHTTPClient use it from their next request on.
+func SetToken(teamID, token string) {
+	tokensMu.Lock()
+	defer tokensMu.Unlock()
+	tokens[teamID] = token
+}
+
+func currentToken(teamID string) (string, bool) {
+	tokensMu.RLock()
+	defer tokensMu.RUnlock()
+	token, ok := tokens[teamID]
+	return token, ok
+}
+
+// OnRefresh registers a function called with the new credentials after a
+// workspace's token was refreshed. Register hooks at startup.
+func OnRefresh(fn func(creds WorkspaceCredentials)) {
+	refreshHooks = append(refreshHooks, fn)
+}
+
+// RegisterRefresh schedules refreshing the tokens that are about to expire.
+func RegisterRefresh(ctx context.Context) error {
+	schedule.Register(RefreshJobName, func(ctx context.Context, job schedule.Job) error {
+		return refreshExpiring(ctx)
+	})
+
+	// Tokens are checked at startup, so missed runs don't need catching up
+	return schedule.Ensure(ctx, "", RefreshJobName, "*/5 * * * *", "UTC", schedule.CatchUpSkip)
+}
+
+// refreshExpiring refreshes the token of every workspace that expires soon.
+func refreshExpiring(ctx context.Context) error {
+	workspaces, err := GetAllWorkspaceCredentials(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, creds := range workspaces {
+		if err := RefreshTokenIfNeeded(ctx, creds.TeamID); err != nil {
+			errs = append(errs, fmt.Errorf("workspace %s: %w", creds.TeamID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// refresh exchanges the workspace's refresh token for a new access token,
+// saves it and notifies the OnRefresh hooks. Callers hold the workspace's
+// refresh lock.
+func refresh(ctx context.Context, creds WorkspaceCredentials) (WorkspaceCredentials, error) {
+	if creds.RefreshToken == "" {
+		return creds, fmt.Errorf("workspace %s has no refresh token", creds.TeamID)
+	}
+
+	resp, err := slack.RefreshOAuthV2TokenContext(
+		ctx,
+		&http.Client{},
+		config.AppConfig.SlackClientID,
+		config.AppConfig.SlackClientSecret,
+		creds.RefreshToken,
+	)
+	if err != nil {
+		return creds, fmt.Errorf("failed to refresh token: %w", err)
+	}
+
+	// Update credentials with new tokens
+	creds.AccessToken = resp.AccessToken
+	creds.ExpiresAt = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+	creds.LastUpdated = time.Now()
+	if resp.RefreshToken != "" {
+		creds.RefreshToken = resp.RefreshToken
+	}
+
+	// Slack has already rotated the refresh token, so the new one is saved
+	// even when the caller gave up in the meantime
+	if err := SaveWorkspaceCredentials(context.Background(), creds); err != nil {
+		return creds, fmt.Errorf("failed to save refreshed token: %w", err)
+	}
+
+	SetToken(creds.TeamID, creds.AccessToken)
+	for _, fn := range refreshHooks {
+		fn(creds)
+	}
+
+	log.Infof("Refreshed token of workspace %s, expires at %s", creds.TeamID, creds.ExpiresAt)
+	return creds, nil
+}
+
+// refreshLock returns the lock serializing the refreshes of a workspace.
+func refreshLock(teamID string) *sync.Mutex {
+	refreshingMu.Lock()
+	defer refreshingMu.Unlock()
+
+	mu, ok := refreshing[teamID]
+	if !ok {
+		mu = &sync.Mutex{}
+		refreshing[teamID] = mu
+	}
+	return mu
+}
+
+// refreshRejected refreshes a token Slack rejected and returns the new one.
+// When another request already refreshed it, the current token is returned.
+func refreshRejected(ctx context.Context, teamID, rejected string) (string, error) {
+	mu := refreshLock(teamID)
+	mu.Lock()
+	defer mu.Unlock()
+
+	if token, ok := currentToken(teamID); ok && token != rejected {
+		return token, nil
+	}
+
+	creds, err := GetWorkspaceCredentials(ctx, teamID)
+	if err != nil {
+		return "", err
+	}
+	// Saved by another process sharing the database
+	if creds.AccessToken != rejected {
+		SetToken(teamID, creds.AccessToken)
+		return creds.AccessToken, nil
+	}
+
+	creds, err = refresh(ctx, creds)
+	if err != nil {
+		return "", err
+	}
+	return creds.AccessToken, nil
+}
+
+// TokenClient sends Slack API requests with the workspace's current token.
+// When Slack rejects the token as invalid or expired, it refreshes the
+// token and retries the request once.
+type TokenClient struct {
+	teamID string
+	client *http.Client
+}
+
+// NewHTTPClient returns an HTTP client for slack.OptionHTTPClient that
+// keeps the workspace's requests working across token refreshes.
+func NewHTTPClient(teamID string) *TokenClient {
+	return &TokenClient{teamID: teamID, client: &http.Client{}}
+}
+
+// Do sends the request with the current token, retrying once after a refresh.
+func (c *TokenClient) Do(req *http.Request) (*http.Response, error) {
+	sent, ok := currentToken(c.teamID)
+	if !ok {
+		return c.client.Do(req)
+	}
+
+	// Keep the body, so the request can be sent again
+	var body []byte
+	if req.Body != nil {
+		if !replayable(req) {
+			// File uploads are streamed and can't be retried
+			out, _ := withToken(req, nil, sent)
+			return c.client.Do(out)
+		}
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+
+	out, replaced := withToken(req, body, sent)
+	resp, err := c.client.Do(out)
+	// Only workspace tokens can be refreshed
+	if err != nil || !replaced || !rejected(resp) {
+		return resp, err
+	}
+
+	token, err := refreshRejected(req.Context(), c.teamID, sent)
+	if err != nil {
+		log.Warnf("Slack rejected the token of workspace %s and it couldn't be refreshed: %v", c.teamID, err)
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	log.Infof("Retrying %s with the refreshed token of workspace %s", req.URL.Path, c.teamID)
+	out, _ = withToken(req, body, token)
+	return c.client.Do(out)
+}
+
+// replayable reports whether the request's body can be read into memory.
+func replayable(req *http.Request) bool {
+	contentType := req.Header.Get("Content-Type")
+	return strings.HasPrefix(contentType, "application/x-www-form-urlencoded") ||
+		strings.HasPrefix(contentType, "application/json")
+}
+
+// withToken returns a copy of the request using the token, and whether
+// the request had a token to replace. Only workspace tokens are replaced,
+// the app-level token used by Socket Mode is kept.
+func withToken(req *http.Request, body []byte, token string) (*http.Request, bool) {
+	out := req.Clone(req.Context())
+	replaced := false
+
+	if auth := out.Header.Get("Authorization"); isWorkspaceToken(strings.TrimPrefix(auth, "Bearer ")) {
+		out.Header.Set("Authorization", "Bearer "+token)
+		replaced = true
+	}
+
+	if body == nil {
+		return out, replaced
+	}
+	if strings.HasPrefix(out.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		if values, err := url.ParseQuery(string(body)); err == nil && isWorkspaceToken(values.Get("token")) {
+			values.Set("token", token)
+			body = []byte(values.Encode())
+			replaced = true
+		}
+	}
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	out.ContentLength = int64(len(body))
+	out.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return out, replaced
+}
+
+// isWorkspaceToken reports whether a token is a bot or user token.
+func isWorkspaceToken(token string) bool {
+	return strings.HasPrefix(token, "xox")
+}
+
+// rejected reports whether Slack rejected the request's token. The
+// response body is restored for the caller.
+func rejected(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return false
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+
+	var result slack.SlackResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return false
+	}
+	return !result.Ok && (result.Error == "invalid_auth" || result.Error == "token_expired")
+}
@@ -0,0 +1,99 @@
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/kaplan-michael/slack-kudos/pkg/database"
+	"github.com/kaplan-michael/slack-kudos/pkg/schedule"
+)
+
+// PurgeJobName is the name of the scheduled job that deletes the data of
+// uninstalled workspaces.
+const PurgeJobName = "purge_uninstalled"
+
+var uninstallHooks []func(teamID string)
+
+// OnUninstall registers a function called after a workspace uninstalled the
+// app or revoked its token. Register hooks at startup.
+func OnUninstall(fn func(teamID string)) {
+	uninstallHooks = append(uninstallHooks, fn)
+}
+
+// Uninstall marks a workspace as uninstalled and forgets its tokens. Its
+// data is kept until it's purged, a re-install makes it active again.
+func Uninstall(ctx context.Context, teamID string) error {
+	_, err := database.DB.ExecContext(ctx, `
+		UPDATE workspaces
+		SET access_token = '', refresh_token = '', expires_at = NULL,
+		    uninstalled_at = ?, last_updated = ?
+		WHERE team_id = ?`,
+		time.Now(), time.Now(), teamID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark workspace %s uninstalled: %w", teamID, err)
+	}
+
+	tokensMu.Lock()
+	delete(tokens, teamID)
+	tokensMu.Unlock()
+
+	for _, fn := range uninstallHooks {
+		fn(teamID)
+	}
+
+	log.Infof("Workspace %s uninstalled the app", teamID)
+	return nil
+}
+
+// RegisterPurge schedules deleting the data of workspaces uninstalled more
+// than the given number of days ago. Nothing is scheduled for 0 days.
+func RegisterPurge(ctx context.Context, days int) error {
+	if days <= 0 {
+		return schedule.Remove(ctx, "", PurgeJobName)
+	}
+
+	schedule.Register(PurgeJobName, func(ctx context.Context, job schedule.Job) error {
+		return purgeUninstalled(ctx, time.Now().AddDate(0, 0, -days))
+	})
+
+	return schedule.Ensure(ctx, "", PurgeJobName, "0 3 * * *", "Local", schedule.CatchUpOnce)
+}
+
+// purgeUninstalled deletes the data of workspaces uninstalled before the given time.
+func purgeUninstalled(ctx context.Context, before time.Time) error {
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT team_id FROM workspaces
+		WHERE uninstalled_at IS NOT NULL AND uninstalled_at < ?`, before)
+	if err != nil {
+		return fmt.Errorf("failed to query uninstalled workspaces: %w", err)
+	}
+
+	var teams []string
+	for rows.Next() {
+		var teamID string
+		if err := rows.Scan(&teamID); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan workspace: %w", err)
+		}
+		teams = append(teams, teamID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating workspace rows: %w", err)
+	}
+
+	var errs []error
+	for _, teamID := range teams {
+		if err := database.PurgeWorkspace(ctx, teamID); err != nil {
+			errs = append(errs, fmt.Errorf("workspace %s: %w", teamID, err))
+			continue
+		}
+		log.Infof("Purged the data of uninstalled workspace %s", teamID)
+	}
+	return errors.Join(errs...)
+}
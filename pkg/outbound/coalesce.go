@@ -0,0 +1,145 @@
+package outbound
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/kaplan-michael/slack-kudos/pkg/messages"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+	"github.com/slack-go/slack"
+)
+
+// coalesceWindow is how long after the last reply in a thread the next
+// one is merged into it.
+const coalesceWindow = 2 * time.Minute
+
+// maxBlocks is the most blocks Slack allows in a message.
+const maxBlocks = 50
+
+// thread is the bot's last reply in a thread, made of the replies merged
+// into it.
+type thread struct {
+	mu        sync.Mutex
+	channelID string
+	ts        string
+	parts     []messages.Message
+	last      time.Time
+}
+
+// CoalesceThreadReply posts a reply to a thread. A reply following another
+// one within the coalesce window is added to it instead, so that a burst
+// of kudos in a thread gets one reply that's edited as they come in.
+func (q *Queue) CoalesceThreadReply(ctx context.Context, channelID, threadTS string, msg messages.Message) (string, error) {
+	t := q.thread(channelID, threadTS, time.Now())
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.ts != "" && time.Since(t.last) < coalesceWindow && blockCount(t.parts)+len(msg.Blocks.BlockSet) <= maxBlocks {
+		ts, err := q.addToReply(ctx, t, msg)
+		if err == nil || !gone(err) {
+			return ts, err
+		}
+		log.FromContext(ctx).Debugf("Reply %s in channel %s can't be edited anymore, posting a new one: %v", t.ts, channelID, err)
+	}
+
+	options := append(msg.Options(), slack.MsgOptionTS(threadTS))
+	_, ts, err := q.PostMessageContext(ctx, channelID, options...)
+	if err != nil {
+		return "", fmt.Errorf("failed to post thread reply: %w", err)
+	}
+	q.remember(channelID, threadTS, t.ts, ts)
+	t.ts = ts
+	t.parts = []messages.Message{msg}
+	t.last = time.Now()
+	return ts, nil
+}
+
+// addToReply edits the thread's last reply to add the message.
+func (q *Queue) addToReply(ctx context.Context, t *thread, msg messages.Message) (string, error) {
+	parts := append(append([]messages.Message(nil), t.parts...), msg)
+	combined, err := respond.Combine(parts)
+	if err != nil {
+		return "", err
+	}
+
+	if _, _, _, err := q.update(ctx, t.channelID, t.ts, combined.Options()...); err != nil {
+		return "", fmt.Errorf("failed to add to thread reply: %w", err)
+	}
+	t.parts = parts
+	t.last = time.Now()
+	return t.ts, nil
+}
+
+// gone reports whether an edit failed because the reply was deleted or
+// is too old to be edited.
+func gone(err error) bool {
+	var slackErr slack.SlackErrorResponse
+	if !errors.As(err, &slackErr) {
+		return false
+	}
+	switch slackErr.Err {
+	case "message_not_found", "cant_update_message", "edit_window_closed":
+		return true
+	}
+	return false
+}
+
+func blockCount(parts []messages.Message) int {
+	n := 0
+	for _, part := range parts {
+		n += len(part.Blocks.BlockSet)
+	}
+	return n
+}
+
+// thread returns the last reply in a thread, creating an empty one. The
+// replies of threads that went quiet are forgotten once in a while.
+func (q *Queue) thread(channelID, threadTS string, now time.Time) *thread {
+	q.threadsMu.Lock()
+	defer q.threadsMu.Unlock()
+
+	if now.Sub(q.lastSweep) > coalesceWindow {
+		for key, t := range q.threads {
+			if t.mu.TryLock() {
+				if now.Sub(t.last) > coalesceWindow {
+					delete(q.threads, key)
+					delete(q.replies, t.channelID+"/"+t.ts)
+				}
+				t.mu.Unlock()
+			}
+		}
+		q.lastSweep = now
+	}
+
+	key := channelID + "/" + threadTS
+	t, ok := q.threads[key]
+	if !ok {
+		t = &thread{channelID: channelID}
+		q.threads[key] = t
+	}
+	return t
+}
+
+// remember records which thread a reply was posted to, see forgetReply.
+// It replaces the thread's previous reply.
+func (q *Queue) remember(channelID, threadTS, previousTS, ts string) {
+	q.threadsMu.Lock()
+	defer q.threadsMu.Unlock()
+	delete(q.replies, channelID+"/"+previousTS)
+	q.replies[channelID+"/"+ts] = channelID + "/" + threadTS
+}
+
+// forgetReply stops merging replies into a message.
+func (q *Queue) forgetReply(channelID, ts string) {
+	q.threadsMu.Lock()
+	defer q.threadsMu.Unlock()
+
+	if key, ok := q.replies[channelID+"/"+ts]; ok {
+		delete(q.threads, key)
+		delete(q.replies, channelID+"/"+ts)
+	}
+}
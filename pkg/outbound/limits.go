@@ -0,0 +1,79 @@
+package outbound
+
+import (
+	"sync"
+	"time"
+)
+
+// limit is how often a workspace may call a Slack API method.
+type limit struct {
+	perMinute int
+	// perChannel applies the limit to each channel on its own
+	perChannel bool
+}
+
+// limits are the rate limit tiers of the methods the bot calls, see
+// https://api.slack.com/apis/rate-limits. Tier 3 allows 50 calls per
+// minute, tier 4 allows 100. Calls of other methods aren't held back.
+var limits = map[string]limit{
+	// Slack allows about one message per second in a channel
+	"chat.postMessage":   {perMinute: 60, perChannel: true},
+	"chat.postEphemeral": {perMinute: 100},
+	"chat.update":        {perMinute: 50},
+	"chat.getPermalink":  {perMinute: 100},
+	"reactions.add":      {perMinute: 50},
+	"conversations.open": {perMinute: 50},
+	"conversations.info": {perMinute: 50},
+	"users.info":         {perMinute: 100},
+	"auth.test":          {perMinute: 100},
+}
+
+// bucket hands out the turns of the calls limited together. Calls are
+// spread evenly over the minute, bursts of a tenth of the limit are let
+// through right away. Turns are handed out in the order they were asked
+// for, so the calls form a queue.
+type bucket struct {
+	mu       sync.Mutex
+	interval time.Duration
+	// burst is how far ahead of the even spread a call may go
+	burst time.Duration
+	// next is when the next call would go out with an even spread
+	next time.Time
+}
+
+func newBucket(l limit) *bucket {
+	interval := time.Minute / time.Duration(l.perMinute)
+	burst := l.perMinute / 10
+	if burst < 1 {
+		burst = 1
+	}
+	return &bucket{interval: interval, burst: interval * time.Duration(burst-1)}
+}
+
+// Reserve takes the next turn and returns how long to wait for it.
+func (b *bucket) Reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.next.Before(now) {
+		b.next = now
+	}
+	wait := b.next.Sub(now) - b.burst
+	if wait < 0 {
+		wait = 0
+	}
+	b.next = b.next.Add(b.interval)
+	return wait
+}
+
+// Pause holds back the calls that didn't get their turn yet, e.g. for the
+// Retry-After of a rate limited call.
+func (b *bucket) Pause(now time.Time, d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	until := now.Add(d + b.burst)
+	if b.next.Before(until) {
+		b.next = until
+	}
+}
@@ -0,0 +1,277 @@
+// Package outbound queues the Slack API calls of a workspace. Every call
+// waits its turn under the rate limit tier of its method, calls Slack
+// rejects with 429 hold back the method for the Retry-After it asked for,
+// and calls failing with a transient error are retried. Calls posting a
+// message are only retried when Slack rejected them, as a post failing
+// otherwise, e.g. with a timeout, may have gone through. Replies posted to
+// a thread in quick succession are merged into one edited reply.
+package outbound
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+	"github.com/slack-go/slack"
+)
+
+// maxAttempts is how often a call is tried before its error is returned.
+const maxAttempts = 4
+
+// firstRetryDelay is the wait before retrying a call that failed with a
+// transient error, it doubles after every attempt.
+const firstRetryDelay = 500 * time.Millisecond
+
+// posts are the methods posting a message, which shows up twice when a
+// post that went through is retried.
+var posts = map[string]bool{
+	"chat.postMessage":   true,
+	"chat.postEphemeral": true,
+	"webhook":            true,
+}
+
+// Metrics, served at /debug/vars with the dispatcher's.
+var (
+	// rateLimited counts the calls Slack rejected with 429, by method
+	rateLimited = expvar.NewMap("slack_rate_limited")
+	// retried counts the calls retried after a transient error, by method
+	retried = expvar.NewMap("slack_retried")
+)
+
+// Queue is the Slack API client of a workspace as a respond.Responder
+// whose calls are queued, see the package documentation. It's safe for
+// concurrent use.
+type Queue struct {
+	api respond.Responder
+
+	bucketsMu sync.Mutex
+	buckets   map[string]*bucket
+
+	threadsMu sync.Mutex
+	// threads are the bot's last replies by channel and thread
+	threads map[string]*thread
+	// replies are the threads of the replies by channel and timestamp
+	replies   map[string]string
+	lastSweep time.Time
+}
+
+// New creates the queue of a workspace's client.
+func New(api respond.Responder) *Queue {
+	return &Queue{
+		api:     api,
+		buckets: map[string]*bucket{},
+		threads: map[string]*thread{},
+		replies: map[string]string{},
+	}
+}
+
+// bucket returns the bucket limiting calls of the method, nil when the
+// method isn't limited.
+func (q *Queue) bucket(method, channelID string) *bucket {
+	l, ok := limits[method]
+	if !ok {
+		return nil
+	}
+	key := method
+	if l.perChannel {
+		key += "/" + channelID
+	}
+
+	q.bucketsMu.Lock()
+	defer q.bucketsMu.Unlock()
+	b, ok := q.buckets[key]
+	if !ok {
+		b = newBucket(l)
+		q.buckets[key] = b
+	}
+	return b
+}
+
+// do makes a call of the method when its turn comes and retries it while
+// it fails with a transient error, until ctx is done. Posts are retried
+// only when Slack rejected them.
+func (q *Queue) do(ctx context.Context, method, channelID string, call func() error) error {
+	b := q.bucket(method, channelID)
+	delay := firstRetryDelay
+
+	for attempt := 1; ; attempt++ {
+		if b != nil {
+			if err := sleep(ctx, b.Reserve(time.Now())); err != nil {
+				return err
+			}
+		}
+
+		err := call()
+		if err == nil || attempt == maxAttempts {
+			return err
+		}
+
+		var limitedErr *slack.RateLimitedError
+		switch {
+		case errors.As(err, &limitedErr):
+			rateLimited.Add(method, 1)
+			log.FromContext(ctx).Warnf("Slack rate limited %s, retrying after %s", method, limitedErr.RetryAfter)
+			if b != nil {
+				b.Pause(time.Now(), limitedErr.RetryAfter)
+			} else if err := sleep(ctx, limitedErr.RetryAfter); err != nil {
+				return err
+			}
+
+		case retryable(method, err):
+			retried.Add(method, 1)
+			log.FromContext(ctx).Debugf("Retrying %s in %s: %v", method, delay, err)
+			if err := sleep(ctx, delay); err != nil {
+				return err
+			}
+			delay *= 2
+
+		default:
+			return err
+		}
+	}
+}
+
+// retryable reports whether a failed call of the method can be made again.
+func retryable(method string, err error) bool {
+	if posts[method] {
+		return rejected(err)
+	}
+	return rejected(err) || transient(err)
+}
+
+// rejected reports whether Slack turned a call down without acting on it,
+// the rate limit errors other than 429 responses.
+func rejected(err error) bool {
+	var slackErr slack.SlackErrorResponse
+	return errors.As(err, &slackErr) && slackErr.Err == "ratelimited"
+}
+
+// transient reports whether a call failed for a reason that goes away,
+// e.g. a Slack outage.
+func transient(err error) bool {
+	var retryable interface{ Retryable() bool }
+	if errors.As(err, &retryable) {
+		return retryable.Retryable()
+	}
+
+	var slackErr slack.SlackErrorResponse
+	if errors.As(err, &slackErr) {
+		switch slackErr.Err {
+		case "internal_error", "fatal_error", "service_unavailable", "request_timeout":
+			return true
+		}
+	}
+	return false
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (q *Queue) PostMessageContext(ctx context.Context, channelID string, options ...slack.MsgOption) (string, string, error) {
+	var respChannel, ts string
+	err := q.do(ctx, "chat.postMessage", channelID, func() (err error) {
+		respChannel, ts, err = q.api.PostMessageContext(ctx, channelID, options...)
+		return err
+	})
+	return respChannel, ts, err
+}
+
+func (q *Queue) PostEphemeralContext(ctx context.Context, channelID, userID string, options ...slack.MsgOption) (string, error) {
+	var ts string
+	err := q.do(ctx, "chat.postEphemeral", channelID, func() (err error) {
+		ts, err = q.api.PostEphemeralContext(ctx, channelID, userID, options...)
+		return err
+	})
+	return ts, err
+}
+
+// UpdateMessageContext updates a message. A reply updated this way isn't
+// merged with the next replies of its thread anymore, so that the update,
+// e.g. an undone kudos, isn't overwritten.
+func (q *Queue) UpdateMessageContext(ctx context.Context, channelID, timestamp string, options ...slack.MsgOption) (string, string, string, error) {
+	q.forgetReply(channelID, timestamp)
+	return q.update(ctx, channelID, timestamp, options...)
+}
+
+func (q *Queue) update(ctx context.Context, channelID, timestamp string, options ...slack.MsgOption) (string, string, string, error) {
+	var respChannel, ts, text string
+	err := q.do(ctx, "chat.update", channelID, func() (err error) {
+		respChannel, ts, text, err = q.api.UpdateMessageContext(ctx, channelID, timestamp, options...)
+		return err
+	})
+	return respChannel, ts, text, err
+}
+
+func (q *Queue) AddReactionContext(ctx context.Context, name string, item slack.ItemRef) error {
+	return q.do(ctx, "reactions.add", item.Channel, func() error {
+		return q.api.AddReactionContext(ctx, name, item)
+	})
+}
+
+func (q *Queue) OpenConversationContext(ctx context.Context, params *slack.OpenConversationParameters) (*slack.Channel, bool, bool, error) {
+	var channel *slack.Channel
+	var noOp, alreadyOpen bool
+	err := q.do(ctx, "conversations.open", "", func() (err error) {
+		channel, noOp, alreadyOpen, err = q.api.OpenConversationContext(ctx, params)
+		return err
+	})
+	return channel, noOp, alreadyOpen, err
+}
+
+func (q *Queue) GetPermalinkContext(ctx context.Context, params *slack.PermalinkParameters) (string, error) {
+	var permalink string
+	err := q.do(ctx, "chat.getPermalink", params.Channel, func() (err error) {
+		permalink, err = q.api.GetPermalinkContext(ctx, params)
+		return err
+	})
+	return permalink, err
+}
+
+func (q *Queue) GetConversationInfoContext(ctx context.Context, input *slack.GetConversationInfoInput) (*slack.Channel, error) {
+	var channel *slack.Channel
+	err := q.do(ctx, "conversations.info", input.ChannelID, func() (err error) {
+		channel, err = q.api.GetConversationInfoContext(ctx, input)
+		return err
+	})
+	return channel, err
+}
+
+func (q *Queue) GetUserInfoContext(ctx context.Context, userID string) (*slack.User, error) {
+	var user *slack.User
+	err := q.do(ctx, "users.info", "", func() (err error) {
+		user, err = q.api.GetUserInfoContext(ctx, userID)
+		return err
+	})
+	return user, err
+}
+
+func (q *Queue) AuthTestContext(ctx context.Context) (*slack.AuthTestResponse, error) {
+	var resp *slack.AuthTestResponse
+	err := q.do(ctx, "auth.test", "", func() (err error) {
+		resp, err = q.api.AuthTestContext(ctx)
+		return err
+	})
+	return resp, err
+}
+
+func (q *Queue) PostWebhookContext(ctx context.Context, url string, msg *slack.WebhookMessage) error {
+	return q.do(ctx, "webhook", "", func() error {
+		return q.api.PostWebhookContext(ctx, url, msg)
+	})
+}
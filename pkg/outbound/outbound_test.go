@@ -0,0 +1,460 @@
+package outbound
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kaplan-michael/slack-kudos/pkg/handler/handlertest"
+	"github.com/kaplan-michael/slack-kudos/pkg/messages"
+	"github.com/slack-go/slack"
+)
+
+// fakeAPI records the calls like handlertest.Client, and fails the first
+// calls of a method with the given errors.
+type fakeAPI struct {
+	*handlertest.Client
+
+	mu       sync.Mutex
+	errs     map[string][]error
+	attempts map[string]int
+}
+
+func newFakeAPI() *fakeAPI {
+	return &fakeAPI{Client: handlertest.New("T1"), errs: map[string][]error{}, attempts: map[string]int{}}
+}
+
+// failWith makes the next calls of the method fail, one error per call.
+func (f *fakeAPI) failWith(method string, errs ...error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errs[method] = append(f.errs[method], errs...)
+}
+
+func (f *fakeAPI) attempt(method string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attempts[method]++
+	if errs := f.errs[method]; len(errs) > 0 {
+		f.errs[method] = errs[1:]
+		return errs[0]
+	}
+	return nil
+}
+
+func (f *fakeAPI) Attempts(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.attempts[method]
+}
+
+func (f *fakeAPI) PostMessageContext(ctx context.Context, channelID string, options ...slack.MsgOption) (string, string, error) {
+	if err := f.attempt("chat.postMessage"); err != nil {
+		return "", "", err
+	}
+	return f.Client.PostMessageContext(ctx, channelID, options...)
+}
+
+func (f *fakeAPI) UpdateMessageContext(ctx context.Context, channelID, timestamp string, options ...slack.MsgOption) (string, string, string, error) {
+	if err := f.attempt("chat.update"); err != nil {
+		return "", "", "", err
+	}
+	return f.Client.UpdateMessageContext(ctx, channelID, timestamp, options...)
+}
+
+func (f *fakeAPI) GetUserInfoContext(ctx context.Context, userID string) (*slack.User, error) {
+	if err := f.attempt("users.info"); err != nil {
+		return nil, err
+	}
+	return f.Client.GetUserInfoContext(ctx, userID)
+}
+
+func TestBucket(t *testing.T) {
+	now := time.Now()
+
+	// chat.update is tier 3, 50 calls per minute in bursts of 5
+	b := newBucket(limits["chat.update"])
+	for i := 0; i < 5; i++ {
+		if wait := b.Reserve(now); wait != 0 {
+			t.Fatalf("call %d waits %s, want 0 within the burst", i+1, wait)
+		}
+	}
+	for i, want := range []time.Duration{1200 * time.Millisecond, 2400 * time.Millisecond} {
+		if wait := b.Reserve(now); wait != want {
+			t.Errorf("call %d waits %s, want %s", 6+i, wait, want)
+		}
+	}
+
+	// Turns not taken are given back over time, up to a burst
+	later := now.Add(time.Hour)
+	for i := 0; i < 5; i++ {
+		if wait := b.Reserve(later); wait != 0 {
+			t.Fatalf("call %d an hour later waits %s, want 0", i+1, wait)
+		}
+	}
+	if wait := b.Reserve(later); wait == 0 {
+		t.Error("call past the burst an hour later doesn't wait")
+	}
+}
+
+func TestBucketPause(t *testing.T) {
+	now := time.Now()
+	b := newBucket(limits["chat.postMessage"])
+	b.Pause(now, 30*time.Second)
+
+	if wait := b.Reserve(now); wait != 30*time.Second {
+		t.Errorf("call during a pause waits %s, want 30s", wait)
+	}
+	if wait := b.Reserve(now.Add(time.Minute)); wait != 0 {
+		t.Errorf("call after the pause waits %s, want 0", wait)
+	}
+
+	// A shorter pause doesn't shorten a longer one
+	b = newBucket(limits["chat.postMessage"])
+	b.Pause(now, time.Minute)
+	b.Pause(now, time.Second)
+	if wait := b.Reserve(now); wait != time.Minute {
+		t.Errorf("call waits %s, want 1m", wait)
+	}
+}
+
+func TestBuckets(t *testing.T) {
+	q := New(newFakeAPI())
+
+	// Messages are limited per channel, other methods per workspace
+	if q.bucket("chat.postMessage", "C1") == q.bucket("chat.postMessage", "C2") {
+		t.Error("chat.postMessage shares its limit between channels")
+	}
+	if q.bucket("chat.postMessage", "C1") != q.bucket("chat.postMessage", "C1") {
+		t.Error("chat.postMessage has several limits in a channel")
+	}
+	if q.bucket("chat.update", "C1") != q.bucket("chat.update", "C2") {
+		t.Error("chat.update has a limit per channel")
+	}
+	if q.bucket("chat.update", "C1") == q.bucket("reactions.add", "C1") {
+		t.Error("chat.update and reactions.add share their limit")
+	}
+	if q.bucket("webhook", "") != nil {
+		t.Error("webhooks are limited")
+	}
+}
+
+func TestRateLimitedCallsWait(t *testing.T) {
+	api := newFakeAPI()
+	q := New(api)
+
+	// Tier 4 lets 10 calls through right away, then one every 600ms
+	start := time.Now()
+	for i := 0; i < 11; i++ {
+		if _, err := q.GetUserInfoContext(context.Background(), "U1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 500*time.Millisecond {
+		t.Errorf("11 calls took %s, want the 11th to wait for its turn", elapsed)
+	}
+}
+
+// fastLimit adds a method limited to 6000 calls per minute for the test.
+func fastLimit(t *testing.T) string {
+	limits["test.fast"] = limit{perMinute: 6000}
+	t.Cleanup(func() { delete(limits, "test.fast") })
+	return "test.fast"
+}
+
+// failing returns a call failing with the errors, one per attempt, and
+// the number of attempts.
+func failing(errs ...error) (func() error, func() int) {
+	var mu sync.Mutex
+	attempts := 0
+	call := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts <= len(errs) {
+			return errs[attempts-1]
+		}
+		return nil
+	}
+	return call, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return attempts
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	for _, method := range []string{"webhook", fastLimit(t)} {
+		t.Run(method, func(t *testing.T) {
+			q := New(newFakeAPI())
+			call, attempts := failing(&slack.RateLimitedError{RetryAfter: 100 * time.Millisecond})
+
+			before := rateLimited.Get(method)
+			start := time.Now()
+			if err := q.do(context.Background(), method, "", call); err != nil {
+				t.Fatalf("do() error = %v", err)
+			}
+			if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+				t.Errorf("retried after %s, want at least the Retry-After of 100ms", elapsed)
+			}
+			if n := attempts(); n != 2 {
+				t.Errorf("attempts = %d, want 2", n)
+			}
+			if rateLimited.Get(method) == before {
+				t.Error("the rate limited call isn't counted")
+			}
+		})
+	}
+}
+
+func TestRetryAfterHoldsBackOtherCalls(t *testing.T) {
+	method := fastLimit(t)
+	q := New(newFakeAPI())
+	limited, _ := failing(&slack.RateLimitedError{RetryAfter: 100 * time.Millisecond})
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := q.do(context.Background(), method, "", limited); err != nil {
+			t.Errorf("do() error = %v", err)
+		}
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// A call queued after the 429 waits for the Retry-After too
+	var done time.Duration
+	if err := q.do(context.Background(), method, "", func() error { done = time.Since(start); return nil }); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	if done < 100*time.Millisecond {
+		t.Errorf("call made after %s, want it to wait for the Retry-After of 100ms", done)
+	}
+}
+
+func TestRetryAfterCancelled(t *testing.T) {
+	q := New(newFakeAPI())
+	call, _ := failing(&slack.RateLimitedError{RetryAfter: time.Minute})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := q.do(ctx, fastLimit(t), "", call); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("do() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestGiveUp(t *testing.T) {
+	limited := &slack.RateLimitedError{RetryAfter: time.Millisecond}
+	q := New(newFakeAPI())
+	call, attempts := failing(limited, limited, limited, limited, limited)
+
+	if err := q.do(context.Background(), fastLimit(t), "", call); !errors.As(err, &limited) {
+		t.Errorf("do() error = %v, want the rate limit error", err)
+	}
+	if n := attempts(); n != maxAttempts {
+		t.Errorf("attempts = %d, want %d", n, maxAttempts)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		err      error
+		attempts int
+	}{
+		{name: "outage", method: "users.info", err: slack.SlackErrorResponse{Err: "service_unavailable"}, attempts: 2},
+		{name: "timeout", method: "chat.update", err: slack.SlackErrorResponse{Err: "request_timeout"}, attempts: 2},
+		{name: "server error", method: "users.info", err: slack.StatusCodeError{Code: http.StatusBadGateway}, attempts: 2},
+		{name: "rate limited", method: "users.info", err: slack.SlackErrorResponse{Err: "ratelimited"}, attempts: 2},
+		{name: "permanent", method: "users.info", err: slack.SlackErrorResponse{Err: "user_not_found"}, attempts: 1},
+		// A post that failed without being rejected may have gone through
+		{name: "post rate limited", method: "chat.postMessage", err: slack.SlackErrorResponse{Err: "ratelimited"}, attempts: 2},
+		{name: "post timeout", method: "chat.postMessage", err: slack.SlackErrorResponse{Err: "request_timeout"}, attempts: 1},
+		{name: "post outage", method: "chat.postMessage", err: slack.SlackErrorResponse{Err: "service_unavailable"}, attempts: 1},
+		{name: "post server error", method: "chat.postEphemeral", err: slack.StatusCodeError{Code: http.StatusBadGateway}, attempts: 1},
+		{name: "post network timeout", method: "webhook", err: &url.Error{Op: "Post", URL: "https://hooks.slack.test", Err: timeoutError{}}, attempts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := New(newFakeAPI())
+			call, attempts := failing(tt.err)
+
+			err := q.do(context.Background(), tt.method, "C1", call)
+			if n := attempts(); n != tt.attempts {
+				t.Errorf("attempts = %d, want %d", n, tt.attempts)
+			}
+			if tt.attempts == 1 && (err == nil || err.Error() != tt.err.Error()) {
+				t.Errorf("do() error = %v, want %v", err, tt.err)
+			}
+			if tt.attempts > 1 && err != nil {
+				t.Errorf("do() error = %v, want the retry to succeed", err)
+			}
+		})
+	}
+}
+
+// timeoutError is a network timeout.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestPermanentError(t *testing.T) {
+	api := newFakeAPI()
+	api.failWith("chat.postMessage", slack.SlackErrorResponse{Err: "channel_not_found"})
+	q := New(api)
+
+	if _, _, err := q.PostMessageContext(context.Background(), "C1"); err == nil {
+		t.Error("PostMessageContext() error = nil, want channel_not_found")
+	}
+	if n := api.Attempts("chat.postMessage"); n != 1 {
+		t.Errorf("attempts = %d, want 1", n)
+	}
+}
+
+func reply(text string) messages.Message {
+	return messages.Message{
+		Text: text,
+		Blocks: slack.Blocks{BlockSet: []slack.Block{
+			slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil),
+		}},
+	}
+}
+
+func TestCoalesceThreadReply(t *testing.T) {
+	ctx := context.Background()
+	api := newFakeAPI()
+	q := New(api)
+
+	var timestamps []string
+	for _, text := range []string{"first", "second", "third"} {
+		ts, err := q.CoalesceThreadReply(ctx, "C1", "1.1", reply(text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		timestamps = append(timestamps, ts)
+	}
+
+	calls := api.Calls()
+	if len(calls) != 3 || calls[0].Method != "chat.postMessage" || calls[1].Method != "chat.update" || calls[2].Method != "chat.update" {
+		t.Fatalf("calls = %+v, want a post and two updates", calls)
+	}
+	if calls[0].Values.Get("thread_ts") != "1.1" {
+		t.Errorf("posted to thread %q, want 1.1", calls[0].Values.Get("thread_ts"))
+	}
+	for i, ts := range timestamps {
+		if ts != timestamps[0] || (i > 0 && calls[i].Timestamp != ts) {
+			t.Errorf("reply %d is %s, want them all in %s", i+1, ts, timestamps[0])
+		}
+	}
+	content := calls[2].Content()
+	if !strings.Contains(content, "first\nsecond\nthird") {
+		t.Errorf("last update = %s, want the three replies", content)
+	}
+	for _, id := range []string{"part0_0", "part1_0", "part2_0"} {
+		if !strings.Contains(content, id) {
+			t.Errorf("last update = %s, want block %s", content, id)
+		}
+	}
+
+	// Other threads get replies of their own
+	if ts, err := q.CoalesceThreadReply(ctx, "C1", "2.2", reply("other")); err != nil || ts == timestamps[0] {
+		t.Errorf("reply in another thread = %s, %v, want a new reply", ts, err)
+	}
+	if ts, err := q.CoalesceThreadReply(ctx, "C2", "1.1", reply("other")); err != nil || ts == timestamps[0] {
+		t.Errorf("reply in another channel = %s, %v, want a new reply", ts, err)
+	}
+}
+
+func TestCoalesceAfterUpdate(t *testing.T) {
+	ctx := context.Background()
+	api := newFakeAPI()
+	q := New(api)
+
+	first, err := q.CoalesceThreadReply(ctx, "C1", "1.1", reply("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// E.g. an undone kudos
+	if _, _, _, err := q.UpdateMessageContext(ctx, "C1", first, reply("undone").Options()...); err != nil {
+		t.Fatal(err)
+	}
+	second, err := q.CoalesceThreadReply(ctx, "C1", "1.1", reply("second"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second == first {
+		t.Error("reply was merged into an updated reply")
+	}
+}
+
+func TestCoalesceDeletedReply(t *testing.T) {
+	ctx := context.Background()
+	api := newFakeAPI()
+	q := New(api)
+
+	first, err := q.CoalesceThreadReply(ctx, "C1", "1.1", reply("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.failWith("chat.update", slack.SlackErrorResponse{Err: "message_not_found"})
+	second, err := q.CoalesceThreadReply(ctx, "C1", "1.1", reply("second"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second == first {
+		t.Error("reply was merged into a deleted reply")
+	}
+	if n := api.Attempts("chat.postMessage"); n != 2 {
+		t.Errorf("posts = %d, want 2", n)
+	}
+}
+
+func TestCoalesceFullReply(t *testing.T) {
+	ctx := context.Background()
+	api := newFakeAPI()
+	q := New(api)
+
+	big := reply("big")
+	for len(big.Blocks.BlockSet) < maxBlocks-1 {
+		big.Blocks.BlockSet = append(big.Blocks.BlockSet, big.Blocks.BlockSet[0])
+	}
+	first, err := q.CoalesceThreadReply(ctx, "C1", "1.1", big)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One more block fits, two don't
+	if ts, err := q.CoalesceThreadReply(ctx, "C1", "1.1", reply("fits")); err != nil || ts != first {
+		t.Errorf("reply = %s, %v, want it merged into %s", ts, err, first)
+	}
+	if ts, err := q.CoalesceThreadReply(ctx, "C1", "1.1", reply("doesn't fit")); err != nil || ts == first {
+		t.Errorf("reply = %s, %v, want a new reply", ts, err)
+	}
+}
+
+func TestCoalesceWindow(t *testing.T) {
+	ctx := context.Background()
+	api := newFakeAPI()
+	q := New(api)
+
+	first, err := q.CoalesceThreadReply(ctx, "C1", "1.1", reply("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The thread went quiet
+	q.threads["C1/1.1"].last = time.Now().Add(-coalesceWindow)
+
+	if ts, err := q.CoalesceThreadReply(ctx, "C1", "1.1", reply("second")); err != nil || ts == first {
+		t.Errorf("reply = %s, %v, want a new reply", ts, err)
+	}
+}
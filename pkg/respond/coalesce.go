@@ -0,0 +1,129 @@
+package respond
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kaplan-michael/slack-kudos/pkg/messages"
+	"github.com/slack-go/slack"
+)
+
+// partPrefix starts the block IDs of a combined message, see Combine.
+const partPrefix = "part"
+
+// Coalescer is a Responder that merges the replies posted to a thread in
+// quick succession into one message, e.g. the confirmations of a burst of
+// kudos, see the outbound package. Send uses it for the thread mode.
+type Coalescer interface {
+	// CoalesceThreadReply posts a reply to a thread, or adds it to the
+	// bot's last reply there. It returns the timestamp of the reply.
+	CoalesceThreadReply(ctx context.Context, channelID, threadTS string, msg messages.Message) (string, error)
+}
+
+// Combine joins messages into one. The blocks of each part get IDs telling
+// the parts apart, so that one of them can be replaced with ReplacePart.
+func Combine(parts []messages.Message) (messages.Message, error) {
+	var texts []string
+	var blocks []map[string]any
+	for p, part := range parts {
+		texts = append(texts, part.Text)
+
+		partBlocks, err := blockMaps(part.Blocks)
+		if err != nil {
+			return messages.Message{}, err
+		}
+		for i, block := range partBlocks {
+			block["block_id"] = fmt.Sprintf("%s%d_%d", partPrefix, p, i)
+		}
+		blocks = append(blocks, partBlocks...)
+	}
+
+	combined, err := toBlocks(blocks)
+	if err != nil {
+		return messages.Message{}, err
+	}
+	return messages.Message{Text: strings.Join(texts, "\n"), Blocks: combined}, nil
+}
+
+// ReplacePart replaces the part of a message made by Combine that holds
+// the block with the given ID, e.g. the block of a clicked button. It
+// reports false when the message wasn't combined.
+func ReplacePart(blocks slack.Blocks, blockID string, msg messages.Message) (slack.Blocks, bool, error) {
+	part, ok := partOf(blockID)
+	if !ok {
+		return blocks, false, nil
+	}
+
+	current, err := blockMaps(blocks)
+	if err != nil {
+		return blocks, false, err
+	}
+	replacement, err := blockMaps(msg.Blocks)
+	if err != nil {
+		return blocks, false, err
+	}
+
+	var replaced []map[string]any
+	for _, block := range current {
+		id, _ := block["block_id"].(string)
+		if p, ok := partOf(id); !ok || p != part {
+			replaced = append(replaced, block)
+			continue
+		}
+		// The replacement takes the place of the part's first block
+		for i, b := range replacement {
+			b["block_id"] = fmt.Sprintf("%s%d_%d", partPrefix, part, i)
+		}
+		replaced = append(replaced, replacement...)
+		replacement = nil
+	}
+
+	result, err := toBlocks(replaced)
+	return result, err == nil, err
+}
+
+// partOf returns the part a block ID set by Combine belongs to.
+func partOf(blockID string) (int, bool) {
+	rest, ok := strings.CutPrefix(blockID, partPrefix)
+	if !ok {
+		return 0, false
+	}
+	part, _, ok := strings.Cut(rest, "_")
+	if !ok {
+		return 0, false
+	}
+	p, err := strconv.Atoi(part)
+	return p, err == nil
+}
+
+// blockMaps converts blocks to JSON objects, to set their IDs whatever
+// their type.
+func blockMaps(blocks slack.Blocks) ([]map[string]any, error) {
+	raw, err := json.Marshal(blocks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode blocks: %w", err)
+	}
+	var maps []map[string]any
+	if err := json.Unmarshal(raw, &maps); err != nil {
+		return nil, fmt.Errorf("failed to decode blocks: %w", err)
+	}
+	return maps, nil
+}
+
+func toBlocks(maps []map[string]any) (slack.Blocks, error) {
+	var blocks slack.Blocks
+	if len(maps) == 0 {
+		return blocks, nil
+	}
+	raw, err := json.Marshal(maps)
+	if err != nil {
+		return blocks, fmt.Errorf("failed to encode blocks: %w", err)
+	}
+	if err := json.Unmarshal(raw, &blocks); err != nil {
+		return blocks, fmt.Errorf("failed to decode blocks: %w", err)
+	}
+	return blocks, nil
+}
@@ -0,0 +1,255 @@
+package respond
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/kaplan-michael/slack-kudos/pkg/messages"
+	"github.com/kaplan-michael/slack-kudos/pkg/settings"
+	"github.com/slack-go/slack"
+)
+
+// Responder is the part of the Slack API the handlers use. It doesn't
+// depend on how a request arrived, so handlers run the same under Socket
+// Mode, the HTTP Events API and in tests, see the handlertest package.
+type Responder interface {
+	PostMessageContext(ctx context.Context, channelID string, options ...slack.MsgOption) (string, string, error)
+	PostEphemeralContext(ctx context.Context, channelID, userID string, options ...slack.MsgOption) (string, error)
+	UpdateMessageContext(ctx context.Context, channelID, timestamp string, options ...slack.MsgOption) (string, string, string, error)
+	AddReactionContext(ctx context.Context, name string, item slack.ItemRef) error
+	OpenConversationContext(ctx context.Context, params *slack.OpenConversationParameters) (*slack.Channel, bool, bool, error)
+	GetPermalinkContext(ctx context.Context, params *slack.PermalinkParameters) (string, error)
+	GetConversationInfoContext(ctx context.Context, input *slack.GetConversationInfoInput) (*slack.Channel, error)
+	GetUserInfoContext(ctx context.Context, userID string) (*slack.User, error)
+	AuthTestContext(ctx context.Context) (*slack.AuthTestResponse, error)
+	// PostWebhookContext posts to the response URL of a slash command or an interaction
+	PostWebhookContext(ctx context.Context, url string, msg *slack.WebhookMessage) error
+}
+
+// Client is the Slack API client of a workspace as a Responder.
+type Client struct {
+	*slack.Client
+}
+
+// PostWebhookContext posts to a response URL, which needs no token.
+func (c Client) PostWebhookContext(ctx context.Context, url string, msg *slack.WebhookMessage) error {
+	return slack.PostWebhookContext(ctx, url, msg)
+}
+
+// ClientLookup returns the Slack API client of a workspace, for work that
+// doesn't start with an event from the workspace.
+type ClientLookup func(teamID string) (Responder, bool)
+
+// Target describes the message a response is about.
+type Target struct {
+	TeamID    string
+	ChannelID string
+	// MessageTS is the timestamp of the message being responded to
+	MessageTS string
+	// ThreadTS is the timestamp of the thread the message was posted in, if any
+	ThreadTS string
+	// UserID is the user who triggered the response, e.g. the giver of a kudos
+	UserID string
+	// RecipientID is the user the response is about, e.g. the recipient of a kudos
+	RecipientID string
+	// Reaction overrides the emoji used in the reaction mode
+	Reaction string
+}
+
+// ModeFor returns the response mode configured for a channel.
+func ModeFor(ctx context.Context, teamID, channelID string) string {
+	mode, err := settings.GetForChannel(ctx, teamID, channelID, settings.ResponseMode)
+	if err != nil {
+		log.FromContext(ctx).Warnf("Failed to get response mode for channel %s: %v", channelID, err)
+		return settings.ModeChannel
+	}
+	return mode
+}
+
+// Interactive reports whether responses in the mode can be interacted with
+// by the user who triggered them, e.g. to click an "Undo" button.
+func Interactive(mode string) bool {
+	return mode == settings.ModeChannel || mode == settings.ModeThread || mode == settings.ModeEphemeral
+}
+
+// Send delivers a response to the target in the given response mode.
+// It returns the channel and timestamp of the posted message, if one was posted.
+func Send(ctx context.Context, api Responder, mode string, t Target, msg messages.Message) (string, string, error) {
+	switch mode {
+	case settings.ModeSilent:
+		return "", "", nil
+	case settings.ModeThread:
+		threadTS := t.ThreadTS
+		if threadTS == "" {
+			threadTS = t.MessageTS
+		}
+		if c, ok := api.(Coalescer); ok {
+			ts, err := c.CoalesceThreadReply(ctx, t.ChannelID, threadTS, msg)
+			return t.ChannelID, ts, err
+		}
+		ts, err := Thread(ctx, api, t.ChannelID, threadTS, msg)
+		return t.ChannelID, ts, err
+	case settings.ModeEphemeral:
+		return "", "", EphemeralInThread(ctx, api, t.ChannelID, t.ThreadTS, t.UserID, msg)
+	case settings.ModeReaction:
+		return "", "", React(ctx, api, t.TeamID, t.ChannelID, t.MessageTS, t.Reaction)
+	case settings.ModeDM:
+		return DM(ctx, api, t.RecipientID, msg)
+	default:
+		ts, err := Channel(ctx, api, t.ChannelID, msg)
+		return t.ChannelID, ts, err
+	}
+}
+
+// Channel posts a message to a channel and returns its timestamp.
+func Channel(ctx context.Context, api Responder, channelID string, msg messages.Message) (string, error) {
+	_, ts, err := api.PostMessageContext(ctx, channelID, msg.Options()...)
+	if err != nil {
+		return "", fmt.Errorf("failed to post message: %w", err)
+	}
+	return ts, nil
+}
+
+// Thread posts a message as a reply in a thread and returns its timestamp.
+func Thread(ctx context.Context, api Responder, channelID, threadTS string, msg messages.Message) (string, error) {
+	options := append(msg.Options(), slack.MsgOptionTS(threadTS))
+	_, ts, err := api.PostMessageContext(ctx, channelID, options...)
+	if err != nil {
+		return "", fmt.Errorf("failed to post thread reply: %w", err)
+	}
+	return ts, nil
+}
+
+// Ephemeral posts a message only the user can see.
+func Ephemeral(ctx context.Context, api Responder, channelID, userID string, msg messages.Message) error {
+	_, err := api.PostEphemeralContext(ctx, channelID, userID, msg.Options()...)
+	if err != nil {
+		return fmt.Errorf("failed to post ephemeral message: %w", err)
+	}
+	return nil
+}
+
+// EphemeralInThread posts a message only the user can see in a thread.
+// Without a thread it behaves like Ephemeral.
+func EphemeralInThread(ctx context.Context, api Responder, channelID, threadTS, userID string, msg messages.Message) error {
+	options := msg.Options()
+	if threadTS != "" {
+		options = append(options, slack.MsgOptionTS(threadTS))
+	}
+	_, err := api.PostEphemeralContext(ctx, channelID, userID, options...)
+	if err != nil {
+		return fmt.Errorf("failed to post ephemeral message: %w", err)
+	}
+	return nil
+}
+
+// DM sends a direct message to the user and returns the channel and timestamp of the message.
+func DM(ctx context.Context, api Responder, userID string, msg messages.Message) (string, string, error) {
+	channelID, err := OpenDM(ctx, api, userID)
+	if err != nil {
+		return "", "", err
+	}
+
+	_, ts, err := api.PostMessageContext(ctx, channelID, msg.Options()...)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to post direct message: %w", err)
+	}
+	return channelID, ts, nil
+}
+
+// OpenDM returns the channel of the bot's direct messages with the user.
+func OpenDM(ctx context.Context, api Responder, userID string) (string, error) {
+	channel, _, _, err := api.OpenConversationContext(ctx, &slack.OpenConversationParameters{Users: []string{userID}})
+	if err != nil {
+		return "", fmt.Errorf("failed to open conversation with user %s: %w", userID, err)
+	}
+	return channel.ID, nil
+}
+
+// Update replaces the content of a message the bot posted earlier.
+func Update(ctx context.Context, api Responder, channelID, ts string, msg messages.Message) error {
+	_, _, _, err := api.UpdateMessageContext(ctx, channelID, ts, msg.Options()...)
+	if err != nil {
+		return fmt.Errorf("failed to update message: %w", err)
+	}
+	return nil
+}
+
+// React adds an emoji reaction to a message. Without an emoji the
+// workspace's configured reaction emoji is used.
+func React(ctx context.Context, api Responder, teamID, channelID, ts, emoji string) error {
+	if emoji == "" {
+		var err error
+		emoji, err = settings.GetForChannel(ctx, teamID, channelID, settings.ReactionEmoji)
+		if err != nil {
+			return fmt.Errorf("failed to get reaction emoji: %w", err)
+		}
+	}
+
+	err := api.AddReactionContext(ctx, strings.Trim(emoji, ":"), slack.NewRefToMessage(channelID, ts))
+	if err != nil && !strings.Contains(err.Error(), "already_reacted") {
+		return fmt.Errorf("failed to add reaction: %w", err)
+	}
+	return nil
+}
+
+// ToResponseURL posts a message only the user can see using the response URL
+// of a slash command. Unlike Ephemeral it works where the bot isn't a member.
+func ToResponseURL(ctx context.Context, api Responder, responseURL string, msg messages.Message) error {
+	blocks := msg.Blocks
+	err := api.PostWebhookContext(ctx, responseURL, &slack.WebhookMessage{
+		Text:         msg.Text,
+		Blocks:       &blocks,
+		ResponseType: slack.ResponseTypeEphemeral,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to post to response URL: %w", err)
+	}
+	return nil
+}
+
+// NotInChannel reports whether a response failed because the bot isn't a
+// member of the channel.
+func NotInChannel(err error) bool {
+	return err != nil && (strings.Contains(err.Error(), "not_in_channel") || strings.Contains(err.Error(), "channel_not_found"))
+}
+
+// IsPrivate reports whether a conversation is a private channel or a DM.
+func IsPrivate(ctx context.Context, api Responder, channelID string) (bool, error) {
+	// DMs don't need a lookup
+	if strings.HasPrefix(channelID, "D") {
+		return true, nil
+	}
+
+	info, err := api.GetConversationInfoContext(ctx, &slack.GetConversationInfoInput{ChannelID: channelID})
+	if err != nil {
+		return false, fmt.Errorf("failed to get info of channel %s: %w", channelID, err)
+	}
+	return info.IsPrivate || info.IsIM || info.IsMpIM, nil
+}
+
+// Permalink returns a link to a message.
+func Permalink(ctx context.Context, api Responder, channelID, ts string) (string, error) {
+	permalink, err := api.GetPermalinkContext(ctx, &slack.PermalinkParameters{Channel: channelID, Ts: ts})
+	if err != nil {
+		return "", fmt.Errorf("failed to get permalink for message %s in channel %s: %w", ts, channelID, err)
+	}
+	return permalink, nil
+}
+
+// Replace replaces the message an interaction came from using its response URL.
+// Unlike Update it also works for ephemeral messages.
+func Replace(ctx context.Context, api Responder, responseURL string, msg messages.Message) error {
+	blocks := msg.Blocks
+	err := api.PostWebhookContext(ctx, responseURL, &slack.WebhookMessage{
+		Text:            msg.Text,
+		Blocks:          &blocks,
+		ReplaceOriginal: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to replace message: %w", err)
+	}
+	return nil
+}
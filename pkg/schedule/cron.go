@@ -0,0 +1,260 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxYears bounds the search for the next or previous run of a schedule.
+// February 29 comes back at least every eight years.
+const maxYears = 8
+
+// Aliases are the schedule shortcuts accepted besides cron expressions.
+var Aliases = map[string]string{
+	"daily":   "0 9 * * *",
+	"weekly":  "0 9 * * 1",
+	"monthly": "0 9 1 * *",
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var dayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// Cron is a parsed five field cron expression: minute, hour, day of month,
+// month and day of week.
+type Cron struct {
+	minutes  [60]bool
+	hours    [24]bool
+	days     [32]bool
+	months   [13]bool
+	weekdays [7]bool
+	// anyDay and anyWeekday are set for "*", cron matches either field
+	// when both are restricted
+	anyDay     bool
+	anyWeekday bool
+}
+
+// Parse parses a cron expression like "0 9 * * MON" or one of the Aliases.
+func Parse(expr string) (*Cron, error) {
+	expr = strings.TrimSpace(strings.ToLower(expr))
+	if alias, ok := Aliases[expr]; ok {
+		expr = alias
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields (minute hour day month weekday), got %d", len(fields))
+	}
+
+	c := &Cron{anyDay: fields[2] == "*", anyWeekday: fields[4] == "*"}
+	if err := parseField(fields[0], 0, 59, nil, c.minutes[:]); err != nil {
+		return nil, fmt.Errorf("minute: %w", err)
+	}
+	if err := parseField(fields[1], 0, 23, nil, c.hours[:]); err != nil {
+		return nil, fmt.Errorf("hour: %w", err)
+	}
+	if err := parseField(fields[2], 1, 31, nil, c.days[:]); err != nil {
+		return nil, fmt.Errorf("day of month: %w", err)
+	}
+	if err := parseField(fields[3], 1, 12, monthNames, c.months[:]); err != nil {
+		return nil, fmt.Errorf("month: %w", err)
+	}
+	// 7 is Sunday too
+	var weekdays [8]bool
+	if err := parseField(fields[4], 0, 7, dayNames, weekdays[:]); err != nil {
+		return nil, fmt.Errorf("weekday: %w", err)
+	}
+	copy(c.weekdays[:], weekdays[:7])
+	c.weekdays[0] = c.weekdays[0] || weekdays[7]
+
+	return c, nil
+}
+
+// Matches reports whether the schedule runs in the minute of t, in t's location.
+func (c *Cron) Matches(t time.Time) bool {
+	return c.minutes[t.Minute()] && c.hours[t.Hour()] && c.months[t.Month()] && c.matchesDay(t.Day(), t.Weekday())
+}
+
+// matchesDay reports whether the schedule runs on a day of the month.
+func (c *Cron) matchesDay(day int, weekday time.Weekday) bool {
+	switch {
+	case c.anyDay && c.anyWeekday:
+		return true
+	case c.anyDay:
+		return c.weekdays[weekday]
+	case c.anyWeekday:
+		return c.days[day]
+	default:
+		return c.days[day] || c.weekdays[weekday]
+	}
+}
+
+// Next returns the first run strictly after t, in t's location.
+// It returns the zero time if the schedule never runs, e.g. on February 30.
+func (c *Cron) Next(t time.Time) time.Time {
+	var next time.Time
+	for day := date(t); day.Year() <= t.Year()+maxYears; {
+		// Skip the months and days the schedule doesn't run in
+		if !c.months[day.Month()] {
+			day = time.Date(day.Year(), day.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if c.matchesDay(day.Day(), day.Weekday()) {
+			c.eachRun(day, t.Location(), func(run time.Time) {
+				if run.After(t) && (next.IsZero() || run.Before(next)) {
+					next = run
+				}
+			})
+			if !next.IsZero() {
+				return next
+			}
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return time.Time{}
+}
+
+// Prev returns the last run strictly before t, in t's location.
+// It returns the zero time if the schedule never runs.
+func (c *Cron) Prev(t time.Time) time.Time {
+	var prev time.Time
+	for day := date(t); day.Year() >= t.Year()-maxYears; {
+		// Skip the months and days the schedule doesn't run in
+		if !c.months[day.Month()] {
+			day = time.Date(day.Year(), day.Month(), 0, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if c.matchesDay(day.Day(), day.Weekday()) {
+			c.eachRun(day, t.Location(), func(run time.Time) {
+				if run.Before(t) && run.After(prev) {
+					prev = run
+				}
+			})
+			if !prev.IsZero() {
+				return prev
+			}
+		}
+		day = day.AddDate(0, 0, -1)
+	}
+	return time.Time{}
+}
+
+// eachRun calls fn with the runs of the schedule on a day, in loc. A run
+// in the hour skipped when the clocks go forward happens an hour later. A
+// run in the hour repeated when the clocks go back happens once, unless
+// the schedule runs every hour.
+func (c *Cron) eachRun(day time.Time, loc *time.Location, fn func(run time.Time)) {
+	for hour, ok := range c.hours {
+		if !ok {
+			continue
+		}
+		for minute, ok := range c.minutes {
+			if !ok {
+				continue
+			}
+			run := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, loc)
+			if run.Hour() != hour || run.Minute() != minute {
+				// The clock skipped the time, move the run past the gap
+				_, before := run.Zone()
+				_, after := run.Add(2 * time.Hour).Zone()
+				run = run.Add(time.Duration(after-before) * time.Second)
+			}
+			fn(run)
+			if repeated, ok := repeatedRun(run); ok && c.everyHour() {
+				fn(repeated)
+			}
+		}
+	}
+}
+
+// everyHour reports whether the schedule runs in every hour of its days.
+func (c *Cron) everyHour() bool {
+	for _, ok := range c.hours {
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// repeatedRun returns the second time the clock shows the time of run,
+// when the clocks go back after it.
+func repeatedRun(run time.Time) (time.Time, bool) {
+	_, before := run.Zone()
+	_, after := run.Add(2 * time.Hour).Zone()
+	if after >= before {
+		return time.Time{}, false
+	}
+	repeated := run.Add(time.Duration(before-after) * time.Second)
+	if repeated.Hour() != run.Hour() || repeated.Minute() != run.Minute() {
+		return time.Time{}, false
+	}
+	return repeated, true
+}
+
+// date returns the day of t in t's location, as midnight UTC to count days
+// without daylight saving time.
+func date(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// parseField parses a comma separated list of values, ranges and steps
+// like "1,15", "1-5", "*/15" or "mon-fri" into set.
+func parseField(field string, min, max int, names map[string]int, set []bool) error {
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid step in %q", part)
+			}
+			step = n
+			part = part[:i]
+		}
+
+		lo, hi := min, max
+		if part != "*" {
+			var err error
+			bounds := strings.SplitN(part, "-", 2)
+			if lo, err = parseValue(bounds[0], names); err != nil {
+				return err
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = parseValue(bounds[1], names); err != nil {
+					return err
+				}
+			} else if step > 1 {
+				// "5/15" means from 5 to the end every 15
+				hi = max
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+	return nil
+}
+
+func parseValue(value string, names map[string]int) (int, error) {
+	if n, ok := names[value]; ok {
+		return n, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", value)
+	}
+	return n, nil
+}
@@ -0,0 +1,251 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	// The DST tests need the time zone database, also where it's not installed
+	_ "time/tzdata"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expr    string
+		matches []string
+		misses  []string
+	}{
+		{
+			expr:    "* * * * *",
+			matches: []string{"2024-03-04 00:00", "2024-12-31 23:59"},
+		},
+		{
+			expr:    "0 9 * * *",
+			matches: []string{"2024-03-04 09:00"},
+			misses:  []string{"2024-03-04 09:01", "2024-03-04 10:00"},
+		},
+		{
+			expr:    "daily",
+			matches: []string{"2024-03-04 09:00"},
+			misses:  []string{"2024-03-04 08:00"},
+		},
+		{
+			// 2024-03-04 is a Monday
+			expr:    "weekly",
+			matches: []string{"2024-03-04 09:00"},
+			misses:  []string{"2024-03-05 09:00"},
+		},
+		{
+			expr:    "monthly",
+			matches: []string{"2024-04-01 09:00"},
+			misses:  []string{"2024-04-02 09:00"},
+		},
+		{
+			expr:    "*/15 * * * *",
+			matches: []string{"2024-03-04 10:00", "2024-03-04 10:15", "2024-03-04 10:45"},
+			misses:  []string{"2024-03-04 10:05"},
+		},
+		{
+			expr:    "5/20 * * * *",
+			matches: []string{"2024-03-04 10:05", "2024-03-04 10:25", "2024-03-04 10:45"},
+			misses:  []string{"2024-03-04 10:00"},
+		},
+		{
+			expr:    "0 9-17/4 * * *",
+			matches: []string{"2024-03-04 09:00", "2024-03-04 13:00", "2024-03-04 17:00"},
+			misses:  []string{"2024-03-04 11:00"},
+		},
+		{
+			expr:    "30 8 1,15 * *",
+			matches: []string{"2024-03-01 08:30", "2024-03-15 08:30"},
+			misses:  []string{"2024-03-02 08:30"},
+		},
+		{
+			expr:    "0 9 * * MON-FRI",
+			matches: []string{"2024-03-04 09:00", "2024-03-08 09:00"},
+			misses:  []string{"2024-03-09 09:00", "2024-03-10 09:00"},
+		},
+		{
+			// 7 is Sunday too
+			expr:    "0 9 * * 7",
+			matches: []string{"2024-03-10 09:00"},
+			misses:  []string{"2024-03-09 09:00"},
+		},
+		{
+			expr:    "0 0 1 jan,jul *",
+			matches: []string{"2024-01-01 00:00", "2024-07-01 00:00"},
+			misses:  []string{"2024-02-01 00:00"},
+		},
+		{
+			// Day of month and weekday both restricted: either matches
+			expr:    "0 9 13 * fri",
+			matches: []string{"2024-03-13 09:00", "2024-03-08 09:00"},
+			misses:  []string{"2024-03-12 09:00"},
+		},
+	}
+
+	for _, tt := range tests {
+		c, err := Parse(tt.expr)
+		if err != nil {
+			t.Errorf("Parse(%q) error = %v", tt.expr, err)
+			continue
+		}
+		for _, s := range tt.matches {
+			if !c.Matches(mustTime(t, s, time.UTC)) {
+				t.Errorf("Parse(%q).Matches(%s) = false, want true", tt.expr, s)
+			}
+		}
+		for _, s := range tt.misses {
+			if c.Matches(mustTime(t, s, time.UTC)) {
+				t.Errorf("Parse(%q).Matches(%s) = true, want false", tt.expr, s)
+			}
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"a * * * *",
+		"* * * foo *",
+		"hourly",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) error = nil, want an error", expr)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		expr string
+		from string
+		want string
+	}{
+		{expr: "* * * * *", from: "2024-03-04 10:00", want: "2024-03-04 10:01"},
+		{expr: "0 9 * * *", from: "2024-03-04 08:59", want: "2024-03-04 09:00"},
+		{expr: "0 9 * * *", from: "2024-03-04 09:00", want: "2024-03-05 09:00"},
+		{expr: "0 9 * * *", from: "2024-12-31 10:00", want: "2025-01-01 09:00"},
+		{expr: "weekly", from: "2024-03-04 09:00", want: "2024-03-11 09:00"},
+		{expr: "monthly", from: "2024-01-31 12:00", want: "2024-02-01 09:00"},
+		{expr: "0 0 31 * *", from: "2024-04-01 00:00", want: "2024-05-31 00:00"},
+		{expr: "0 0 29 2 *", from: "2024-01-01 00:00", want: "2024-02-29 00:00"},
+		{expr: "0 0 29 2 *", from: "2024-03-01 00:00", want: "2028-02-29 00:00"},
+		// 2100 isn't a leap year
+		{expr: "0 0 29 2 *", from: "2097-03-01 00:00", want: "2104-02-29 00:00"},
+		{expr: "0 0 30 2 *", from: "2024-01-01 00:00", want: ""},
+		{expr: "0 0 13 * fri", from: "2024-03-09 00:00", want: "2024-03-13 00:00"},
+	}
+
+	for _, tt := range tests {
+		c, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", tt.expr, err)
+		}
+		got := c.Next(mustTime(t, tt.from, time.UTC))
+		if format(got) != tt.want {
+			t.Errorf("Parse(%q).Next(%s) = %s, want %s", tt.expr, tt.from, format(got), tt.want)
+		}
+	}
+}
+
+func TestPrev(t *testing.T) {
+	tests := []struct {
+		expr string
+		from string
+		want string
+	}{
+		{expr: "* * * * *", from: "2024-03-04 10:00", want: "2024-03-04 09:59"},
+		{expr: "0 9 * * *", from: "2024-03-04 09:00", want: "2024-03-03 09:00"},
+		{expr: "0 9 * * *", from: "2024-03-04 09:01", want: "2024-03-04 09:00"},
+		{expr: "weekly", from: "2024-03-04 09:00", want: "2024-02-26 09:00"},
+		{expr: "monthly", from: "2024-03-01 09:00", want: "2024-02-01 09:00"},
+		{expr: "0 0 29 2 *", from: "2104-01-01 00:00", want: "2096-02-29 00:00"},
+		{expr: "0 0 30 2 *", from: "2024-01-01 00:00", want: ""},
+	}
+
+	for _, tt := range tests {
+		c, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", tt.expr, err)
+		}
+		got := c.Prev(mustTime(t, tt.from, time.UTC))
+		if format(got) != tt.want {
+			t.Errorf("Parse(%q).Prev(%s) = %s, want %s", tt.expr, tt.from, format(got), tt.want)
+		}
+	}
+}
+
+func TestNextDST(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// In 2024 the clocks went forward from 2:00 EST to 3:00 EDT on March 10
+	// and back from 2:00 EDT to 1:00 EST on November 3
+	tests := []struct {
+		name string
+		expr string
+		from string
+		want string
+	}{
+		{name: "daily in the repeated hour", expr: "30 1 * * *", from: "2024-11-03T01:30:00-04:00", want: "2024-11-04T01:30:00-05:00"},
+		{name: "daily after the repeated hour", expr: "30 1 * * *", from: "2024-11-03T01:10:00-05:00", want: "2024-11-04T01:30:00-05:00"},
+		{name: "hourly through the repeated hour", expr: "30 * * * *", from: "2024-11-03T01:30:00-04:00", want: "2024-11-03T01:30:00-05:00"},
+		{name: "every minute into the repeated hour", expr: "* * * * *", from: "2024-11-03T01:59:00-04:00", want: "2024-11-03T01:00:00-05:00"},
+		{name: "every minute out of the repeated hour", expr: "* * * * *", from: "2024-11-03T01:59:00-05:00", want: "2024-11-03T02:00:00-05:00"},
+		{name: "daily in the skipped hour", expr: "30 2 * * *", from: "2024-03-10T00:00:00-05:00", want: "2024-03-10T03:30:00-04:00"},
+		{name: "daily after the skipped hour", expr: "30 2 * * *", from: "2024-03-10T03:30:00-04:00", want: "2024-03-11T02:30:00-04:00"},
+		{name: "every minute over the skipped hour", expr: "* * * * *", from: "2024-03-10T01:59:00-05:00", want: "2024-03-10T03:00:00-04:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			from, err := time.Parse(time.RFC3339, tt.from)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := time.Parse(time.RFC3339, tt.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := c.Next(from.In(newYork))
+			if !got.Equal(want) {
+				t.Errorf("Next(%s) = %s, want %s", tt.from, got.Format(time.RFC3339), tt.want)
+			}
+		})
+	}
+}
+
+func mustTime(t *testing.T, s string, loc *time.Location) time.Time {
+	t.Helper()
+	parsed, err := time.ParseInLocation("2006-01-02 15:04", s, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+// format formats a time like mustTime parses it, the zero time as "".
+func format(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02 15:04")
+}
@@ -0,0 +1,283 @@
+package schedule
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/kaplan-michael/slack-kudos/pkg/database"
+)
+
+// Catch-up policies for runs missed while the bot wasn't running.
+const (
+	// CatchUpSkip drops missed runs and waits for the next scheduled one
+	CatchUpSkip = "skip"
+	// CatchUpOnce runs once for all missed runs, then continues on schedule
+	CatchUpOnce = "once"
+)
+
+// pollInterval is how often the scheduler looks for due jobs.
+const pollInterval = 30 * time.Second
+
+// missedAfter is how late a run can start before it counts as missed.
+const missedAfter = 2 * time.Minute
+
+// Job is a scheduled job, stored in the jobs table.
+type Job struct {
+	ID int64
+	// TeamID is the workspace the job belongs to, empty for global jobs
+	TeamID   string
+	Name     string
+	Schedule string
+	Timezone string
+	CatchUp  string
+	// ScheduledAt is the time the current run was scheduled for
+	ScheduledAt time.Time
+	// LastRun is the time the previous run was scheduled for, if there was one
+	LastRun *time.Time
+}
+
+// Func runs a job.
+type Func func(ctx context.Context, job Job) error
+
+var (
+	funcs   = map[string]Func{}
+	funcsMu sync.RWMutex
+)
+
+// Register sets the function that runs the jobs with the given name.
+func Register(name string, fn Func) {
+	funcsMu.Lock()
+	defer funcsMu.Unlock()
+	funcs[name] = fn
+}
+
+func lookup(name string) (Func, bool) {
+	funcsMu.RLock()
+	defer funcsMu.RUnlock()
+	fn, ok := funcs[name]
+	return fn, ok
+}
+
+// Ensure creates or updates a job. Its next run is only recalculated when
+// the schedule, timezone or catch-up policy changed, so that runs missed
+// during a restart can still be caught up.
+func Ensure(ctx context.Context, teamID, name, expr, timezone, catchUp string) error {
+	next, err := nextRun(expr, timezone, time.Now())
+	if err != nil {
+		return fmt.Errorf("invalid schedule for job %s: %w", name, err)
+	}
+	if catchUp != CatchUpSkip && catchUp != CatchUpOnce {
+		return fmt.Errorf("invalid catch-up policy %q for job %s", catchUp, name)
+	}
+
+	_, err = database.DB.ExecContext(ctx, `
+		INSERT INTO jobs (team_id, name, schedule, timezone, catch_up, next_run, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(team_id, name)
+		DO UPDATE SET
+			schedule = excluded.schedule,
+			timezone = excluded.timezone,
+			catch_up = excluded.catch_up,
+			next_run = excluded.next_run
+		WHERE jobs.schedule != excluded.schedule
+		   OR jobs.timezone != excluded.timezone
+		   OR jobs.catch_up != excluded.catch_up`,
+		teamID, name, expr, timezone, catchUp, unix(next), time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save job %s: %w", name, err)
+	}
+	return nil
+}
+
+// Remove deletes a job.
+func Remove(ctx context.Context, teamID, name string) error {
+	_, err := database.DB.ExecContext(ctx, `DELETE FROM jobs WHERE team_id = ? AND name = ?`, teamID, name)
+	if err != nil {
+		return fmt.Errorf("failed to remove job %s: %w", name, err)
+	}
+	return nil
+}
+
+// Teams returns the workspaces that have a job with the given name.
+func Teams(ctx context.Context, name string) ([]string, error) {
+	rows, err := database.DB.QueryContext(ctx, `SELECT team_id FROM jobs WHERE name = ?`, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var teams []string
+	for rows.Next() {
+		var teamID string
+		if err := rows.Scan(&teamID); err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		teams = append(teams, teamID)
+	}
+	return teams, rows.Err()
+}
+
+// Run runs due jobs until the context is cancelled, then waits for the
+// running jobs to finish. Jobs get the context, so they can stop early.
+func Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	var running sync.WaitGroup
+	defer running.Wait()
+
+	runDue(ctx, time.Now(), &running)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			runDue(ctx, now, &running)
+		}
+	}
+}
+
+// runDue claims and starts every job whose next run is due.
+func runDue(ctx context.Context, now time.Time, running *sync.WaitGroup) {
+	jobs, err := dueJobs(ctx, now)
+	if err != nil {
+		log.Warnf("Failed to get due jobs: %v", err)
+		return
+	}
+
+	for _, job := range jobs {
+		claimed, err := claim(ctx, job, now)
+		if err != nil {
+			log.Warnf("Failed to claim job %s of workspace %q: %v", job.Name, job.TeamID, err)
+			continue
+		}
+		// Another run of the job already claimed it
+		if !claimed {
+			continue
+		}
+
+		if now.Sub(job.ScheduledAt) > missedAfter && job.CatchUp == CatchUpSkip {
+			log.Infof("Skipping missed run of job %s of workspace %q scheduled at %s", job.Name, job.TeamID, job.ScheduledAt)
+			continue
+		}
+
+		fn, ok := lookup(job.Name)
+		if !ok {
+			recordError(job, fmt.Errorf("no function registered for job %s", job.Name))
+			continue
+		}
+
+		running.Add(1)
+		go func(job Job) {
+			defer running.Done()
+			log.Debugf("Running job %s of workspace %q scheduled at %s", job.Name, job.TeamID, job.ScheduledAt)
+			recordError(job, fn(ctx, job))
+		}(job)
+	}
+}
+
+// dueJobs returns the jobs whose next run is at or before now.
+func dueJobs(ctx context.Context, now time.Time) ([]Job, error) {
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT id, team_id, name, schedule, timezone, catch_up, next_run, last_run
+		FROM jobs
+		WHERE next_run > 0 AND next_run <= ?
+		ORDER BY next_run`, unix(now))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		var job Job
+		var nextRun int64
+		var lastRun sql.NullInt64
+		if err := rows.Scan(&job.ID, &job.TeamID, &job.Name, &job.Schedule, &job.Timezone, &job.CatchUp, &nextRun, &lastRun); err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		job.ScheduledAt = time.Unix(nextRun, 0)
+		if lastRun.Valid {
+			t := time.Unix(lastRun.Int64, 0)
+			job.LastRun = &t
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// claim moves the job's next run forward, only if nobody else did since it
+// was loaded. Claiming before running makes every run happen at most once,
+// also when several processes share the database.
+//
+// The next run follows the claimed one rather than the time of the claim,
+// so that a late claim can't pick the claimed run again, e.g. in the hour
+// repeated when the clocks go back. Runs missed in between are skipped,
+// the catch-up policy decides whether the claimed one still runs.
+func claim(ctx context.Context, job Job, now time.Time) (bool, error) {
+	next, err := nextRun(job.Schedule, job.Timezone, job.ScheduledAt)
+	if err == nil && !next.IsZero() && !next.After(now) {
+		next, err = nextRun(job.Schedule, job.Timezone, now)
+	}
+	if err != nil {
+		// A schedule that can't be parsed never runs again
+		log.Warnf("Disabling job %s of workspace %q: %v", job.Name, job.TeamID, err)
+		next = time.Time{}
+	}
+
+	result, err := database.DB.ExecContext(ctx, `
+		UPDATE jobs SET next_run = ?, last_run = ?
+		WHERE id = ? AND next_run = ?`,
+		unix(next), unix(job.ScheduledAt), job.ID, unix(job.ScheduledAt),
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// recordError stores the outcome of the job's last run. It's stored also
+// when the run was cancelled by a shutdown.
+func recordError(job Job, runErr error) {
+	message := ""
+	if runErr != nil {
+		log.Warnf("Job %s of workspace %q failed: %v", job.Name, job.TeamID, runErr)
+		message = runErr.Error()
+	}
+
+	_, err := database.DB.ExecContext(context.Background(), `UPDATE jobs SET last_error = ? WHERE id = ?`, message, job.ID)
+	if err != nil {
+		log.Warnf("Failed to record the result of job %s: %v", job.Name, err)
+	}
+}
+
+// nextRun returns the first run of a schedule after t in the timezone.
+func nextRun(expr, timezone string, t time.Time) (time.Time, error) {
+	cron, err := Parse(expr)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cron.Next(t.In(loc)), nil
+}
+
+// unix converts a time to the Unix seconds stored in the jobs table,
+// the zero time meaning never.
+func unix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
@@ -0,0 +1,236 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kaplan-michael/slack-kudos/pkg/config"
+	"github.com/kaplan-michael/slack-kudos/pkg/database"
+
+	_ "time/tzdata"
+)
+
+// setupDB gives the test a database of its own.
+func setupDB(t *testing.T) {
+	t.Helper()
+	previous := config.AppConfig.SQLiteFilename
+	config.AppConfig.SQLiteFilename = filepath.Join(t.TempDir(), "kudos.db")
+	if err := database.InitDB(); err != nil {
+		t.Fatalf("failed to initialize database: %v", err)
+	}
+	t.Cleanup(func() {
+		database.DB.Close()
+		config.AppConfig.SQLiteFilename = previous
+	})
+}
+
+// scheduleAt sets the next run of a job.
+func scheduleAt(t *testing.T, name string, next time.Time) {
+	t.Helper()
+	if _, err := database.DB.Exec(`UPDATE jobs SET next_run = ? WHERE name = ?`, unix(next), name); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// jobRuns returns the next and the last run of a job.
+func jobRuns(t *testing.T, name string) (next, last time.Time) {
+	t.Helper()
+	var nextRun, lastRun int64
+	err := database.DB.QueryRow(`SELECT next_run, COALESCE(last_run, 0) FROM jobs WHERE name = ?`, name).Scan(&nextRun, &lastRun)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nextRun > 0 {
+		next = time.Unix(nextRun, 0).UTC()
+	}
+	if lastRun > 0 {
+		last = time.Unix(lastRun, 0).UTC()
+	}
+	return next, last
+}
+
+func TestClaim(t *testing.T) {
+	setupDB(t)
+	ctx := context.Background()
+	if err := Ensure(ctx, "", "test_claim", "0 9 * * *", "UTC", CatchUpSkip); err != nil {
+		t.Fatal(err)
+	}
+	scheduled := time.Date(2024, time.March, 4, 9, 0, 0, 0, time.UTC)
+	scheduleAt(t, "test_claim", scheduled)
+
+	jobs, err := dueJobs(ctx, scheduled)
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("dueJobs() = %+v, %v, want the job", jobs, err)
+	}
+
+	// Two processes loaded the job, only one of them gets to run it
+	for i, want := range []bool{true, false} {
+		claimed, err := claim(ctx, jobs[0], scheduled.Add(time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claimed != want {
+			t.Errorf("claim #%d = %v, want %v", i+1, claimed, want)
+		}
+	}
+
+	next, last := jobRuns(t, "test_claim")
+	if want := scheduled.AddDate(0, 0, 1); !next.Equal(want) {
+		t.Errorf("next run = %s, want %s", next, want)
+	}
+	if !last.Equal(scheduled) {
+		t.Errorf("last run = %s, want %s", last, scheduled)
+	}
+
+	if jobs, err := dueJobs(ctx, scheduled.Add(time.Minute)); err != nil || len(jobs) != 0 {
+		t.Errorf("dueJobs() after claim = %+v, %v, want none", jobs, err)
+	}
+}
+
+func TestClaimInRepeatedHour(t *testing.T) {
+	setupDB(t)
+	ctx := context.Background()
+	if err := Ensure(ctx, "", "test_claim_dst", "30 1 * * *", "America/New_York", CatchUpOnce); err != nil {
+		t.Fatal(err)
+	}
+	// 1:30 EDT, the clocks go back to 1:00 EST half an hour later
+	scheduled := time.Date(2024, time.November, 3, 5, 30, 0, 0, time.UTC)
+	scheduleAt(t, "test_claim_dst", scheduled)
+
+	jobs, err := dueJobs(ctx, scheduled)
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("dueJobs() = %+v, %v, want the job", jobs, err)
+	}
+	if _, err := claim(ctx, jobs[0], scheduled.Add(10*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Not 1:30 EST the same night
+	next, _ := jobRuns(t, "test_claim_dst")
+	if want := time.Date(2024, time.November, 4, 6, 30, 0, 0, time.UTC); !next.Equal(want) {
+		t.Errorf("next run = %s, want %s", next, want)
+	}
+}
+
+func TestRunDue(t *testing.T) {
+	scheduled := time.Date(2024, time.March, 4, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		catchUp string
+		now     time.Time
+		ran     bool
+		next    time.Time
+	}{
+		{name: "on time", catchUp: CatchUpSkip, now: scheduled.Add(30 * time.Second), ran: true, next: scheduled.AddDate(0, 0, 1)},
+		{name: "a bit late", catchUp: CatchUpSkip, now: scheduled.Add(time.Minute), ran: true, next: scheduled.AddDate(0, 0, 1)},
+		{name: "missed skip", catchUp: CatchUpSkip, now: scheduled.AddDate(0, 0, 3), ran: false, next: scheduled.AddDate(0, 0, 4)},
+		{name: "missed once", catchUp: CatchUpOnce, now: scheduled.AddDate(0, 0, 3), ran: true, next: scheduled.AddDate(0, 0, 4)},
+		{name: "not due", catchUp: CatchUpOnce, now: scheduled.Add(-time.Minute), ran: false, next: scheduled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupDB(t)
+			ctx := context.Background()
+
+			name := "test_run_due"
+			var runs []Job
+			var mu sync.Mutex
+			Register(name, func(ctx context.Context, job Job) error {
+				mu.Lock()
+				defer mu.Unlock()
+				runs = append(runs, job)
+				return nil
+			})
+			if err := Ensure(ctx, "", name, "0 9 * * *", "UTC", tt.catchUp); err != nil {
+				t.Fatal(err)
+			}
+			scheduleAt(t, name, scheduled)
+
+			var running sync.WaitGroup
+			runDue(ctx, tt.now, &running)
+			// Runs are claimed, running them again does nothing
+			runDue(ctx, tt.now, &running)
+			running.Wait()
+
+			if tt.ran && (len(runs) != 1 || !runs[0].ScheduledAt.Equal(scheduled)) {
+				t.Errorf("runs = %+v, want one run scheduled at %s", runs, scheduled)
+			}
+			if !tt.ran && len(runs) != 0 {
+				t.Errorf("runs = %+v, want none", runs)
+			}
+			if next, _ := jobRuns(t, name); !next.Equal(tt.next) {
+				t.Errorf("next run = %s, want %s", next, tt.next)
+			}
+		})
+	}
+}
+
+func TestRunDueRecordsError(t *testing.T) {
+	setupDB(t)
+	ctx := context.Background()
+
+	Register("test_failing", func(ctx context.Context, job Job) error {
+		return errors.New("boom")
+	})
+	if err := Ensure(ctx, "", "test_failing", "* * * * *", "UTC", CatchUpSkip); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	scheduleAt(t, "test_failing", now.Truncate(time.Minute))
+
+	var running sync.WaitGroup
+	runDue(ctx, now, &running)
+	running.Wait()
+
+	var lastError string
+	if err := database.DB.QueryRow(`SELECT last_error FROM jobs WHERE name = 'test_failing'`).Scan(&lastError); err != nil {
+		t.Fatal(err)
+	}
+	if lastError != "boom" {
+		t.Errorf("last error = %q, want %q", lastError, "boom")
+	}
+}
+
+func TestEnsure(t *testing.T) {
+	setupDB(t)
+	ctx := context.Background()
+
+	if err := Ensure(ctx, "", "test_ensure", "0 9 * * *", "UTC", CatchUpOnce); err != nil {
+		t.Fatal(err)
+	}
+	missed := time.Date(2024, time.March, 4, 9, 0, 0, 0, time.UTC)
+	scheduleAt(t, "test_ensure", missed)
+
+	// A restart keeps the missed run, so that it's caught up
+	if err := Ensure(ctx, "", "test_ensure", "0 9 * * *", "UTC", CatchUpOnce); err != nil {
+		t.Fatal(err)
+	}
+	if next, _ := jobRuns(t, "test_ensure"); !next.Equal(missed) {
+		t.Errorf("next run after restart = %s, want %s", next, missed)
+	}
+
+	// A new schedule starts over
+	if err := Ensure(ctx, "", "test_ensure", "0 10 * * *", "UTC", CatchUpOnce); err != nil {
+		t.Fatal(err)
+	}
+	next, _ := jobRuns(t, "test_ensure")
+	if next.Hour() != 10 || !next.After(time.Now()) {
+		t.Errorf("next run after schedule change = %s, want the next 10:00", next)
+	}
+
+	for _, tt := range []struct{ expr, timezone, catchUp string }{
+		{expr: "0 25 * * *", timezone: "UTC", catchUp: CatchUpOnce},
+		{expr: "0 9 * * *", timezone: "Nowhere/Nothing", catchUp: CatchUpOnce},
+		{expr: "0 9 * * *", timezone: "UTC", catchUp: "always"},
+	} {
+		if err := Ensure(ctx, "", "test_ensure_invalid", tt.expr, tt.timezone, tt.catchUp); err == nil {
+			t.Errorf("Ensure(%q, %q, %q) error = nil, want an error", tt.expr, tt.timezone, tt.catchUp)
+		}
+	}
+}
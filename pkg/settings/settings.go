@@ -0,0 +1,560 @@
+package settings
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	// Timezones have to work without the system's timezone database
+	_ "time/tzdata"
+
+	"github.com/kaplan-michael/slack-kudos/pkg/database"
+	"github.com/kaplan-michael/slack-kudos/pkg/schedule"
+)
+
+// Keys of the per-workspace settings.
+const (
+	AllowMinusMinus   = "allow_minus_minus"
+	UndoWindowMinutes = "undo_window_minutes"
+	AnonChannel       = "anon_channel"
+	Milestones        = "milestones"
+	MilestoneChannel  = "milestone_channel"
+	Locale            = "locale"
+	ResponseMode      = "response_mode"
+	ReactionEmoji     = "reaction_emoji"
+	Notifications     = "notifications"
+	WallChannel       = "wall_channel"
+	WallPrivate       = "wall_private"
+	DigestChannel     = "digest_channel"
+	DigestSchedule    = "digest_schedule"
+	DigestPrivate     = "digest_private"
+	Timezone          = "timezone"
+	Listen            = "listen"
+)
+
+// Response modes for kudos confirmations.
+const (
+	ModeChannel   = "channel"
+	ModeThread    = "thread"
+	ModeEphemeral = "ephemeral"
+	ModeReaction  = "reaction"
+	ModeDM        = "dm"
+	ModeSilent    = "silent"
+)
+
+// Notification preferences of kudos recipients.
+const (
+	NotifyInstant = "instant"
+	NotifyDaily   = "daily"
+	NotifyOff     = "off"
+)
+
+// Scopes a setting value can be stored in.
+const (
+	scopeWorkspace = "workspace"
+	scopeChannel   = "channel"
+	scopeUser      = "user"
+)
+
+// Definition describes a per-workspace setting.
+type Definition struct {
+	Key         string
+	Description string
+	Default     string
+	Validate    func(value string) error
+	// Normalize converts user input into the stored value, e.g. a channel mention into its ID
+	Normalize func(value string) (string, error)
+	// ChannelScoped settings can be overridden for a single channel
+	ChannelScoped bool
+	// UserScoped settings can be overridden by each user for themselves
+	UserScoped bool
+}
+
+// Definitions is the list of all settings a workspace can configure.
+var Definitions = []Definition{
+	{
+		Key:         AllowMinusMinus,
+		Description: "Allow taking kudos away with `@user --`",
+		Default:     "false",
+		Validate:    validateBool,
+	},
+	{
+		Key:         UndoWindowMinutes,
+		Description: "Minutes during which a giver can undo their kudos (0 disables undo)",
+		Default:     "5",
+		Validate:    validateNonNegativeInt,
+	},
+	{
+		Key:         AnonChannel,
+		Description: "Channel where anonymous kudos are announced (`none` to DM the recipient instead)",
+		Default:     "",
+		Normalize:   normalizeChannel,
+	},
+	{
+		Key:         Milestones,
+		Description: "Comma-separated kudos counts that award a badge",
+		Default:     "10,50,100,500",
+		Validate:    validateIntList,
+	},
+	{
+		Key:         MilestoneChannel,
+		Description: "Channel where milestones are announced (`none` to only celebrate in place)",
+		Default:     "",
+		Normalize:   normalizeChannel,
+	},
+	{
+		Key:         Locale,
+		Description: "Language of the bot's messages, e.g. `en` or `cs` (`auto` to use each user's Slack language)",
+		Default:     "",
+		Normalize:   normalizeLocale,
+	},
+	{
+		Key:           ResponseMode,
+		Description:   "How kudos are confirmed: `channel`, `thread`, `ephemeral`, `reaction`, `dm` or `silent`",
+		Default:       ModeChannel,
+		Validate:      validateOneOf(ModeChannel, ModeThread, ModeEphemeral, ModeReaction, ModeDM, ModeSilent),
+		ChannelScoped: true,
+	},
+	{
+		Key:           ReactionEmoji,
+		Description:   "Emoji added to kudos messages in the `reaction` response mode",
+		Default:       "tada",
+		Normalize:     normalizeEmoji,
+		ChannelScoped: true,
+	},
+	{
+		Key:         Notifications,
+		Description: "Default for DMs to kudos recipients: `instant`, `daily` or `off` (users choose their own with `/kudos notifications`)",
+		Default:     NotifyOff,
+		Validate:    validateOneOf(NotifyInstant, NotifyDaily, NotifyOff),
+		UserScoped:  true,
+	},
+	{
+		Key:         WallChannel,
+		Description: "Kudos wall channel where every kudos is cross-posted (`none` to disable)",
+		Default:     "",
+		Normalize:   normalizeChannel,
+	},
+	{
+		Key:         WallPrivate,
+		Description: "Also cross-post kudos given in private channels and DMs to the kudos wall",
+		Default:     "false",
+		Validate:    validateBool,
+	},
+	{
+		Key:         DigestChannel,
+		Description: "Channel where the kudos digest is posted (`none` to disable)",
+		Default:     "",
+		Normalize:   normalizeChannel,
+	},
+	{
+		Key:         DigestSchedule,
+		Description: "When the kudos digest is posted: `weekly`, `monthly` or a cron expression like `0 9 * * MON`",
+		Default:     "weekly",
+		Validate:    validateSchedule,
+	},
+	{
+		Key:         DigestPrivate,
+		Description: "Also feature kudos given in private channels and DMs in the digest's shout-out and categories",
+		Default:     "false",
+		Validate:    validateBool,
+	},
+	{
+		Key:         Timezone,
+		Description: "Timezone of the workspace's schedules, e.g. `Europe/Prague`",
+		Default:     "UTC",
+		Validate:    validateTimezone,
+	},
+	{
+		Key:           Listen,
+		Description:   "Whether the bot reacts to messages in a channel (turn it off for the workspace and on for single channels to only listen there)",
+		Default:       "true",
+		Validate:      validateBool,
+		ChannelScoped: true,
+	},
+}
+
+var emojiPattern = regexp.MustCompile(`^[a-z0-9_+\-']+$`)
+
+var localePattern = regexp.MustCompile(`^[a-z]{2}$`)
+
+var channelPattern = regexp.MustCompile(`^<#([A-Z0-9]+)(\|[^>]*)?>$|^([CG][A-Z0-9]+)$`)
+
+// Lookup returns the definition of the setting with the given key.
+func Lookup(key string) (Definition, bool) {
+	for _, def := range Definitions {
+		if def.Key == key {
+			return def, true
+		}
+	}
+	return Definition{}, false
+}
+
+// Get returns the value of a setting for a workspace, falling back to its default.
+func Get(ctx context.Context, teamID, key string) (string, error) {
+	def, ok := Lookup(key)
+	if !ok {
+		return "", fmt.Errorf("unknown setting %s", key)
+	}
+
+	var value string
+	err := database.DB.QueryRowContext(ctx,
+		`SELECT value FROM workspace_settings WHERE team_id = ? AND key = ?`,
+		teamID, key,
+	).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return def.Default, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get setting %s: %w", key, err)
+	}
+
+	return value, nil
+}
+
+// GetBool returns the value of a boolean setting for a workspace.
+func GetBool(ctx context.Context, teamID, key string) (bool, error) {
+	value, err := Get(ctx, teamID, key)
+	if err != nil {
+		return false, err
+	}
+	return ParseBool(value)
+}
+
+// GetInt returns the value of an integer setting for a workspace.
+func GetInt(ctx context.Context, teamID, key string) (int, error) {
+	value, err := Get(ctx, teamID, key)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(value)
+}
+
+// Set validates and stores the value of a setting for a workspace.
+func Set(ctx context.Context, teamID, key, value string) error {
+	value, err := prepare(key, value, scopeWorkspace)
+	if err != nil {
+		return err
+	}
+
+	_, err = database.DB.ExecContext(ctx, `
+		INSERT INTO workspace_settings (team_id, key, value, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(team_id, key)
+		DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+		teamID, key, value, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save setting %s: %w", key, err)
+	}
+
+	for _, fn := range changeHooks {
+		fn(ctx, teamID, key)
+	}
+	return nil
+}
+
+// changeHooks are called after a workspace setting changed.
+var changeHooks []func(ctx context.Context, teamID, key string)
+
+// OnChange registers a function called after a workspace setting changed,
+// e.g. to reschedule jobs that depend on it. Register hooks at startup.
+func OnChange(fn func(ctx context.Context, teamID, key string)) {
+	changeHooks = append(changeHooks, fn)
+}
+
+// Configured returns the workspaces that set a setting to a non-empty
+// value, mapped to the value.
+func Configured(ctx context.Context, key string) (map[string]string, error) {
+	rows, err := database.DB.QueryContext(ctx,
+		`SELECT team_id, value FROM workspace_settings WHERE key = ? AND value != ''`, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query setting %s: %w", key, err)
+	}
+	defer rows.Close()
+
+	values := map[string]string{}
+	for rows.Next() {
+		var teamID, value string
+		if err := rows.Scan(&teamID, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan setting %s: %w", key, err)
+		}
+		values[teamID] = value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return values, nil
+}
+
+// GetForChannel returns the value of a setting for a channel, falling back
+// to the workspace's value.
+func GetForChannel(ctx context.Context, teamID, channelID, key string) (string, error) {
+	var value string
+	err := database.DB.QueryRowContext(ctx,
+		`SELECT value FROM channel_settings WHERE team_id = ? AND channel_id = ? AND key = ?`,
+		teamID, channelID, key,
+	).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Get(ctx, teamID, key)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get setting %s for channel %s: %w", key, channelID, err)
+	}
+
+	return value, nil
+}
+
+// SetForChannel validates and stores the value of a setting for a single channel.
+// The value "default" removes the override.
+func SetForChannel(ctx context.Context, teamID, channelID, key, value string) error {
+	if value == "default" {
+		_, err := database.DB.ExecContext(ctx,
+			`DELETE FROM channel_settings WHERE team_id = ? AND channel_id = ? AND key = ?`,
+			teamID, channelID, key,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to reset setting %s for channel %s: %w", key, channelID, err)
+		}
+		return nil
+	}
+
+	value, err := prepare(key, value, scopeChannel)
+	if err != nil {
+		return err
+	}
+
+	_, err = database.DB.ExecContext(ctx, `
+		INSERT INTO channel_settings (team_id, channel_id, key, value, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(team_id, channel_id, key)
+		DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+		teamID, channelID, key, value, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save setting %s for channel %s: %w", key, channelID, err)
+	}
+
+	return nil
+}
+
+// GetForUser returns the value of a setting for a user, falling back
+// to the workspace's value.
+func GetForUser(ctx context.Context, teamID, userID, key string) (string, error) {
+	var value string
+	err := database.DB.QueryRowContext(ctx,
+		`SELECT value FROM user_settings WHERE team_id = ? AND user_id = ? AND key = ?`,
+		teamID, userID, key,
+	).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Get(ctx, teamID, key)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get setting %s for user %s: %w", key, userID, err)
+	}
+
+	return value, nil
+}
+
+// SetForUser validates and stores the value of a setting for a single user.
+// The value "default" removes the override.
+func SetForUser(ctx context.Context, teamID, userID, key, value string) error {
+	if value == "default" {
+		_, err := database.DB.ExecContext(ctx,
+			`DELETE FROM user_settings WHERE team_id = ? AND user_id = ? AND key = ?`,
+			teamID, userID, key,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to reset setting %s for user %s: %w", key, userID, err)
+		}
+		return nil
+	}
+
+	value, err := prepare(key, value, scopeUser)
+	if err != nil {
+		return err
+	}
+
+	_, err = database.DB.ExecContext(ctx, `
+		INSERT INTO user_settings (team_id, user_id, key, value, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(team_id, user_id, key)
+		DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+		teamID, userID, key, value, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save setting %s for user %s: %w", key, userID, err)
+	}
+
+	return nil
+}
+
+// prepare normalizes and validates a value before it is stored in the given scope.
+func prepare(key, value, scope string) (string, error) {
+	def, ok := Lookup(key)
+	if !ok {
+		return "", fmt.Errorf("unknown setting %s", key)
+	}
+
+	if scope == scopeChannel && !def.ChannelScoped {
+		return "", fmt.Errorf("setting %s can't be changed for a single channel", key)
+	}
+	if scope == scopeUser && !def.UserScoped {
+		return "", fmt.Errorf("setting %s can't be changed for a single user", key)
+	}
+
+	if def.Normalize != nil {
+		normalized, err := def.Normalize(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid value for %s: %w", key, err)
+		}
+		value = normalized
+	}
+
+	if def.Validate != nil {
+		if err := def.Validate(value); err != nil {
+			return "", fmt.Errorf("invalid value for %s: %w", key, err)
+		}
+	}
+
+	return value, nil
+}
+
+// GetLocation returns the workspace's timezone.
+func GetLocation(ctx context.Context, teamID string) (*time.Location, error) {
+	value, err := Get(ctx, teamID, Timezone)
+	if err != nil {
+		return nil, err
+	}
+	return time.LoadLocation(value)
+}
+
+// GetIntList returns the value of a comma-separated integer list setting for a workspace.
+func GetIntList(ctx context.Context, teamID, key string) ([]int, error) {
+	value, err := Get(ctx, teamID, key)
+	if err != nil {
+		return nil, err
+	}
+	return ParseIntList(value)
+}
+
+// ParseIntList parses a comma-separated list of positive integers.
+func ParseIntList(value string) ([]int, error) {
+	var list []int
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("expected a number, got %q", field)
+		}
+		if n <= 0 {
+			return nil, fmt.Errorf("expected a positive number, got %d", n)
+		}
+		list = append(list, n)
+	}
+	return list, nil
+}
+
+// ParseBool parses the boolean spellings accepted in settings.
+func ParseBool(value string) (bool, error) {
+	switch value {
+	case "true", "1", "yes", "on":
+		return true, nil
+	case "false", "0", "no", "off":
+		return false, nil
+	}
+	return false, fmt.Errorf("expected on or off, got %q", value)
+}
+
+// normalizeChannel turns a channel mention such as <#C123|general> into its
+// ID. Slack escapes the channels in the text of the /kudos command, so a
+// channel typed as #general arrives as a mention, see the manifest.
+func normalizeChannel(value string) (string, error) {
+	if value == "none" || value == "off" {
+		return "", nil
+	}
+	matches := channelPattern.FindStringSubmatch(value)
+	if matches == nil && strings.HasPrefix(value, "#") {
+		// Slack only escapes the channels it knows
+		return "", fmt.Errorf("there's no channel %s, pick one from the suggestions while typing", value)
+	}
+	if matches == nil {
+		return "", fmt.Errorf("expected a channel like #general, got %q", value)
+	}
+	if matches[1] != "" {
+		return matches[1], nil
+	}
+	return matches[3], nil
+}
+
+// normalizeLocale accepts a language code, or "auto" to clear the setting.
+func normalizeLocale(value string) (string, error) {
+	value = strings.ToLower(value)
+	if value == "auto" {
+		return "", nil
+	}
+	if !localePattern.MatchString(value) {
+		return "", fmt.Errorf("expected a language code like en, got %q", value)
+	}
+	return value, nil
+}
+
+// normalizeEmoji accepts an emoji with or without the surrounding colons.
+func normalizeEmoji(value string) (string, error) {
+	value = strings.Trim(value, ":")
+	if !emojiPattern.MatchString(value) {
+		return "", fmt.Errorf("expected an emoji like :tada:, got %q", value)
+	}
+	return value, nil
+}
+
+func validateOneOf(allowed ...string) func(string) error {
+	return func(value string) error {
+		for _, a := range allowed {
+			if value == a {
+				return nil
+			}
+		}
+		return fmt.Errorf("expected one of %s, got %q", strings.Join(allowed, ", "), value)
+	}
+}
+
+func validateSchedule(value string) error {
+	_, err := schedule.Parse(value)
+	return err
+}
+
+func validateTimezone(value string) error {
+	if _, err := time.LoadLocation(value); err != nil || value == "" || value == "Local" {
+		return fmt.Errorf("expected a timezone like Europe/Prague, got %q", value)
+	}
+	return nil
+}
+
+func validateBool(value string) error {
+	_, err := ParseBool(value)
+	return err
+}
+
+func validateIntList(value string) error {
+	_, err := ParseIntList(value)
+	return err
+}
+
+func validateNonNegativeInt(value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("expected a number, got %q", value)
+	}
+	if n < 0 {
+		return fmt.Errorf("expected a non-negative number, got %d", n)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package settings
+
+import "testing"
+
+func TestNormalizeChannel(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		// What Slack sends for #kudos in the escaped text of the command
+		{name: "escaped", value: "<#C123|kudos>", want: "C123"},
+		{name: "escaped without name", value: "<#C123>", want: "C123"},
+		{name: "escaped with empty name", value: "<#C123|>", want: "C123"},
+		{name: "private channel", value: "<#G123|secret>", want: "G123"},
+		{name: "id", value: "C123", want: "C123"},
+		{name: "none", value: "none", want: ""},
+		{name: "off", value: "off", want: ""},
+		// Slack leaves channels it doesn't know as they were typed
+		{name: "plain name", value: "#kudos", wantErr: true},
+		{name: "user mention", value: "<@U123>", wantErr: true},
+		{name: "text", value: "kudos", wantErr: true},
+		{name: "empty", value: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeChannel(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeChannel(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("normalizeChannel(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package slackhttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/kaplan-michael/slack-kudos/pkg/handler"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// maxBodySize limits the size of the requests Slack sends.
+const maxBodySize = 1 << 20
+
+// queueTimeout is how long a request waits for space in a full queue.
+// Slack retries requests that aren't answered within three seconds.
+const queueTimeout = time.Second
+
+// Handler receives events, slash commands and interactions over HTTP, for
+// environments where Socket Mode can't be used. Requests are verified with
+// the app's signing secret, queued and acknowledged, then dispatched the
+// same way as the events received over Socket Mode. When the queue stays
+// full, requests are answered with 503 and Slack tries again later.
+type Handler struct {
+	signingSecret string
+	enqueue       func(ctx context.Context, req handler.Request) error
+}
+
+// NewHandler creates a handler verifying requests with the signing secret
+// and passing them to enqueue.
+func NewHandler(signingSecret string, enqueue func(ctx context.Context, req handler.Request) error) *Handler {
+	return &Handler{
+		signingSecret: signingSecret,
+		enqueue:       enqueue,
+	}
+}
+
+// Events handles the Events API request URL.
+func (h *Handler) Events(w http.ResponseWriter, r *http.Request) {
+	body, ok := h.verify(w, r)
+	if !ok {
+		return
+	}
+
+	event, err := slackevents.ParseEvent(json.RawMessage(body), slackevents.OptionNoVerifyToken())
+	if err != nil {
+		log.Warnf("Failed to parse event: %v", err)
+		http.Error(w, "Invalid event", http.StatusBadRequest)
+		return
+	}
+
+	switch event.Type {
+	case slackevents.URLVerification:
+		// Slack checks the request URL by having it echo a challenge
+		var challenge slackevents.ChallengeResponse
+		if err := json.Unmarshal(body, &challenge); err != nil {
+			http.Error(w, "Invalid challenge", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, challenge.Challenge)
+
+	case slackevents.CallbackEvent:
+		h.accept(w, r, handler.EventRequest(event))
+
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// Commands handles the request URL of the slash commands.
+func (h *Handler) Commands(w http.ResponseWriter, r *http.Request) {
+	body, ok := h.verify(w, r)
+	if !ok {
+		return
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	command, err := slack.SlashCommandParse(r)
+	if err != nil {
+		log.Warnf("Failed to parse slash command: %v", err)
+		http.Error(w, "Invalid command", http.StatusBadRequest)
+		return
+	}
+
+	// The command replies on its own, an empty response just acknowledges it
+	h.accept(w, r, handler.CommandRequest(command))
+}
+
+// Interactivity handles the interactivity request URL, e.g. button clicks.
+func (h *Handler) Interactivity(w http.ResponseWriter, r *http.Request) {
+	body, ok := h.verify(w, r)
+	if !ok {
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+
+	var callback slack.InteractionCallback
+	if err := json.Unmarshal([]byte(form.Get("payload")), &callback); err != nil {
+		log.Warnf("Failed to parse interaction: %v", err)
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	h.accept(w, r, handler.InteractionRequest(callback))
+}
+
+// accept queues the request and acknowledges it, or asks Slack to retry
+// when the queue stays full.
+func (h *Handler) accept(w http.ResponseWriter, r *http.Request, req handler.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), queueTimeout)
+	defer cancel()
+
+	if err := h.enqueue(ctx, req); err != nil {
+		log.Warnf("Rejected %s request for workspace %s: %v", req.Kind, req.TeamID, err)
+		http.Error(w, "Busy, try again later", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// verify reads the request body and checks that Slack signed it recently.
+// Requests older than five minutes are rejected, so that a captured request
+// can't be replayed later. On failure the error response is already written.
+func (h *Handler) verify(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "Failed to read request", http.StatusBadRequest)
+		return nil, false
+	}
+
+	verifier, err := slack.NewSecretsVerifier(r.Header, h.signingSecret)
+	if err != nil {
+		log.Warnf("Rejected request to %s: %v", r.URL.Path, err)
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return nil, false
+	}
+	if _, err := verifier.Write(body); err != nil {
+		http.Error(w, "Failed to verify request", http.StatusInternalServerError)
+		return nil, false
+	}
+	if err := verifier.Ensure(); err != nil {
+		log.Warnf("Rejected request to %s: %v", r.URL.Path, err)
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	return body, true
+}
@@ -0,0 +1,238 @@
+package slackhttp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kaplan-michael/slack-kudos/pkg/handler"
+)
+
+const secret = "8f742231b10e8888abcd99yyyzzz85a5"
+
+const messageEvent = `{
+	"type": "event_callback",
+	"team_id": "T1",
+	"event": {"type": "message", "channel": "C1", "user": "U1", "text": "<@U2> ++", "ts": "1700000000.000001"}
+}`
+
+// sign signs a request to the handler like Slack does, see
+// https://api.slack.com/authentication/verifying-requests-from-slack.
+func sign(method, path, body string, at time.Time, key string) *http.Request {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	ts := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(key))
+	fmt.Fprintf(mac, "v0:%s:%s", ts, body)
+	r.Header.Set("X-Slack-Request-Timestamp", ts)
+	r.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return r
+}
+
+// recorder returns a handler recording the requests it queues.
+func recorder(enqueueErr error) (*Handler, *[]handler.Request) {
+	var queued []handler.Request
+	h := NewHandler(secret, func(ctx context.Context, req handler.Request) error {
+		if enqueueErr != nil {
+			return enqueueErr
+		}
+		queued = append(queued, req)
+		return nil
+	})
+	return h, &queued
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		request func() *http.Request
+		status  int
+	}{
+		{
+			name:    "valid",
+			request: func() *http.Request { return sign(http.MethodPost, "/slack/events", messageEvent, now, secret) },
+			status:  http.StatusOK,
+		},
+		{
+			name: "recent",
+			request: func() *http.Request {
+				return sign(http.MethodPost, "/slack/events", messageEvent, now.Add(-4*time.Minute), secret)
+			},
+			status: http.StatusOK,
+		},
+		{
+			name: "stale timestamp",
+			request: func() *http.Request {
+				return sign(http.MethodPost, "/slack/events", messageEvent, now.Add(-6*time.Minute), secret)
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "timestamp from the future",
+			request: func() *http.Request {
+				return sign(http.MethodPost, "/slack/events", messageEvent, now.Add(6*time.Minute), secret)
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:    "wrong secret",
+			request: func() *http.Request { return sign(http.MethodPost, "/slack/events", messageEvent, now, "other") },
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name: "tampered body",
+			request: func() *http.Request {
+				r := sign(http.MethodPost, "/slack/events", messageEvent, now, secret)
+				tampered := sign(http.MethodPost, "/slack/events", strings.Replace(messageEvent, "U2", "U3", 1), now, secret)
+				tampered.Header = r.Header
+				return tampered
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "replayed with a new timestamp",
+			request: func() *http.Request {
+				r := sign(http.MethodPost, "/slack/events", messageEvent, now.Add(-time.Hour), secret)
+				r.Header.Set("X-Slack-Request-Timestamp", strconv.FormatInt(now.Unix(), 10))
+				return r
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "unsigned",
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodPost, "/slack/events", strings.NewReader(messageEvent))
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "invalid timestamp",
+			request: func() *http.Request {
+				r := sign(http.MethodPost, "/slack/events", messageEvent, now, secret)
+				r.Header.Set("X-Slack-Request-Timestamp", "yesterday")
+				return r
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:    "get",
+			request: func() *http.Request { return sign(http.MethodGet, "/slack/events", "", now, secret) },
+			status:  http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, queued := recorder(nil)
+			w := httptest.NewRecorder()
+			h.Events(w, tt.request())
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			wantQueued := 0
+			if tt.status == http.StatusOK {
+				wantQueued = 1
+			}
+			if len(*queued) != wantQueued {
+				t.Errorf("queued %d requests, want %d", len(*queued), wantQueued)
+			}
+		})
+	}
+}
+
+func TestEvents(t *testing.T) {
+	h, queued := recorder(nil)
+	w := httptest.NewRecorder()
+	h.Events(w, sign(http.MethodPost, "/slack/events", messageEvent, time.Now(), secret))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if len(*queued) != 1 {
+		t.Fatalf("queued %d requests, want 1", len(*queued))
+	}
+	if req := (*queued)[0]; req.Kind != handler.KindEvent || req.TeamID != "T1" {
+		t.Errorf("queued %+v, want an event of T1", req)
+	}
+}
+
+func TestURLVerification(t *testing.T) {
+	body := `{"type": "url_verification", "token": "x", "challenge": "3eZbrw1aBm2rZgRNFdxV2595E9CY3gmdALWMmHkvFXO7tYXAYM8P"}`
+	h, queued := recorder(nil)
+	w := httptest.NewRecorder()
+	h.Events(w, sign(http.MethodPost, "/slack/events", body, time.Now(), secret))
+
+	if w.Code != http.StatusOK || w.Body.String() != "3eZbrw1aBm2rZgRNFdxV2595E9CY3gmdALWMmHkvFXO7tYXAYM8P" {
+		t.Errorf("response = %d %q, want the challenge", w.Code, w.Body.String())
+	}
+	if len(*queued) != 0 {
+		t.Errorf("queued %d requests, want none", len(*queued))
+	}
+}
+
+func TestCommands(t *testing.T) {
+	body := url.Values{
+		"team_id":      {"T1"},
+		"channel_id":   {"C1"},
+		"user_id":      {"U1"},
+		"command":      {"/kudos"},
+		"text":         {"top 5"},
+		"response_url": {"https://hooks.slack.test/commands/1"},
+	}.Encode()
+
+	h, queued := recorder(nil)
+	w := httptest.NewRecorder()
+	r := sign(http.MethodPost, "/slack/commands", body, time.Now(), secret)
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	h.Commands(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if len(*queued) != 1 {
+		t.Fatalf("queued %d requests, want 1", len(*queued))
+	}
+	if req := (*queued)[0]; req.Kind != handler.KindCommand || req.Command.Text != "top 5" || req.TeamID != "T1" {
+		t.Errorf("queued %+v, want the command", req)
+	}
+}
+
+func TestInteractivity(t *testing.T) {
+	body := url.Values{
+		"payload": {`{"type": "block_actions", "team": {"id": "T1"}, "user": {"id": "U1"}, "actions": [{"action_id": "kudos_undo", "value": "42"}]}`},
+	}.Encode()
+
+	h, queued := recorder(nil)
+	w := httptest.NewRecorder()
+	h.Interactivity(w, sign(http.MethodPost, "/slack/interactivity", body, time.Now(), secret))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if len(*queued) != 1 || (*queued)[0].Kind != handler.KindInteraction {
+		t.Errorf("queued %+v, want the interaction", *queued)
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	h, _ := recorder(errors.New("queue full"))
+	w := httptest.NewRecorder()
+	h.Events(w, sign(http.MethodPost, "/slack/events", messageEvent, time.Now(), secret))
+
+	// Slack retries requests answered with an error
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
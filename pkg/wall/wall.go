@@ -0,0 +1,81 @@
+package wall
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/charmbracelet/log"
+	"github.com/kaplan-michael/slack-kudos/pkg/kudos"
+	"github.com/kaplan-michael/slack-kudos/pkg/messages"
+	"github.com/kaplan-michael/slack-kudos/pkg/respond"
+	"github.com/kaplan-michael/slack-kudos/pkg/settings"
+)
+
+// Post cross-posts a kudos to the workspace's kudos wall channel as a card
+// with the giver, recipient, reason and a link back to the original message.
+// Kudos from private channels and DMs are only posted if the workspace opted in.
+func Post(ctx context.Context, api respond.Responder, result kudos.Result) error {
+	k := result.Kudos
+	if k.Amount <= 0 {
+		return nil
+	}
+
+	wallChannel, err := settings.Get(ctx, k.TeamID, settings.WallChannel)
+	if err != nil {
+		return fmt.Errorf("failed to get kudos wall channel: %w", err)
+	}
+	// Kudos given on the wall itself are already there
+	if wallChannel == "" || wallChannel == k.ChannelID {
+		return nil
+	}
+
+	data := messages.Data{
+		"GiverID":   k.GiverID,
+		"Anonymous": k.Anonymous,
+		"UserID":    k.RecipientID,
+		"Count":     result.Count,
+		"Reason":    messages.UserText(k.Reason),
+	}
+
+	if k.ChannelID != "" {
+		private, err := respond.IsPrivate(ctx, api, k.ChannelID)
+		if err != nil {
+			return err
+		}
+		if private {
+			allowed, err := settings.GetBool(ctx, k.TeamID, settings.WallPrivate)
+			if err != nil {
+				return fmt.Errorf("failed to get kudos wall privacy setting: %w", err)
+			}
+			if !allowed {
+				return nil
+			}
+		}
+
+		data["ChannelID"] = k.ChannelID
+		if k.MessageTS != "" {
+			permalink, err := respond.Permalink(ctx, api, k.ChannelID, k.MessageTS)
+			if err != nil {
+				log.FromContext(ctx).Warnf("Failed to link kudos wall card to the kudos message: %v", err)
+			}
+			data["Permalink"] = permalink
+		}
+	}
+
+	locale, err := settings.Get(ctx, k.TeamID, settings.Locale)
+	if err != nil || locale == "" {
+		locale = messages.DefaultLocale
+	}
+
+	msg, err := messages.Render(ctx, k.TeamID, locale, "wall", data)
+	if err != nil {
+		return err
+	}
+
+	if _, err := respond.Channel(ctx, api, wallChannel, msg); err != nil {
+		return fmt.Errorf("failed to post to kudos wall: %w", err)
+	}
+
+	log.FromContext(ctx).Debugf("Posted kudos %d to the kudos wall of workspace %s", k.ID, k.TeamID)
+	return nil
+}
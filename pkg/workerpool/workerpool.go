@@ -0,0 +1,157 @@
+// Package workerpool handles tasks with a fixed number of workers.
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrClosed is returned when a task is submitted to a closed pool.
+var ErrClosed = errors.New("worker pool is closed")
+
+// Pool runs tasks with a fixed number of workers. Tasks with the same key
+// run one at a time in the order they were submitted, e.g. the events of a
+// channel, while tasks with other keys run in parallel. Every key has a
+// queue of its own, a free worker takes the next task of a key that has
+// none running, so a slow key never holds up the others. The pool holds a
+// bounded number of tasks, submitting to a full pool blocks until there's
+// space.
+type Pool struct {
+	// slots bounds the tasks in the pool, queued or running
+	slots chan struct{}
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	// keys are the queues of the keys with queued or running tasks
+	keys map[string]*keyQueue
+	// ready are the keys with queued tasks and none running, in the order
+	// they got ready
+	ready []string
+	// depth is the number of tasks waiting for a worker
+	depth   int
+	closed  bool
+	workers sync.WaitGroup
+}
+
+// keyQueue holds the tasks of a key.
+type keyQueue struct {
+	tasks   []func()
+	running bool
+}
+
+// New starts a pool of workers. It holds queueSize tasks per worker on top
+// of the running ones.
+func New(workers, queueSize int) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	p := &Pool{
+		slots: make(chan struct{}, workers*(queueSize+1)),
+		keys:  map[string]*keyQueue{},
+	}
+	p.cond = sync.NewCond(&p.mu)
+	for i := 0; i < workers; i++ {
+		p.workers.Add(1)
+		go p.work()
+	}
+	return p
+}
+
+// Submit queues a task behind the other tasks with the same key. It blocks
+// while the pool is full, until the task is queued or ctx is done.
+func (p *Pool) Submit(ctx context.Context, key string, task func()) error {
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+	if closed {
+		return ErrClosed
+	}
+
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// Closed while waiting for space
+	if p.closed {
+		<-p.slots
+		return ErrClosed
+	}
+
+	q := p.keys[key]
+	if q == nil {
+		q = &keyQueue{}
+		p.keys[key] = q
+	}
+	q.tasks = append(q.tasks, task)
+	p.depth++
+	if !q.running && len(q.tasks) == 1 {
+		p.ready = append(p.ready, key)
+		p.cond.Signal()
+	}
+	return nil
+}
+
+// Depth returns the number of tasks waiting for a worker.
+func (p *Pool) Depth() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.depth
+}
+
+// Close stops accepting tasks and waits for the queued and running tasks.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+
+	p.workers.Wait()
+}
+
+// work runs the next task of the key that got ready first, until the pool
+// is closed and there's nothing left to start. A key with more tasks gets
+// ready again behind the others once its task is done.
+func (p *Pool) work() {
+	defer p.workers.Done()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for {
+		for len(p.ready) == 0 && !p.closed {
+			p.cond.Wait()
+		}
+		// The keys still running get ready again for their own worker
+		if len(p.ready) == 0 {
+			return
+		}
+
+		key := p.ready[0]
+		p.ready = p.ready[1:]
+		q := p.keys[key]
+		task := q.tasks[0]
+		q.tasks = q.tasks[1:]
+		q.running = true
+		p.depth--
+
+		p.mu.Unlock()
+		task()
+		<-p.slots
+		p.mu.Lock()
+
+		q.running = false
+		if len(q.tasks) > 0 {
+			p.ready = append(p.ready, key)
+		} else {
+			delete(p.keys, key)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSameKeyInOrder(t *testing.T) {
+	p := New(4, 8)
+
+	const channels, messages = 6, 100
+	var mu sync.Mutex
+	handled := map[string][]int{}
+	running := map[string]bool{}
+
+	// Messages of the channels arrive interleaved
+	for i := 0; i < messages; i++ {
+		for c := 0; c < channels; c++ {
+			channel, i := fmt.Sprintf("C%d", c), i
+			err := p.Submit(context.Background(), channel, func() {
+				mu.Lock()
+				if running[channel] {
+					t.Errorf("two messages of channel %s handled at once", channel)
+				}
+				running[channel] = true
+				mu.Unlock()
+
+				time.Sleep(time.Duration(rand.Intn(100)) * time.Microsecond)
+
+				mu.Lock()
+				running[channel] = false
+				handled[channel] = append(handled[channel], i)
+				mu.Unlock()
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	p.Close()
+
+	for c := 0; c < channels; c++ {
+		channel := fmt.Sprintf("C%d", c)
+		got := handled[channel]
+		if len(got) != messages {
+			t.Fatalf("handled %d messages of channel %s, want %d", len(got), channel, messages)
+		}
+		for i, n := range got {
+			if n != i {
+				t.Fatalf("messages of channel %s handled in order %v", channel, got)
+			}
+		}
+	}
+}
+
+func TestOtherKeysInParallel(t *testing.T) {
+	p := New(2, 10)
+	defer p.Close()
+
+	// One slow key, the other worker handles every other key meanwhile
+	release := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		if err := p.Submit(context.Background(), "C0", func() { <-release }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer close(release)
+
+	const keys = 10
+	var wg sync.WaitGroup
+	wg.Add(keys)
+	for i := 1; i <= keys; i++ {
+		if err := p.Submit(context.Background(), fmt.Sprintf("C%d", i), wg.Done); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a slow task of one key held up other keys")
+	}
+}
+
+func TestSubmitFullQueue(t *testing.T) {
+	p := New(1, 1)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	if err := p.Submit(context.Background(), "C1", func() { close(started); <-release }); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if err := p.Submit(context.Background(), "C1", func() {}); err != nil {
+		t.Fatal(err)
+	}
+	if depth := p.Depth(); depth != 1 {
+		t.Errorf("Depth() = %d, want 1", depth)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Submit(ctx, "C1", func() {}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Submit() to a full queue error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if depth := p.Depth(); depth != 1 {
+		t.Errorf("Depth() after a rejected task = %d, want 1", depth)
+	}
+
+	close(release)
+	p.Close()
+	if depth := p.Depth(); depth != 0 {
+		t.Errorf("Depth() after Close() = %d, want 0", depth)
+	}
+}
+
+func TestClose(t *testing.T) {
+	p := New(2, 10)
+	var mu sync.Mutex
+	handled := 0
+	for i := 0; i < 10; i++ {
+		err := p.Submit(context.Background(), "C1", func() {
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			handled++
+			mu.Unlock()
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Close waits for the queued tasks
+	p.Close()
+	if handled != 10 {
+		t.Errorf("handled %d tasks before Close() returned, want 10", handled)
+	}
+
+	if err := p.Submit(context.Background(), "C1", func() {}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Submit() after Close() error = %v, want %v", err, ErrClosed)
+	}
+	// Closing twice is fine
+	p.Close()
+}